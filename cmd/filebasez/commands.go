@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/panhongrainbow/filebasez/shm"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// typeNames are the names of the data structure types, as printed and accepted by the commands
+var typeNames = map[shm.VshmType]string{
+	shm.TypeRaw:              "raw",
+	shm.TypeSpeedyArrayInt32: "speedyArrayInt32",
+	shm.TypeChain:            "chain",
+	shm.TypeChainLink:        "chainLink",
+}
+
+// typeName returns the name of the data structure type.
+func typeName(typ shm.VshmType) (name string) {
+	name = typeNames[typ]
+	if name == "" {
+		name = "unknown(" + strconv.Itoa(int(typ)) + ")"
+	}
+	return
+}
+
+// newFlags creates the flag set of a subcommand, its errors are reported by run.
+func newFlags(name string) (flags *flag.FlagSet) {
+	flags = flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return
+}
+
+// parseArgs parses the flags of a subcommand, and checks that the expected number of arguments is left.
+func parseArgs(flags *flag.FlagSet, args []string, count int) (err error) {
+	err = flags.Parse(args)
+	if err != nil || flags.NArg() != count {
+		err = errUsage
+	}
+	return
+}
+
+/*
+openSegment opens the segment for the key in the argument in a registry of its own, and validates its header.
+The caller closes the segment with the registry, or deletes it.
+*/
+func openSegment(backend shm.Backend, arg string) (registry *shm.Vregistry, key int64, sg *shm.Vsegment, err error) {
+	// Parse the key
+	key, err = parseKey(arg)
+	if err != nil {
+		return
+	}
+
+	// Open the segment
+	registry = shm.NewRegistry()
+	err = registry.OpenShmWithOpts(shm.Vopts{Key: key, Backend: backend})
+	if err != nil {
+		return
+	}
+	sg, err = registry.Segment(key)
+
+	// Return the segment
+	return
+}
+
+// listCommand lists the System V segments of the host, usage: ls [-filebasez]
+func listCommand(backend shm.Backend, args []string, stdout io.Writer) (err error) {
+	// Parse the arguments
+	flags := newFlags("ls")
+	only := flags.Bool("filebasez", false, "only list the segments of filebasez")
+	err = parseArgs(flags, args, 0)
+	if err != nil {
+		return
+	}
+
+	// List the segments
+	var entries []shm.Ventry
+	entries, err = shm.ListShm()
+	if err != nil {
+		return
+	}
+
+	// Print one segment per line
+	writer := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "KEY\tID\tSIZE\tUID\tMODE\tNATTCH\tVERSION\tTYPE\tSTATUS")
+	for _, entry := range entries {
+		if *only && !entry.Filebasez {
+			continue
+		}
+		version, typ, status := "-", "-", "ok"
+		if entry.Filebasez {
+			version = fmt.Sprintf("%d.%d.%d", entry.Major, entry.Minor, entry.Patch)
+			typ = typeName(entry.Type)
+		}
+		if entry.HeaderErr != nil {
+			status = entry.HeaderErr.Error()
+		}
+		_, _ = fmt.Fprintf(writer, "%#x\t%d\t%d\t%d\t%v\t%d\t%s\t%s\t%s\n",
+			entry.Key, entry.Id, entry.Size, entry.Uid, entry.Mode, entry.Attaches, version, typ, status)
+	}
+	err = writer.Flush()
+
+	// Return the error value
+	return
+}
+
+// infoCommand decodes the header of the segment, also when OpenShm refuses it, usage: info <key>
+func infoCommand(backend shm.Backend, args []string, stdout io.Writer) (err error) {
+	// Parse the arguments
+	flags := newFlags("info")
+	err = parseArgs(flags, args, 1)
+	if err != nil {
+		return
+	}
+	key, err := parseKey(flags.Arg(0))
+	if err != nil {
+		return
+	}
+
+	// Read the header without validating it
+	id, info, headerErr, err := shm.PeekShm(shm.Vopts{Key: key, Backend: backend})
+	if err != nil {
+		return
+	}
+
+	// Print why the header can not be opened, and the id of the segment, the id in the header may differ
+	writer := tabwriter.NewWriter(stdout, 0, 8, 1, ' ', 0)
+	status := "ok"
+	if headerErr != nil {
+		status = headerErr.Error()
+	}
+	_, _ = fmt.Fprintf(writer, "Status:\t%s\n", status)
+	_, _ = fmt.Fprintf(writer, "Segment:\t%d\n", id)
+
+	// Print the version of the headers with the magic number, and the fields of the headers of the current major version
+	optional := func(set bool, value interface{}) string {
+		if !set {
+			return "-"
+		}
+		return fmt.Sprint(value)
+	}
+	if string(info.Magic[:]) == shm.ShmMagic {
+		_, _ = fmt.Fprintf(writer, "Magic:\t%s\n", info.Magic[:])
+		_, _ = fmt.Fprintf(writer, "Version:\t%d.%d.%d\n", info.Major, info.Minor, info.Patch)
+	}
+	if string(info.Magic[:]) == shm.ShmMagic && info.Major == shm.MajorVersion {
+		_, _ = fmt.Fprintf(writer, "Type:\t%s\n", typeName(shm.VshmType(info.Type)))
+		if shm.VshmType(info.Type) == shm.TypeSpeedyArrayInt32 {
+			_, _ = fmt.Fprintf(writer, "Width:\t%s\n", optional(info.Width != 0, info.Width))
+		}
+		_, _ = fmt.Fprintf(writer, "Key:\t%d (%#x)\n", info.Key, info.Key)
+		_, _ = fmt.Fprintf(writer, "Id:\t%d\n", info.Id)
+		_, _ = fmt.Fprintf(writer, "Size:\t%d\n", info.Size)
+		_, _ = fmt.Fprintf(writer, "Offset:\t%d (%d bytes used)\n", info.Offset, info.Offset-shm.DefualtMinShmSize)
+		_, _ = fmt.Fprintf(writer, "Flag:\t%#o\n", info.Flag)
+		_, _ = fmt.Fprintf(writer, "Mode:\t%v\n", info.Mode)
+		_, _ = fmt.Fprintf(writer, "Checksum:\t%#08x\n", info.Checksum)
+		_, _ = fmt.Fprintf(writer, "Created:\t%s\n", optional(!info.Created.IsZero(), info.Created.Format(time.RFC3339)))
+		_, _ = fmt.Fprintf(writer, "TTL:\t%s\n", optional(info.TTL != 0, info.TTL))
+		_, _ = fmt.Fprintf(writer, "Pinned:\t%t\n", info.Pinned)
+	}
+	err = writer.Flush()
+
+	// Return the error value
+	return
+}
+
+/*
+dumpCommand prints the data of the segment, usage: dump [-width n] [-hex] <key>
+The width of the rows of a speedy array is read from its header, -width is only needed for the arrays whose header does not record it.
+*/
+func dumpCommand(backend shm.Backend, args []string, stdout io.Writer) (err error) {
+	// Parse the arguments
+	flags := newFlags("dump")
+	width := flags.Int("width", 0, "number of int32 values in a row of a speedy array which does not record it")
+	forceHex := flags.Bool("hex", false, "print a hexdump, also for speedy arrays")
+	err = parseArgs(flags, args, 1)
+	if err != nil || *width < 0 {
+		err = errUsage
+		return
+	}
+
+	// Open the segment
+	registry, key, sg, err := openSegment(backend, flags.Arg(0))
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = registry.CloseShm(key)
+	}()
+
+	// Find the data written so far, between the header and the offset
+	var info shm.Vinfo
+	info, err = sg.Info()
+	if err != nil {
+		return
+	}
+	var data []byte
+	data, err = sg.Bytes(0, info.Offset-shm.DefualtMinShmSize)
+	if err != nil {
+		return
+	}
+
+	// Print a hexdump, with the offsets counted from the end of the header
+	if shm.VshmType(info.Type) != shm.TypeSpeedyArrayInt32 || *forceHex {
+		_, err = io.WriteString(stdout, hex.Dump(data))
+		return
+	}
+
+	// Take the width recorded in the header, a width given with -width must agree with it
+	if info.Width != 0 {
+		if *width != 0 && *width != int(info.Width) {
+			err = errUsage
+			return
+		}
+		*width = int(info.Width)
+	}
+	if *width == 0 {
+		err = errUsage
+		return
+	}
+
+	// Print the int32 values of a speedy array, one row per line, prefixed by the shift of the row
+	rowSize := *width * 4
+	for shift := 0; shift < len(data); shift += rowSize {
+		row := data[shift:]
+		if len(row) > rowSize {
+			row = row[:rowSize]
+		}
+		values := make([]string, 0, *width)
+		for i := 0; i+4 <= len(row); i += 4 {
+			values = append(values, strconv.Itoa(int(int32(binary.LittleEndian.Uint32(row[i:])))))
+		}
+		_, err = fmt.Fprintf(stdout, "%8d: %s\n", shift, strings.Join(values, " "))
+		if err != nil {
+			return
+		}
+	}
+
+	// Return the error value
+	return
+}
+
+/*
+removeCommand removes the segment by its id, also when OpenShm refuses its header, usage: rm <key>
+The head of a chain is removed with all its links, and segments of other programs are refused.
+*/
+func removeCommand(backend shm.Backend, args []string, stdout io.Writer) (err error) {
+	// Parse the arguments
+	flags := newFlags("rm")
+	err = parseArgs(flags, args, 1)
+	if err != nil {
+		return
+	}
+	opts := shm.Vopts{Backend: backend}
+	opts.Key, err = parseKey(flags.Arg(0))
+	if err != nil {
+		return
+	}
+
+	// Read the header, so only segments of filebasez are removed
+	id, info, headerErr, err := shm.PeekShm(opts)
+	if err != nil {
+		return
+	}
+	if errors.Is(headerErr, shm.ErrForeignShm) {
+		err = headerErr
+		return
+	}
+
+	// Remove the chain with its links
+	if headerErr == nil && shm.VshmType(info.Type) == shm.TypeChain {
+		var chain *shm.Vchain
+		chain, err = shm.OpenChain(opts)
+		if err != nil {
+			return
+		}
+		err = chain.Delete()
+		return
+	}
+
+	// Remove the segment with the id which was read, a segment created under the key since then stays
+	err = backend.Remove(opts.Key, id)
+
+	// Return the error value
+	return
+}
+
+/*
+createCommand creates a segment with an empty header, usage: create -ttl duration [-mode 0600] [-type raw] [-width n] <key> <size>
+The command exits right after creating the segment, and gc removes the segments whose creator is gone unless they have a time to live,
+so -ttl is required: gc keeps the segment until the time to live has passed and no process is attached to it.
+Speedy arrays need -width, the number of int32 values in a row, which is recorded in the header for dump.
+*/
+func createCommand(backend shm.Backend, args []string, stdout io.Writer) (err error) {
+	// Parse the arguments
+	flags := newFlags("create")
+	mode := flags.String("mode", "0600", "permission bits in octal")
+	ttl := flags.Duration("ttl", 0, "time to live, after which gc removes the segment once it is detached, required")
+	typ := flags.String("type", "raw", "data structure type recorded in the header: raw or speedyArrayInt32")
+	width := flags.Uint("width", 0, "number of int32 values in a row of a speedy array")
+	err = parseArgs(flags, args, 2)
+	if err != nil {
+		return
+	}
+	opts := shm.Vopts{Backend: backend, TTL: *ttl, Type: -1, Width: uint32(*width)}
+	for value, name := range typeNames {
+		if name == *typ {
+			opts.Type = value
+		}
+	}
+	perm, err1 := strconv.ParseUint(*mode, 8, 32)
+	if err1 != nil || perm&^0777 != 0 || opts.Type < 0 || *ttl < time.Second || (opts.Type == shm.TypeSpeedyArrayInt32) != (*width != 0) || *width > math.MaxUint32 {
+		err = errUsage
+		return
+	}
+	opts.Mode = os.FileMode(perm)
+	opts.Key, err = parseKey(flags.Arg(0))
+	if err != nil {
+		return
+	}
+	opts.Size, err = strconv.ParseInt(flags.Arg(1), 0, 64)
+	if err != nil {
+		err = errUsage
+		return
+	}
+
+	// Create the segment and detach it, the segment stays until it is removed
+	registry := shm.NewRegistry()
+	err = registry.NewShm(opts)
+	if err != nil {
+		return
+	}
+	err = registry.CloseShm(opts.Key)
+
+	// Return the error value
+	return
+}
+
+// gcCommand removes the orphaned segments and prints them, usage: gc [-dry-run]
+func gcCommand(backend shm.Backend, args []string, stdout io.Writer) (err error) {
+	// Parse the arguments
+	flags := newFlags("gc")
+	dryRun := flags.Bool("dry-run", false, "only print the orphaned segments")
+	err = parseArgs(flags, args, 0)
+	if err != nil {
+		return
+	}
+
+	// Collect the orphaned segments
+	var collected []shm.Ventry
+	collected, err = shm.GcShm(shm.VgcOpts{DryRun: *dryRun})
+
+	// Print what was removed, also when removing failed halfway
+	verb := "removed"
+	if *dryRun {
+		verb = "would remove"
+	}
+	for _, entry := range collected {
+		_, _ = fmt.Fprintf(stdout, "%s key %#x id %d size %d created by pid %d\n", verb, entry.Key, entry.Id, entry.Size, entry.CreatorPid)
+	}
+
+	// Return the error value
+	return
+}
@@ -0,0 +1,143 @@
+/*
+Command filebasez inspects and manages the shared memory segments of filebasez,
+so segments can be debugged without ipcs, ipcrm and decoding the header by hand.
+
+Usage:
+
+	filebasez [-backend sysv|posix|file] [-dir directory] <command> [arguments]
+
+The commands are:
+
+	ls                  list the System V segments of the host, and which of them belong to filebasez
+	info <key>          decode the header of the segment, also when it is damaged
+	dump <key>          print the data of the segment, as int32 rows for speedy arrays and as a hexdump otherwise
+	rm <key>            remove the segment, also when its header is damaged, and a chain with all its links
+	create <key> <size> create a segment with an empty header, which gc keeps for the time to live given with -ttl
+	gc                  remove the orphaned segments, see shm.GcShm
+
+Keys are decimal, or hexadecimal with the 0x prefix like ipcs prints them.
+The segments of shm.MemoryBackend only live inside the process which created them, so there is no backend for them.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/panhongrainbow/filebasez/shm"
+	"io"
+	"os"
+	"strconv"
+)
+
+// exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// command runs one subcommand with the backend chosen by the global flags and its own arguments
+type command func(backend shm.Backend, args []string, stdout io.Writer) (err error)
+
+// commands maps the names of the subcommands to their implementations
+var commands = map[string]command{
+	"ls":     listCommand,
+	"info":   infoCommand,
+	"dump":   dumpCommand,
+	"rm":     removeCommand,
+	"create": createCommand,
+	"gc":     gcCommand,
+}
+
+// errUsage is returned by the commands when their arguments are wrong
+const errUsage = Error("wrong arguments")
+
+// Error Defines a new Error type as a string
+type Error string
+
+// Error returns the error message
+func (e Error) Error() string {
+	return string(e)
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run parses the global flags, runs the subcommand and returns the exit code.
+func run(args []string, stdout, stderr io.Writer) (code int) {
+	// Parse the global flags
+	flags := flag.NewFlagSet("filebasez", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	backendName := flags.String("backend", "sysv", "kind of shared memory: sysv, posix or file")
+	dir := flags.String("dir", "", "directory of the files of the file backend")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "usage: filebasez [-backend sysv|posix|file] [-dir directory] <ls|info|dump|rm|create|gc> [arguments]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		code = exitUsage
+		return
+	}
+
+	// Find the subcommand
+	if flags.NArg() == 0 {
+		flags.Usage()
+		code = exitUsage
+		return
+	}
+	name := flags.Arg(0)
+	cmd := commands[name]
+	if cmd == nil {
+		_, _ = fmt.Fprintf(stderr, "filebasez: unknown command %q\n", name)
+		flags.Usage()
+		code = exitUsage
+		return
+	}
+
+	// Choose the backend
+	backend, err := parseBackend(*backendName, *dir)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "filebasez: %v\n", err)
+		code = exitUsage
+		return
+	}
+
+	// Run the subcommand
+	err = cmd(backend, flags.Args()[1:], stdout)
+	switch {
+	case err == errUsage:
+		_, _ = fmt.Fprintf(stderr, "filebasez %s: %v\n", name, err)
+		code = exitUsage
+	case err != nil:
+		_, _ = fmt.Fprintf(stderr, "filebasez %s: %v\n", name, err)
+		code = exitError
+	}
+
+	// Return the exit code
+	return
+}
+
+// parseBackend returns the backend for the name given with the -backend flag.
+func parseBackend(name, dir string) (backend shm.Backend, err error) {
+	switch name {
+	case "sysv":
+		backend = shm.SysvBackend{}
+	case "posix":
+		backend = shm.PosixBackend{}
+	case "file":
+		backend = shm.FileBackend{Dir: dir}
+	default:
+		err = Error("unknown backend " + strconv.Quote(name))
+	}
+	return
+}
+
+// parseKey parses a key in decimal, or in hexadecimal with the 0x prefix.
+func parseKey(text string) (key int64, err error) {
+	key, err = strconv.ParseInt(text, 0, 64)
+	if err != nil {
+		err = Error("invalid key " + strconv.Quote(text))
+	}
+	return
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"github.com/panhongrainbow/filebasez/shm"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// filebasez runs the command line with the arguments, and returns the exit code and what was printed.
+func filebasez(args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(args, &out, &errOut)
+	stdout, stderr = out.String(), errOut.String()
+	return
+}
+
+// Test_Check_Command_Line checks the subcommands on in-process segments, and the usage errors.
+func Test_Check_Command_Line(t *testing.T) {
+	// The testShmKey is the shared memory key for testing, the segments are files in a directory of the test
+	var testShmKey int64 = 40
+	dir := t.TempDir()
+	backend := shm.FileBackend{Dir: dir}
+
+	// Create a speedy array and a raw segment
+	code, _, stderr := filebasez("-backend", "file", "-dir", dir, "create", "-type", "speedyArrayInt32", "-width", "2", "-mode", "0640", "-ttl", "1h", "40", "200") // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+	require.Equal(t, exitOK, code, stderr)
+	code, _, stderr = filebasez("-backend", "file", "-dir", dir, "create", "-ttl", "1h", "0x29", "200")
+	require.Equal(t, exitOK, code, stderr)
+
+	// Write some values into both segments
+	registry := shm.NewRegistry()
+	for _, key := range []int64{testShmKey, testShmKey + 1} {
+		err := registry.OpenShmWithOpts(shm.Vopts{Key: key, Backend: backend})
+		require.NoError(t, err)
+		sg, err := registry.Segment(key)
+		require.NoError(t, err)
+		err = sg.AppendInt32s(1, 2, 3, -4)
+		require.NoError(t, err)
+		err = registry.CloseShm(key)
+		require.NoError(t, err)
+	}
+
+	// info decodes the header
+	code, stdout, stderr := filebasez("-backend", "file", "-dir", dir, "info", "40")
+	require.Equal(t, exitOK, code, stderr)
+	require.Contains(t, stdout, "Status:   ok\n")
+	require.Contains(t, stdout, "Magic:    FBSZ\n")
+	require.Contains(t, stdout, "Type:     speedyArrayInt32\n")
+	require.Contains(t, stdout, "Width:    2\n")
+	require.Contains(t, stdout, "Key:      40 (0x28)\n")
+	require.Contains(t, stdout, "Offset:   112 (16 bytes used)\n")
+	require.Contains(t, stdout, "Mode:     -rw-r-----\n")
+	require.Contains(t, stdout, "TTL:      1h0m0s\n")
+
+	// dump prints rows of speedy arrays with the width in their header, and a hexdump of the other segments
+	code, stdout, stderr = filebasez("-backend", "file", "-dir", dir, "dump", "40")
+	require.Equal(t, exitOK, code, stderr)
+	require.Equal(t, "       0: 1 2\n       8: 3 -4\n", stdout)
+	code, _, _ = filebasez("-backend", "file", "-dir", dir, "dump", "-width", "3", "40")
+	require.Equal(t, exitUsage, code)
+	code, stdout, stderr = filebasez("-backend", "file", "-dir", dir, "dump", "41")
+	require.Equal(t, exitOK, code, stderr)
+	require.True(t, strings.HasPrefix(stdout, "00000000  01 00 00 00 02 00 00 00  03 00 00 00 fc ff ff ff"), stdout)
+
+	// info shows damaged headers, which can not be opened
+	file, err := os.OpenFile(filepath.Join(dir, "filebasez.41"), os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = file.WriteAt([]byte{7}, 44)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	code, stdout, stderr = filebasez("-backend", "file", "-dir", dir, "info", "41")
+	require.Equal(t, exitOK, code, stderr)
+	require.Contains(t, stdout, "Status:   "+shm.ErrShmHeaderCorrupted.Error()+"\n")
+	require.Contains(t, stdout, "Version:  2.")
+	code, _, _ = filebasez("-backend", "file", "-dir", dir, "dump", "41")
+	require.Equal(t, exitError, code)
+
+	// rm removes a chain with its links, every segment holds one value after the record of the chain
+	chain, err := shm.NewChain(shm.Vopts{Key: testShmKey + 2, Size: shm.DefualtMinShmSize + 16 + 4, Backend: backend})
+	require.NoError(t, err)
+	_, err = chain.AppendInt32s(1, 2, 3)
+	require.NoError(t, err)
+	require.NoError(t, chain.Close())
+	code, _, stderr = filebasez("-backend", "file", "-dir", dir, "rm", "42")
+	require.Equal(t, exitOK, code, stderr)
+
+	// rm removes the segments, also with damaged headers, and refuses segments of other programs
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "filebasez.43"), make([]byte, shm.DefualtMinShmSize), 0600))
+	code, _, stderr = filebasez("-backend", "file", "-dir", dir, "rm", "43")
+	require.Equal(t, exitError, code)
+	require.Contains(t, stderr, shm.ErrForeignShm.Error())
+	require.NoError(t, os.Remove(filepath.Join(dir, "filebasez.43")))
+	for _, key := range []string{"40", "41"} {
+		code, _, stderr = filebasez("-backend", "file", "-dir", dir, "rm", key)
+		require.Equal(t, exitOK, code, stderr)
+	}
+	code, _, stderr = filebasez("-backend", "file", "-dir", dir, "info", "40")
+	require.Equal(t, exitError, code)
+	require.Equal(t, "filebasez info: stat key 40: "+shm.ErrShmNotExist.Error()+": "+syscall.ENOENT.Error()+"\n", stderr)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 0)
+
+	// ls and gc read the System V segments of the host
+	code, stdout, stderr = filebasez("ls", "-filebasez")
+	require.Equal(t, exitOK, code, stderr)
+	require.True(t, strings.HasPrefix(stdout, "KEY"), stdout)
+	code, _, stderr = filebasez("gc", "-dry-run")
+	require.Equal(t, exitOK, code, stderr)
+
+	// Wrong arguments are usage errors
+	for _, args := range [][]string{
+		{},
+		{"unknown"},
+		{"-backend", "unknown", "ls"},
+		{"-backend", "memory", "ls"},
+		{"info"},
+		{"create", "-ttl", "1h", "42"},
+		{"create", "42", "200"},
+		{"create", "-ttl", "1h", "-type", "unknown", "42", "200"},
+		{"create", "-ttl", "1h", "-mode", "999", "42", "200"},
+		{"dump", "-width", "-1", "42"},
+		{"create", "-ttl", "1h", "-type", "speedyArrayInt32", "42", "200"},
+		{"create", "-ttl", "1h", "-width", "2", "42", "200"},
+	} {
+		code, _, _ = filebasez(args...)
+		require.Equal(t, exitUsage, code, args)
+	}
+}
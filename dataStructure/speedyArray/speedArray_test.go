@@ -244,3 +244,184 @@ func Test_Check_SpeedyArrayInt32_Unique(t *testing.T) {
 	require.Equal(t, []int32{secondUniqueElement, 21, 22, 23, 24, 25, 26, 27, 28}, raw, "raw is not equal to the expected value")
 	require.NoError(t, err)
 }
+
+/*
+Test_Check_SpeedyArrayInt32_File tests SpdArrayInt32 kept in a file.
+It appends some rows, closes the array as if the process restarted, and opens it again from the file.
+*/
+func Test_Check_SpeedyArrayInt32_File(t *testing.T) {
+	// The testShmKey is the shared memory key for testing
+	var testShmKey int64 = 22
+
+	// The opts is options for creating a new instance of SpdArrayInt32 kept in a file
+	opts := Opts{
+		// ShmKey represents the shared memory key
+		ShmKey: testShmKey,
+		// Width and Length represent the Width and Length of the array respectively
+		Width:  3,
+		Length: 10,
+		// Backend keeps the array in a file
+		Backend: shm.FileBackend{Dir: t.TempDir()},
+	}
+
+	// Create a new instance of SpdArrayInt32 with the given options
+	array, err := NewSpeedyArrayInt32(opts)
+	require.NoError(t, err, "create new speedy array failed")
+
+	// Append some rows and write them back to the file
+	err = array.AppendArrayInt32(20, 11, 12)
+	require.NoError(t, err)
+	err = array.AppendArrayInt32(50, 51, 52)
+	require.NoError(t, err)
+	err = array.AppendArrayInt32(20, 21, 22)
+	require.NoError(t, err)
+	err = array.Sync()
+	require.NoError(t, err)
+
+	// Close the array, as if the process restarted
+	err = CloseSpeedyArrayInt32(testShmKey)
+	require.NoError(t, err)
+
+	// Open the array again from the file
+	array, err = OpenSpeedyArrayInt32(opts)
+	require.NoError(t, err, "open speedy array failed")
+
+	// Delete the file with the given key
+	defer func() {
+		err := DeleteSpeedyArrayInt32(testShmKey)
+		require.NoError(t, err)
+	}()
+
+	// The header records that the segment holds a SpdArrayInt32, and the width of its rows
+	info, err := shm.InfoShm(testShmKey)
+	require.NoError(t, err)
+	require.Equal(t, int32(shm.TypeSpeedyArrayInt32), info.Type)
+	require.Equal(t, uint32(3), info.Width)
+
+	// The rows are found by their first element again
+	twoDimensionalArray, err := array.ReadRowInInt32ByFirstElement(20)
+	require.NoError(t, err)
+	require.Equal(t, [][]int32{{20, 11, 12}, {20, 21, 22}}, twoDimensionalArray, "twoDimensionalArray is not equal to the expected value")
+	twoDimensionalArray, err = array.ReadRowInInt32ByFirstElement(50)
+	require.NoError(t, err)
+	require.Equal(t, [][]int32{{50, 51, 52}}, twoDimensionalArray, "twoDimensionalArray is not equal to the expected value")
+
+	// New rows are appended after the rows written before the restart
+	err = array.AppendArrayInt32(70, 71, 72)
+	require.NoError(t, err)
+	raw, err := array.ReadRowInInt32ByShift(36)
+	require.NoError(t, err)
+	require.Equal(t, []int32{70, 71, 72}, raw, "raw is not equal to the expected value")
+}
+
+// Test_Check_SpeedyArrayInt32_Full checks that a row which does not fit in the array is not stored at all.
+func Test_Check_SpeedyArrayInt32_Full(t *testing.T) {
+	// The testShmKey is the shared memory key for testing
+	var testShmKey int64 = 49
+
+	// Create an array with room for one row
+	array, err := NewSpeedyArrayInt32(Opts{
+		ShmKey: testShmKey,
+		Width:  3,
+		Length: 1,
+	})
+	require.NoError(t, err, "create new speedy array failed")
+
+	// Delete the shared memory segment with the given key
+	defer func() {
+		err := DeleteSpeedyArrayInt32(testShmKey)
+		require.NoError(t, err)
+	}()
+
+	// The first row fills the array, the second one is refused without moving the offset
+	err = array.AppendArrayInt32(10, 11, 12)
+	require.NoError(t, err)
+	err = array.AppendArrayInt32(20, 21, 22)
+	require.ErrorIs(t, err, shm.ErrNotEnoughSpace) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+	shmOffset, err := shm.ReadOffset(testShmKey)
+	require.NoError(t, err, "read offset failed")
+	require.Equal(t, int64(shm.DefualtMinShmSize+12), shmOffset, "shm offset is not equal to the expected value")
+
+	// Only the first row can be found
+	twoDimensionalArray, err := array.ReadRowInInt32ByFirstElement(20)
+	require.NoError(t, err)
+	require.Len(t, twoDimensionalArray, 0)
+	twoDimensionalArray, err = array.ReadRowInInt32ByFirstElement(10)
+	require.NoError(t, err)
+	require.Equal(t, [][]int32{{10, 11, 12}}, twoDimensionalArray, "twoDimensionalArray is not equal to the expected value")
+}
+
+/*
+Test_Check_SpeedyArrayInt32_Chain tests SpdArrayInt32 kept in a chain.
+It appends more rows than one segment holds, closes the array and opens it again from the chain.
+*/
+func Test_Check_SpeedyArrayInt32_Chain(t *testing.T) {
+	// The testShmKey is the shared memory key for testing
+	var testShmKey int64 = 67
+
+	// The opts is options for creating a new instance of SpdArrayInt32 kept in a chain
+	opts := Opts{
+		// ShmKey represents the shared memory key
+		ShmKey: testShmKey,
+		// Width and Length represent the Width and Length of the array respectively
+		Width:  3,
+		Length: 10,
+		// RowsPerSegment keeps two rows in every segment of the chain
+		RowsPerSegment: 2,
+	}
+
+	// Create a new instance of SpdArrayInt32 with the given options
+	array, err := NewSpeedyArrayInt32(opts)
+	require.NoError(t, err, "create new speedy array failed")
+
+	// Append five rows, they need three segments
+	err = array.AppendArrayInt32(20, 11, 12) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+	require.NoError(t, err)
+	err = array.AppendArrayInt32(50, 51, 52)
+	require.NoError(t, err)
+	err = array.AppendArrayInt32(20, 21, 22)
+	require.NoError(t, err)
+	err = array.AppendArrayInt32(70, 71, 72)
+	require.NoError(t, err)
+	err = array.AppendArrayInt32(20, 31, 32)
+	require.NoError(t, err)
+	err = array.Unique(70, 73, 74)
+	require.NoError(t, err)
+	err = array.Sync()
+	require.NoError(t, err)
+
+	// The chain is not registered by key, so the array is closed with its method
+	err = CloseSpeedyArrayInt32(testShmKey)
+	require.ErrorIs(t, err, shm.ErrShmNotExist)
+	err = array.Close()
+	require.NoError(t, err)
+
+	// The segments must hold the rows of the options
+	_, err = OpenSpeedyArrayInt32(Opts{ShmKey: testShmKey, Width: 3, RowsPerSegment: 3})
+	require.ErrorIs(t, err, ErrRowsPerSegment)
+
+	// Open the array again from the chain
+	array, err = OpenSpeedyArrayInt32(opts)
+	require.NoError(t, err, "open speedy array failed")
+
+	// Delete the chain with all its segments
+	defer func() {
+		err := array.Delete()
+		require.NoError(t, err)
+	}()
+
+	// The rows are found by their first element again, across the segments
+	twoDimensionalArray, err := array.ReadRowInInt32ByFirstElement(20)
+	require.NoError(t, err)
+	require.Equal(t, [][]int32{{20, 11, 12}, {20, 21, 22}, {20, 31, 32}}, twoDimensionalArray, "twoDimensionalArray is not equal to the expected value")
+	twoDimensionalArray, err = array.ReadRowInInt32ByFirstElement(70)
+	require.NoError(t, err)
+	require.Equal(t, [][]int32{{70, 73, 74}}, twoDimensionalArray, "twoDimensionalArray is not equal to the expected value")
+
+	// New rows are appended after the rows written before
+	err = array.AppendArrayInt32(90, 91, 92)
+	require.NoError(t, err)
+	raw, err := array.ReadRowInInt32ByShift(60)
+	require.NoError(t, err)
+	require.Equal(t, []int32{90, 91, 92}, raw, "raw is not equal to the expected value")
+}
@@ -15,6 +15,7 @@ const (
 	ErrNotAlignWithMemory  = Error("not align with the memory size boundary")
 	ErrTruncateData        = Error("data is truncated")
 	ErrWasteMemorySpace    = Error("waste memory space")
+	ErrRowsPerSegment      = Error("chain segments do not hold the rows per segment of the options")
 )
 
 // Error Defines a new Error type as a string
@@ -25,10 +26,14 @@ func (e Error) Error() string {
 	return string(e)
 }
 
-// SpdArrayInt32 is a struct that contains a shiftMap and options.
+/*
+SpdArrayInt32 is a struct that contains a shiftMap and options.
+The array is kept in a single segment, or in a shm.Vchain when Opts.RowsPerSegment is set, so it can hold more rows than one segment.
+*/
 type SpdArrayInt32 struct {
 	shiftMap map[int32][]int64
 	opts     Opts
+	chain    *shm.Vchain // the chain keeping the rows, nil when they are kept in a single segment
 }
 
 // Opts contains options for SpeedyArrayInt32.
@@ -39,17 +44,50 @@ type Opts struct {
 	// Width and Length represent the Width and Length of the array respectively
 	Width  uint64
 	Length uint64
+
+	// Backend keeps the shared memory, shm.FileBackend keeps the array in a file which can be opened again after a restart
+	Backend shm.Backend
+
+	/*
+		RowsPerSegment keeps the array in a chain of segments holding this number of rows each, when it is not zero.
+		A chain grows by segments, so the array is not limited by the size of one segment, and Length is only used to size the shiftMap.
+		The chain is not registered by key, so the array is closed and deleted with its Close and Delete methods.
+	*/
+	RowsPerSegment uint64
 }
 
 // NewSpeedyArrayInt32 creates a new instance of SpdArrayInt32 with the given options.
 func NewSpeedyArrayInt32(opts Opts) (array SpdArrayInt32, err error) {
+	// create a chain whose segments hold whole rows, when the options ask for it
+	if opts.RowsPerSegment > 0 {
+		var chain *shm.Vchain
+		chain, err = shm.NewChain(shm.Vopts{
+			Key:     opts.ShmKey,
+			Size:    shm.ChainSegmentSize(int64(opts.RowsPerSegment*opts.Width) * 4),
+			Backend: opts.Backend,
+		})
+		if err != nil {
+			return
+		}
+		array = SpdArrayInt32{
+			shiftMap: make(map[int32][]int64, opts.Length),
+			opts:     opts,
+			chain:    chain,
+		}
+		return
+	}
+
 	// estimateSize calculates the estimated size of the shared memory based on the Width and Length of the array
 	estimateSize := shm.DefualtMinShmSize + (opts.Width*opts.Length)*4
 
 	// shmOts is an instance of Vopts with the given shared memory key and estimated size
 	shmOts := shm.Vopts{
-		Key:  opts.ShmKey,
-		Size: int64(estimateSize),
+		Key:     opts.ShmKey,
+		Size:    int64(estimateSize),
+		Backend: opts.Backend,
+		Type:    shm.TypeSpeedyArrayInt32,
+		Writes:  shm.WriteAllOrNothing, // a row is stored completely or not at all
+		Width:   uint32(opts.Width),    // recorded in the header, so the rows can be told apart without the options
 	}
 	// create a new shared memory with the given options
 	err = shm.NewShm(shmOts)
@@ -67,6 +105,124 @@ func NewSpeedyArrayInt32(opts Opts) (array SpdArrayInt32, err error) {
 	return
 }
 
+/*
+OpenSpeedyArrayInt32 opens an existing SpdArrayInt32 with the given options, such as an array kept by shm.FileBackend after a restart.
+The shiftMap is not shared, so it is rebuilt by reading the first element of every row written before the offset.
+*/
+func OpenSpeedyArrayInt32(opts Opts) (array SpdArrayInt32, err error) {
+	// open the chain when the array is kept in one
+	if opts.RowsPerSegment > 0 {
+		array, err = openChainArrayInt32(opts)
+		return
+	}
+
+	// open the existing shared memory with the given key and backend, it must hold a SpdArrayInt32
+	err = shm.OpenShmWithOpts(shm.Vopts{
+		Key:     opts.ShmKey,
+		Backend: opts.Backend,
+		Type:    shm.TypeSpeedyArrayInt32,
+		Writes:  shm.WriteAllOrNothing,
+	})
+	if err != nil {
+		return
+	}
+
+	// close the shared memory again when the shiftMap can not be rebuilt, so the key can be opened once more
+	defer func() {
+		if err != nil {
+			_ = shm.CloseShm(opts.ShmKey)
+			array = SpdArrayInt32{}
+		}
+	}()
+
+	// create a new instance of SpdArrayInt32 with the given options and an empty shiftMap
+	array = SpdArrayInt32{
+		shiftMap: make(map[int32][]int64, opts.Length),
+		opts:     opts,
+	}
+
+	// read the offset to find out how many rows were written
+	var shmOffset int64
+	shmOffset, err = shm.ReadOffset(opts.ShmKey)
+	if err != nil {
+		return
+	}
+
+	// rebuild the shiftMap from the first element of every row
+	rowSize := int64(opts.Width) * 4
+	firstElement := make([]int32, 1)
+	for shmShift := int64(0); rowSize > 0 && shm.DefualtMinShmSize+shmShift+rowSize <= shmOffset; shmShift += rowSize {
+		err = shm.ReadRowInInt32s(opts.ShmKey, shmShift, firstElement)
+		if err != nil {
+			return
+		}
+		array.shiftMap[firstElement[0]] = append(array.shiftMap[firstElement[0]], shmShift)
+	}
+
+	// return the opened instance of SpdArrayInt32 and the error value
+	return
+}
+
+/*
+openChainArrayInt32 opens an existing SpdArrayInt32 kept in a chain, see OpenSpeedyArrayInt32.
+The segments of the chain must hold RowsPerSegment rows each, so the rows are found where they were written.
+*/
+func openChainArrayInt32(opts Opts) (array SpdArrayInt32, err error) {
+	// open the chain with all its segments
+	chain, err := shm.OpenChain(shm.Vopts{Key: opts.ShmKey, Backend: opts.Backend})
+	if err != nil {
+		return
+	}
+
+	// close the chain again when the shiftMap can not be rebuilt
+	defer func() {
+		if err != nil {
+			_ = chain.Close()
+			array = SpdArrayInt32{}
+		}
+	}()
+
+	// the segments must hold the rows of the options
+	rowSize := int64(opts.Width) * 4
+	if chain.SegmentSize() != shm.ChainSegmentSize(int64(opts.RowsPerSegment)*rowSize) {
+		err = ErrRowsPerSegment
+		return
+	}
+
+	// create a new instance of SpdArrayInt32 with the given options and an empty shiftMap
+	array = SpdArrayInt32{
+		shiftMap: make(map[int32][]int64, opts.Length),
+		opts:     opts,
+		chain:    chain,
+	}
+
+	// rebuild the shiftMap from the first element of every row
+	var length int64
+	length, err = chain.Len()
+	if err != nil {
+		return
+	}
+	firstElement := make([]int32, 1)
+	for shmShift := int64(0); shmShift+rowSize <= length; shmShift += rowSize {
+		err = chain.ReadInt32s(shmShift, firstElement)
+		if err != nil {
+			return
+		}
+		array.shiftMap[firstElement[0]] = append(array.shiftMap[firstElement[0]], shmShift)
+	}
+
+	// return the opened instance of SpdArrayInt32 and the error value
+	return
+}
+
+// CloseSpeedyArrayInt32 detaches the shared memory segment with the given key, the data is kept and can be opened again
+func CloseSpeedyArrayInt32(shmKey int64) (err error) {
+	// close the shared memory segment with the given key
+	err = shm.CloseShm(shmKey)
+	// return any error that occurred
+	return
+}
+
 // DeleteSpeedyArrayInt32 deletes a shared memory segment with the given key
 func DeleteSpeedyArrayInt32(shmKey int64) (err error) {
 	// delete the shared memory segment with the given key
@@ -75,6 +231,30 @@ func DeleteSpeedyArrayInt32(shmKey int64) (err error) {
 	return
 }
 
+// Close detaches the array, kept in a single segment or in a chain, the data is kept and can be opened again
+func (array SpdArrayInt32) Close() (err error) {
+	// close the chain, or the shared memory segment with the key of the array
+	if array.chain != nil {
+		err = array.chain.Close()
+		return
+	}
+	err = CloseSpeedyArrayInt32(array.opts.ShmKey)
+	// return any error that occurred
+	return
+}
+
+// Delete deletes the array, kept in a single segment or in a chain
+func (array SpdArrayInt32) Delete() (err error) {
+	// delete the chain with all its segments, or the shared memory segment with the key of the array
+	if array.chain != nil {
+		err = array.chain.Delete()
+		return
+	}
+	err = DeleteSpeedyArrayInt32(array.opts.ShmKey)
+	// return any error that occurred
+	return
+}
+
 // AppendArrayInt32 appends int32 elements to a shared memory segment associated with a SpeedyArrayInt32 instance
 func (array SpdArrayInt32) AppendArrayInt32(elements ...int32) (err error) {
 	// check if there are any elements to append
@@ -93,24 +273,19 @@ func (array SpdArrayInt32) AppendArrayInt32(elements ...int32) (err error) {
 	// copy the given elements to the newElements slice
 	copy(newElements, elements)
 
-	// write the newElements to the shared memory segment with the given key
-	err = shm.AppendInt32s(array.opts.ShmKey, newElements...)
-	if err != nil {
-		return
+	// write the newElements to the chain or to the shared memory segment with the given key, and get the shift where they were written
+	var shmShift int64
+	if array.chain != nil {
+		shmShift, err = array.chain.AppendInt32s(newElements...)
+	} else {
+		shmShift, err = shm.AppendInt32sReturnShift(array.opts.ShmKey, newElements...)
 	}
-
-	// read the offset value for the given key
-	var shmOffset int64
-	shmOffset, err = shm.ReadOffset(array.opts.ShmKey)
 	if err != nil {
 		return
 	}
 
-	// calculate the new offset value
-	offset := shmOffset - int64(array.opts.Width*4)
-
-	// append the new offset value to the shiftMap for the first element
-	array.shiftMap[elements[0]] = append(array.shiftMap[elements[0]], offset-shm.DefualtMinShmSize)
+	// append the shift to the shiftMap for the first element
+	array.shiftMap[elements[0]] = append(array.shiftMap[elements[0]], shmShift)
 
 	// Check if the elements are truncated
 	if len(elements) > int(array.opts.Width) {
@@ -122,6 +297,16 @@ func (array SpdArrayInt32) AppendArrayInt32(elements ...int32) (err error) {
 	return
 }
 
+// Sync writes the array back to the disk when it is kept by a backend on a disk, such as shm.FileBackend.
+func (array SpdArrayInt32) Sync() (err error) {
+	if array.chain != nil {
+		err = array.chain.Sync()
+		return
+	}
+	err = shm.SyncShm(array.opts.ShmKey)
+	return
+}
+
 /*
 Unique overwrites a shared memory array with given elements
 and maintains the uniqueness of the first element in the whole array.
@@ -156,8 +341,12 @@ func (array SpdArrayInt32) Unique(elements ...int32) (err error) {
 			There should be only one offset value.
 		*/
 		shmShift := array.shiftMap[elements[0]][0]
-		// Overwrite the shared memory with the given elements
-		err = shm.OverwriteOrAppendInt32sByShift(array.opts.ShmKey, shm.DefualtMinShmSize+shmShift, false, elements...)
+		// Overwrite the chain or the shared memory with the given elements
+		if array.chain != nil {
+			err = array.chain.WriteInt32s(shmShift, elements...)
+		} else {
+			err = shm.OverwriteOrAppendInt32sByShift(array.opts.ShmKey, shm.DefualtMinShmSize+shmShift, false, elements...)
+		}
 		if err != nil {
 			// If first element is not unique, return ErrWasteMemorySpace
 			if len(array.shiftMap[elements[0]]) > 1 {
@@ -173,6 +362,10 @@ func (array SpdArrayInt32) Unique(elements ...int32) (err error) {
 // ReadRowInInt32ByShift obtains an int32 array from the shared memory space by an offset.
 func (array SpdArrayInt32) ReadRowInInt32ByShift(shmShift int64) (elements []int32, err error) {
 	elements = make([]int32, array.opts.Width)
+	if array.chain != nil {
+		err = array.chain.ReadInt32s(shmShift, elements)
+		return
+	}
 	err = shm.ReadRowInInt32s(array.opts.ShmKey, shmShift, elements)
 	return
 }
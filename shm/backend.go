@@ -0,0 +1,81 @@
+package shm
+
+import "os"
+
+/*
+Backend abstracts the operating system calls behind a segment, so that the segment handle,
+the header and the extension functions work the same way whatever kind of shared memory keeps the data.
+The backend of a segment is chosen with Vopts.Backend, and the default backend is used when it is nil.
+The default backend is SysvBackend, and it is MemoryBackend when the package is built without cgo or with the shm_memory build tag,
+which keeps unit tests hermetic and lets static binaries link.
+*/
+type Backend interface {
+	// Create creates a segment of the given size for the key and returns its id.
+	// The flag contains StatusIpcCreate and StatusIpcExclusive like shmget, and perm holds the permissions of the segment.
+	Create(key, size int64, flag VsysFlags, perm os.FileMode) (id int64, err error)
+
+	// Open resolves the id of an existing segment for the key without creating it, it returns ErrShmNotExist when there is none.
+	Open(key int64) (id int64, err error)
+
+	// Attach maps the whole segment into the memory of the process.
+	Attach(key, id, size int64) (mem []byte, err error)
+
+	// Detach unmaps the memory returned by Attach.
+	Detach(mem []byte) (err error)
+
+	// Stat returns the size of the segment.
+	Stat(key, id int64) (size int64, err error)
+
+	// Remove removes the segment, the memory which is still attached stays usable until it is detached.
+	Remove(key, id int64) (err error)
+}
+
+/*
+Replacer is implemented by the backends which can build a new segment for a key beside the current one and put it in place at once,
+like a file written under another name and renamed. MigrateWithOpts and GrowShm use it, so the current segment is only removed
+once the new one is complete, and an interrupted replacement leaves one of them under the key.
+The other backends can not keep two segments for a key, so the current one is removed first, and created again when the new one fails.
+*/
+type Replacer interface {
+	// Prepare creates a segment of the size for the key, which can not be opened yet, and returns its id and its attached memory.
+	Prepare(key, size int64, perm os.FileMode) (id int64, mem []byte, err error)
+
+	// Replace puts the prepared segment with the id in place of the segment of the key, which is removed.
+	// The memory attached to the removed segment stays usable until it is detached.
+	Replace(key, id int64) (err error)
+
+	// Discard removes a prepared segment which was not put in place.
+	Discard(key, id int64) (err error)
+}
+
+/*
+headerIder is implemented by the backends which record another id in the header of a segment than the id they give the segment,
+like FileBackend, whose files keep matching their header after they were copied or restored.
+*/
+type headerIder interface {
+	// headerId returns the id recorded in the header of the segment of the key with the id.
+	headerId(key, id int64) (headerId int64)
+}
+
+// headerId returns the id recorded in the header of the segment, which is its id unless the backend records another one.
+func (receive *Vsegment) headerId() (id int64) {
+	id = receive.id
+	if ider, ok := receive.backend.(headerIder); ok {
+		id = ider.headerId(receive.key, receive.id)
+	}
+	return
+}
+
+// error list for the backends
+const (
+	ErrBackendUnavailable = Error("shm backend is not available in this build")
+)
+
+// backendOrDefault returns the backend chosen in the options, or the default backend when none is chosen.
+func (opts Vopts) backendOrDefault() (backend Backend) {
+	backend = opts.Backend
+	if backend == nil {
+		backend = defaultBackend
+	}
+	return
+}
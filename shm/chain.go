@@ -0,0 +1,588 @@
+package shm
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+/*
+A single segment is limited by SHMMAX, so a chain keeps int32 values in a list of segments of the same size.
+The first segment is the head, it is created with the key of the chain, and the number of links following it
+is recorded at bytes 92:96 of its header. The key of every link is derived from the key of the chain, the index of the link and a salt,
+so every process finds the links from the head alone. Each segment has its own header, followed by the record of the chain:
+
+	 0:8   the key of the chain
+	 8:12  the index of the segment, the head has the index 0
+	12:16  the salt of the key of the next link
+
+Derived keys can be taken by other segments, so a link is created with the next salt while its key exists,
+and the salt is recorded in the segment before it, before the link is counted in the head.
+Opening a link checks its record, so a segment of another chain or of another program is never used as a link.
+A process which dies between creating a link and counting it leaves a link nobody can reach,
+so the next link created for the index, and Delete, remove the segments under the keys of the next index whose record names the chain.
+The data of every segment starts after the record.
+
+Positions in a chain are counted in bytes from the start of the data, like the shifts of the extension functions,
+and they are translated to a segment and a position in it. A segment is filled before the next link is created,
+so the length of the data is the data of the full segments plus the data of the last segment.
+Appends hold the lock of the head, so processes appending to the same chain take turns, and a new link is created only once.
+A chain is not registered, the Vchain handle returned by NewChain or OpenChain is used instead of the key.
+
+speedyArray.SpdArrayInt32 keeps its rows in a chain when its options ask for it, with segments holding whole rows,
+so a row is always written into one segment.
+*/
+type Vchain struct {
+	mu       sync.Mutex
+	key      int64
+	backend  Backend
+	linkSize int64       // size of every segment in the chain
+	links    []*Vsegment // the attached segments, the head first
+}
+
+// the record of the chain after the header of every segment
+const (
+	chainRecordSize = 8 + 4 + 4 // the key of the chain, the index of the segment and the salt of the next link
+	chainLinkSalts  = 16        // how many salts are tried for the key of a link
+)
+
+// error list for chains
+const (
+	ErrChainLinkSize  = Error("shm chain segment size must leave room for int32 values after the header and the record")
+	ErrChainLinkKey   = Error("shm chain can not find a free key for the next link")
+	ErrForeignLinkShm = Error("shm segment is not the link of the chain")
+)
+
+// linkCountWord returns the number of links in the header of the head for atomic operations.
+func (receive *Vchain) linkCountWord() (word *uint32) {
+	word = (*uint32)(unsafe.Pointer(&receive.links[0].mem[92]))
+	return
+}
+
+// nextSaltWord returns the salt of the key of the next link in the record of the segment for atomic operations.
+func nextSaltWord(link *Vsegment) (word *uint32) {
+	word = (*uint32)(unsafe.Pointer(&link.mem[DefualtMinShmSize+12]))
+	return
+}
+
+/*
+chainLinkKey derives the key of the link with the index and the salt, the head has the index 0 and the key of the chain.
+The first salt is 0, and the keys of the following salts are derived from names of their own.
+*/
+func chainLinkKey(key int64, index, salt int) (linkKey int64, err error) {
+	linkKey = key
+	if index > 0 {
+		name := "filebasez.chain." + strconv.FormatInt(key, 10) + "." + strconv.Itoa(index)
+		if salt > 0 {
+			name += "." + strconv.Itoa(salt)
+		}
+		linkKey, err = KeyFromName(name)
+	}
+	return
+}
+
+// ChainSegmentSize returns the size of the segments of a chain which hold the number of data bytes each, see NewChain.
+func ChainSegmentSize(capacity int64) (size int64) {
+	size = DefualtMinShmSize + chainRecordSize + capacity
+	return
+}
+
+// checkChainRecord checks that the segment is the segment with the index in the chain of the key, and of the size of its segments.
+func checkChainRecord(link *Vsegment, key int64, index int, size int64) (err error) {
+	// The record is only there when the segment has the size of the segments of the chain
+	if link.size != size || size < DefualtMinShmSize+chainRecordSize {
+		err = ErrForeignLinkShm
+		return
+	}
+
+	// Compare the key of the chain and the index
+	record := link.mem[DefualtMinShmSize : DefualtMinShmSize+chainRecordSize]
+	if int64(binary.LittleEndian.Uint64(record[0:8])) != key || binary.LittleEndian.Uint32(record[8:12]) != uint32(index) {
+		err = ErrForeignLinkShm
+	}
+
+	// Return the error value
+	return
+}
+
+/*
+NewChain creates the head of a chain for the key, opts.Size is the size of every segment in the chain, including its header.
+The data of a segment must be a multiple of 4 bytes, so int32 values never cross segments.
+*/
+func NewChain(opts Vopts) (chain *Vchain, err error) {
+	defer wrapError(&err, "NewChain", opts.Key, 0)
+
+	// Check if the key can be used and the segments can hold int32 values
+	err = checkKey(opts.Key)
+	if err != nil {
+		return
+	}
+	if opts.Size <= DefualtMinShmSize+chainRecordSize || (opts.Size-DefualtMinShmSize)%4 != 0 {
+		err = ErrChainLinkSize
+		return
+	}
+
+	// Create the head
+	opts.Type = TypeChain
+	head, err := newLink(opts, opts.Key, 0)
+	if err != nil {
+		return
+	}
+
+	// Return the chain
+	chain = &Vchain{
+		key:      opts.Key,
+		backend:  opts.Backend,
+		linkSize: head.size,
+		links:    []*Vsegment{head},
+	}
+	return
+}
+
+// OpenChain opens an existing chain for the key in the options, with the links created so far.
+func OpenChain(opts Vopts) (chain *Vchain, err error) {
+	defer wrapError(&err, "OpenChain", opts.Key, 0)
+
+	// Check if the key can be used
+	err = checkKey(opts.Key)
+	if err != nil {
+		return
+	}
+
+	// Open the head, it must be the head of a chain
+	head, err := openValidShm(Vopts{Key: opts.Key, Backend: opts.Backend, Type: TypeChain}, 0)
+	if err != nil {
+		return
+	}
+	err = checkChainRecord(head, opts.Key, 0, head.size)
+	if err != nil {
+		_ = head.Close()
+		return
+	}
+	chain = &Vchain{
+		key:      opts.Key,
+		backend:  opts.Backend,
+		linkSize: head.size,
+		links:    []*Vsegment{head},
+	}
+
+	// Open the links
+	err = chain.refresh()
+	if err != nil {
+		_ = chain.Close()
+		chain = nil
+	}
+
+	// Return the chain
+	return
+}
+
+// newLink creates the segment with the index in the chain of the key, and writes its record and its header.
+func newLink(opts Vopts, key int64, index int) (link *Vsegment, err error) {
+	// Create the segment
+	link, err = newWithReturnId(opts)
+	if err != nil {
+		return
+	}
+
+	// Write the record before the header, so it is complete once the segment can be opened, and the data starts after it
+	record := link.mem[DefualtMinShmSize : DefualtMinShmSize+chainRecordSize]
+	binary.LittleEndian.PutUint64(record[0:8], uint64(key))
+	binary.LittleEndian.PutUint32(record[8:12], uint32(index))
+	opts.reserved = chainRecordSize
+	err = link.initWithId(opts)
+	if err != nil {
+		_ = link.deleteWithId()
+		link = nil
+	}
+
+	// Return the segment
+	return
+}
+
+// refresh opens the links which other processes created since the chain was opened.
+func (receive *Vchain) refresh() (err error) {
+	count := int(atomic.LoadUint32(receive.linkCountWord()))
+	for len(receive.links) <= count {
+		// Derive the key of the next link with the salt recorded in the segment before it
+		index := len(receive.links)
+		salt := atomic.LoadUint32(nextSaltWord(receive.links[index-1]))
+		var key int64
+		key, err = chainLinkKey(receive.key, index, int(salt))
+		if err != nil {
+			return
+		}
+
+		// Open the link, its record must name this chain and the index
+		var link *Vsegment
+		link, err = openValidShm(Vopts{Key: key, Backend: receive.backend, Type: TypeChainLink}, headerWaitTimeout)
+		if err != nil {
+			return
+		}
+		err = checkChainRecord(link, receive.key, index, receive.linkSize)
+		if err != nil {
+			_ = link.Close()
+			return
+		}
+		receive.links = append(receive.links, link)
+	}
+
+	// Return the error value
+	return
+}
+
+// addLink creates the next link, the caller holds the lock of the head.
+func (receive *Vchain) addLink() (link *Vsegment, err error) {
+	// Create the link with the permissions of the head, with the next salt while the derived key is taken by another segment
+	head := receive.links[0]
+	index := len(receive.links)
+	salt := 0
+	for ; salt < chainLinkSalts; salt++ {
+		var key int64
+		key, err = chainLinkKey(receive.key, index, salt)
+		if err != nil {
+			return
+		}
+		link, err = newLink(Vopts{
+			Key:     key,
+			Size:    receive.linkSize,
+			Backend: receive.backend,
+			Type:    TypeChainLink,
+			Mode:    decodeInfo(head.mem[:DefualtMinShmSize]).Mode,
+		}, receive.key, index)
+		if !errors.Is(err, syscall.EEXIST) {
+			break
+		}
+
+		// The key may be taken by a link of this chain which was never counted, it is removed and the salt is used again
+		var removed bool
+		removed, err = receive.removeLostLink(key, index)
+		if err != nil {
+			return
+		}
+		if removed {
+			salt--
+		}
+	}
+	if salt == chainLinkSalts {
+		err = ErrChainLinkKey
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	// Record the salt in the segment before the link, and the link in the head, so other processes find it
+	atomic.StoreUint32(nextSaltWord(receive.links[index-1]), uint32(salt))
+	receive.links = append(receive.links, link)
+	atomic.StoreUint32(receive.linkCountWord(), uint32(len(receive.links)-1))
+
+	// Return the new link
+	return
+}
+
+/*
+removeLostLink removes the segment of the key when its record names the index in this chain,
+and the index is past the links counted in the head, so no process can reach it, the caller holds the lock of the head or deletes the chain.
+It tells whether a segment was removed, segments which can not be attached are left alone.
+*/
+func (receive *Vchain) removeLostLink(key int64, index int) (removed bool, err error) {
+	// Attach the segment without validating its header, which the dead process may not have finished
+	link, err := openShmWithKey(Vopts{Key: key, Backend: receive.backend})
+	if err != nil {
+		err = nil
+		return
+	}
+
+	// Keep the segments of others
+	if checkChainRecord(link, receive.key, index, receive.linkSize) != nil {
+		err = link.Close()
+		return
+	}
+
+	// Remove the lost link
+	err = link.deleteWithId()
+	removed = err == nil
+	return
+}
+
+// checkOpen checks that the chain has not been closed or deleted.
+func (receive *Vchain) checkOpen() (err error) {
+	if receive == nil {
+		err = ErrShmEmptyPoint
+		return
+	}
+	if len(receive.links) == 0 {
+		err = ErrShmNotAttached
+	}
+	return
+}
+
+// capacity returns the number of data bytes in every segment.
+func (receive *Vchain) capacity() (capacity int64) {
+	capacity = receive.linkSize - DefualtMinShmSize - chainRecordSize
+	return
+}
+
+// length returns the number of data bytes in the chain, from the links opened so far.
+func (receive *Vchain) length() (length int64) {
+	last := receive.links[len(receive.links)-1]
+	length = int64(len(receive.links)-1)*receive.capacity() + int64(atomic.LoadUint64(last.offsetWord())) - DefualtMinShmSize - chainRecordSize
+	return
+}
+
+// locate translates the position in the chain to a segment and the position in its attached memory.
+func (receive *Vchain) locate(shmShift int64) (link *Vsegment, position int64) {
+	link = receive.links[shmShift/receive.capacity()]
+	position = DefualtMinShmSize + chainRecordSize + shmShift%receive.capacity()
+	return
+}
+
+// SegmentSize returns the size of every segment in the chain, including its header and the record of the chain.
+func (receive *Vchain) SegmentSize() (size int64) {
+	size = receive.linkSize
+	return
+}
+
+// Len returns the number of data bytes in the chain, including the data appended by other processes.
+func (receive *Vchain) Len() (length int64, err error) {
+	defer receive.wrapError(&err, "Len")
+
+	receive.mu.Lock()
+	defer receive.mu.Unlock()
+
+	// Check that the chain is still open
+	err = receive.checkOpen()
+	if err != nil {
+		return
+	}
+
+	// Open the links created by other processes
+	err = receive.refresh()
+	if err != nil {
+		return
+	}
+
+	// Return the length
+	length = receive.length()
+	return
+}
+
+/*
+AppendInt32s appends the values at the end of the chain, creating links when the last segment is full,
+and returns the position where the values start.
+*/
+func (receive *Vchain) AppendInt32s(values ...int32) (shmShift int64, err error) {
+	defer receive.wrapError(&err, "AppendInt32s")
+
+	receive.mu.Lock()
+	defer receive.mu.Unlock()
+
+	// Check that the chain is still open
+	err = receive.checkOpen()
+	if err != nil {
+		return
+	}
+
+	// Hold the lock of the head, so other processes do not append or create links at the same time
+	head := receive.links[0]
+	err = head.acquire()
+	if err != nil {
+		return
+	}
+	defer head.release()
+	err = head.lockForWriting()
+	if err != nil {
+		return
+	}
+	defer func() {
+		err1 := head.unlock()
+		if err == nil {
+			err = err1
+		}
+	}()
+
+	// Open the links created by other processes, the values start at the end of the data
+	err = receive.refresh()
+	if err != nil {
+		return
+	}
+	shmShift = receive.length()
+
+	// Fill the last segment, and continue in a new link when it is full
+	for len(values) > 0 {
+		last := receive.links[len(receive.links)-1]
+		offset := int64(atomic.LoadUint64(last.offsetWord()))
+		if offset == last.size {
+			last, err = receive.addLink()
+			if err != nil {
+				return
+			}
+			offset = DefualtMinShmSize + chainRecordSize
+		}
+		count := (last.size - offset) / 4
+		if count > int64(len(values)) {
+			count = int64(len(values))
+		}
+		err = last.overwriteOrAppendData(offset, true, encodeScalars(values[:count]))
+		if err != nil {
+			return
+		}
+		values = values[count:]
+	}
+
+	// Return the position of the values
+	return
+}
+
+// ReadInt32s reads the values at the position in the chain, they must have been appended before.
+func (receive *Vchain) ReadInt32s(shmShift int64, values []int32) (err error) {
+	defer receive.wrapError(&err, "ReadInt32s")
+
+	err = receive.access(shmShift, values, func(mem []byte, i int) {
+		values[i] = int32(binary.LittleEndian.Uint32(mem))
+	})
+	return
+}
+
+// WriteInt32s overwrites the values at the position in the chain, they must have been appended before.
+func (receive *Vchain) WriteInt32s(shmShift int64, values ...int32) (err error) {
+	defer receive.wrapError(&err, "WriteInt32s")
+
+	err = receive.access(shmShift, values, func(mem []byte, i int) {
+		binary.LittleEndian.PutUint32(mem, uint32(values[i]))
+	})
+	return
+}
+
+// access calls the function with the memory of every value at the position in the chain, after checking that all the values were appended.
+func (receive *Vchain) access(shmShift int64, values []int32, function func(mem []byte, i int)) (err error) {
+	receive.mu.Lock()
+	defer receive.mu.Unlock()
+
+	// Check that the chain is still open
+	err = receive.checkOpen()
+	if err != nil {
+		return
+	}
+
+	// Values never cross segments, so the position must be aligned
+	if shmShift < 0 || shmShift%4 != 0 {
+		err = ErrShmOutOfRange
+		return
+	}
+
+	// Check that the values are within the data, opening the links created by other processes when they are not
+	end := shmShift + int64(len(values))*4
+	if end > receive.length() {
+		err = receive.refresh()
+		if err != nil {
+			return
+		}
+		if end > receive.length() {
+			err = ErrShmOutOfRange
+			return
+		}
+	}
+
+	// Visit the values one by one, they may be in different segments
+	for i := range values {
+		link, position := receive.locate(shmShift + int64(i)*4)
+		function(link.mem[position:position+4], i)
+	}
+
+	// Return the error value
+	return
+}
+
+// Sync writes every segment of the chain back to the disk, when it is kept by a backend on a disk, see Vsegment.Sync.
+func (receive *Vchain) Sync() (err error) {
+	defer receive.wrapError(&err, "Sync")
+
+	receive.mu.Lock()
+	defer receive.mu.Unlock()
+
+	// Check that the chain is still open
+	err = receive.checkOpen()
+	if err != nil {
+		return
+	}
+
+	// Write the segments back, the head last, so the links it counts are on the disk before it
+	for i := len(receive.links) - 1; i >= 0; i-- {
+		err = receive.links[i].Sync()
+		if err != nil {
+			return
+		}
+	}
+
+	// Return the error value
+	return
+}
+
+// Close detaches every segment of the chain, the chain is kept and can be opened again with OpenChain.
+func (receive *Vchain) Close() (err error) {
+	defer receive.wrapError(&err, "Close")
+
+	receive.mu.Lock()
+	defer receive.mu.Unlock()
+
+	// Detach the links, the head last
+	for i := len(receive.links) - 1; i >= 0; i-- {
+		if err1 := receive.links[i].Close(); err == nil {
+			err = err1
+		}
+	}
+	receive.links = nil
+
+	// Return the error value
+	return
+}
+
+// Delete removes every segment of the chain, including the links created by other processes.
+func (receive *Vchain) Delete() (err error) {
+	defer receive.wrapError(&err, "Delete")
+
+	receive.mu.Lock()
+	defer receive.mu.Unlock()
+
+	// Check that the chain is still open
+	err = receive.checkOpen()
+	if err != nil {
+		return
+	}
+
+	// Open the links created by other processes, so they are removed as well
+	err = receive.refresh()
+
+	// Remove a link after the last one which a dead process created but did not count
+	if err == nil {
+		index := len(receive.links)
+		for salt := 0; salt < chainLinkSalts; salt++ {
+			var key int64
+			key, err = chainLinkKey(receive.key, index, salt)
+			if err != nil {
+				break
+			}
+			_, err = receive.removeLostLink(key, index)
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	// Remove the links, the head last, so the chain can be found until all its links are gone
+	for i := len(receive.links) - 1; i >= 0; i-- {
+		if err1 := receive.links[i].deleteWithId(); err == nil {
+			err = err1
+		}
+	}
+	receive.links = nil
+
+	// Return the error value
+	return
+}
@@ -0,0 +1,170 @@
+package shm
+
+import (
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+// Test_Check_Shm_Chain_Function checks that values are spread over the segments of a chain and read back across their boundaries.
+func Test_Check_Shm_Chain_Function(t *testing.T) {
+	// The testShmKey is the shared memory key for testing
+	var testShmKey int64 = 45
+
+	// The data of every segment must hold whole int32 values
+	_, err := NewChain(Vopts{Key: testShmKey, Size: DefualtMinShmSize + chainRecordSize + 6})
+	require.ErrorIs(t, err, ErrChainLinkSize)
+	_, err = NewChain(Vopts{Key: testShmKey, Size: DefualtMinShmSize + chainRecordSize})
+	require.ErrorIs(t, err, ErrChainLinkSize)
+
+	// Create a chain whose segments hold 4 values each
+	chain, err := NewChain(Vopts{Key: testShmKey, Size: DefualtMinShmSize + chainRecordSize + 16})
+	require.NoError(t, err)
+
+	// Append 10 values, they need 3 segments
+	shmShift, err := chain.AppendInt32s(1, 2, 3, 4, 5, 6, 7, 8, 9, 10) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+	require.NoError(t, err)
+	require.Equal(t, int64(0), shmShift)
+	length, err := chain.Len()
+	require.NoError(t, err)
+	require.Equal(t, int64(40), length)
+	require.Len(t, chain.links, 3)
+
+	// Read values across the boundaries of the segments
+	values := make([]int32, 6)
+	err = chain.ReadInt32s(12, values)
+	require.NoError(t, err)
+	require.Equal(t, []int32{4, 5, 6, 7, 8, 9}, values)
+
+	// Another handle opens the chain with all its links, and appends to it
+	other, err := OpenChain(Vopts{Key: testShmKey})
+	require.NoError(t, err)
+	shmShift, err = other.AppendInt32s(11, 12, 13)
+	require.NoError(t, err)
+	require.Equal(t, int64(40), shmShift)
+	err = other.WriteInt32s(28, -8, -9)
+	require.NoError(t, err)
+	err = other.Close()
+	require.NoError(t, err)
+
+	// The first handle finds the new link and the changed values
+	values = make([]int32, 13)
+	err = chain.ReadInt32s(0, values)
+	require.NoError(t, err)
+	require.Equal(t, []int32{1, 2, 3, 4, 5, 6, 7, -8, -9, 10, 11, 12, 13}, values)
+	require.Len(t, chain.links, 4)
+
+	// Values which were never appended can not be read or written
+	err = chain.ReadInt32s(48, make([]int32, 2))
+	require.ErrorIs(t, err, ErrShmOutOfRange)
+	err = chain.WriteInt32s(2, 1)
+	require.ErrorIs(t, err, ErrShmOutOfRange)
+
+	// The links are segments of their own, which can not be opened as a chain
+	linkKey, err := chainLinkKey(testShmKey, 1, 0)
+	require.NoError(t, err)
+	_, err = OpenChain(Vopts{Key: linkKey})
+	require.ErrorIs(t, err, ErrShmTypeMismatch)
+	reader := NewRegistry()
+	err = reader.OpenShmWithOpts(Vopts{Key: linkKey, Type: TypeChainLink})
+	require.NoError(t, err)
+	err = reader.CloseShm(linkKey)
+	require.NoError(t, err)
+
+	// Deleting the chain removes all its segments
+	err = chain.Delete()
+	require.NoError(t, err)
+	err = reader.OpenShm(linkKey)
+	require.ErrorIs(t, err, ErrShmNotExist)
+	_, err = OpenChain(Vopts{Key: testShmKey})
+	require.ErrorIs(t, err, ErrShmNotExist)
+	_, err = chain.Len()
+	require.ErrorIs(t, err, ErrShmNotAttached)
+}
+
+// Test_Check_Shm_Chain_Link_Keys checks that links are created with another salt when their keys are taken, and that their records are checked.
+func Test_Check_Shm_Chain_Link_Keys(t *testing.T) {
+	// The testShmKey is the shared memory key for testing
+	var testShmKey int64 = 59
+	size := int64(DefualtMinShmSize + chainRecordSize + 8)
+
+	// Another chain holds the key of the first link already
+	linkKey, err := chainLinkKey(testShmKey, 1, 0)
+	require.NoError(t, err)
+	taken, err := newLink(Vopts{Key: linkKey, Size: size, Type: TypeChainLink}, testShmKey+1, 1)
+	require.NoError(t, err)
+	defer func() {
+		err1 := taken.deleteWithId()
+		require.NoError(t, err1)
+	}()
+
+	// The first link is created with the next salt
+	chain, err := NewChain(Vopts{Key: testShmKey, Size: size})
+	require.NoError(t, err)
+	defer func() {
+		err1 := chain.Delete()
+		require.NoError(t, err1)
+	}()
+	_, err = chain.AppendInt32s(1, 2, 3) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+	require.NoError(t, err)
+	saltedKey, err := chainLinkKey(testShmKey, 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, saltedKey, chain.links[1].key)
+	require.Equal(t, uint32(1), atomic.LoadUint32(nextSaltWord(chain.links[0])))
+
+	// Other handles find the link with the salt
+	other, err := OpenChain(Vopts{Key: testShmKey})
+	require.NoError(t, err)
+	values := make([]int32, 3)
+	err = other.ReadInt32s(0, values)
+	require.NoError(t, err)
+	require.Equal(t, []int32{1, 2, 3}, values)
+	err = other.Close()
+	require.NoError(t, err)
+
+	// The segment of the other chain is never opened as a link of this chain
+	atomic.StoreUint32(nextSaltWord(chain.links[0]), 0)
+	_, err = OpenChain(Vopts{Key: testShmKey})
+	require.ErrorIs(t, err, ErrForeignLinkShm)
+	atomic.StoreUint32(nextSaltWord(chain.links[0]), 1)
+}
+
+// Test_Check_Shm_Chain_Lost_Links checks that links created by a process which died before counting them are removed.
+func Test_Check_Shm_Chain_Lost_Links(t *testing.T) {
+	// The testShmKey is the shared memory key for testing
+	var testShmKey int64 = 66
+	size := int64(DefualtMinShmSize + chainRecordSize + 8)
+
+	// Create a chain with a full head
+	chain, err := NewChain(Vopts{Key: testShmKey, Size: size})
+	require.NoError(t, err)
+	_, err = chain.AppendInt32s(1, 2)
+	require.NoError(t, err)
+
+	// A process died after creating the first link, before counting it
+	linkKey, err := chainLinkKey(testShmKey, 1, 0)
+	require.NoError(t, err)
+	lost, err := newLink(Vopts{Key: linkKey, Size: size, Type: TypeChainLink}, testShmKey, 1)
+	require.NoError(t, err)
+	err = lost.Close()
+	require.NoError(t, err)
+
+	// The next link replaces the lost one under the same salt
+	_, err = chain.AppendInt32s(3) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+	require.NoError(t, err)
+	require.Equal(t, linkKey, chain.links[1].key)
+	require.Equal(t, uint32(0), atomic.LoadUint32(nextSaltWord(chain.links[0])))
+
+	// A lost link after the last one is removed with the chain
+	nextKey, err := chainLinkKey(testShmKey, 2, 0)
+	require.NoError(t, err)
+	lost, err = newLink(Vopts{Key: nextKey, Size: size, Type: TypeChainLink}, testShmKey, 2)
+	require.NoError(t, err)
+	err = lost.Close()
+	require.NoError(t, err)
+	err = chain.Delete()
+	require.NoError(t, err)
+	_, err = openShmWithKey(Vopts{Key: nextKey})
+	require.ErrorIs(t, err, syscall.ENOENT)
+}
@@ -0,0 +1,293 @@
+package shm
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// errors of the cursors
+const (
+	ErrCursorClosed     = Error("shm cursor is closed")
+	ErrInvalidWhence    = Error("invalid whence for seeking in shm")
+	ErrNegativePosition = Error("position in shm should not be negative")
+)
+
+/*
+Vcursor reads and writes the data of a segment like a file, so the segment can be used with bufio, encoding/binary, io.Copy or compress/gzip.
+It implements io.Reader, io.Writer, io.ReaderAt, io.WriterAt, io.Seeker and io.Closer over the data after the header,
+the position 0 is the first byte after the header, the same as the shift of ReadRowInInt32s.
+
+The data ends at the offset in the header. Reads stop there with io.EOF, and writes past it move the offset forward,
+as AppendInt32s does, so the data written through a cursor can be read with the other functions and the other way around.
+Writes hold the segment lock like OverwriteOrAppendInt32sByShift, and follow the write policy of the segment handle when the data does not fit.
+The lock is not reentrant, so writes return ErrShmLocked while it is held through Lock of the segment handle.
+
+Read, Write and Seek share the position of the cursor, so they must not be called at the same time,
+while ReadAt and WriteAt do not use it and can be called from many goroutines.
+Closing the cursor does not detach the segment, CloseShm does, and the cursor returns ErrShmNotAttached afterwards.
+*/
+type Vcursor struct {
+	segment  *Vsegment
+	position int64
+	closed   bool
+}
+
+// Cursor returns a new cursor at the beginning of the data of the segment.
+func (receive *Vsegment) Cursor() (cursor *Vcursor, err error) {
+	defer receive.wrapError(&err, "Cursor")
+
+	// Keep the segment attached while it is used
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+
+	// Return the cursor
+	cursor = &Vcursor{segment: receive}
+	return
+}
+
+// acquire checks that the cursor has not been closed, and keeps its segment attached until release is called.
+func (receive *Vcursor) acquire() (err error) {
+	if receive == nil {
+		err = ErrShmEmptyPoint
+		return
+	}
+	if receive.closed {
+		err = ErrCursorClosed
+		return
+	}
+	err = receive.segment.acquire()
+	return
+}
+
+// release gives back the segment taken by a successful acquire.
+func (receive *Vcursor) release() {
+	receive.segment.release()
+}
+
+// length returns the length of the data, which ends at the offset in the header.
+func (receive *Vcursor) length() (length int64) {
+	length = int64(atomic.LoadUint64(receive.segment.offsetWord())) - DefualtMinShmSize
+	return
+}
+
+// readAt copies the data at the position into p, and returns io.EOF when the data ends before p is full.
+func (receive *Vcursor) readAt(p []byte, position int64) (n int, err error) {
+	// Check if the cursor can be used and the position is valid
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+	if position < 0 {
+		err = ErrNegativePosition
+		return
+	}
+	if len(p) == 0 {
+		return
+	}
+
+	// Nothing is left after the end of the data
+	length := receive.length()
+	if position >= length {
+		err = io.EOF
+		return
+	}
+
+	// Create a cursor limited to the data of the attached memory, and read from it
+	vg := &Vsegment{
+		key:    receive.segment.key,
+		id:     receive.segment.id,
+		offset: DefualtMinShmSize + position,
+		size:   DefualtMinShmSize + length,
+		mem:    receive.segment.mem,
+	}
+	var count int64
+	count, err = vg.readWithId(p)
+	n = int(count)
+
+	// The data ended before p was full
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+
+	// Return the number of bytes read
+	return
+}
+
+// writeAt copies p into the data at the position with the segment lock held, and moves the offset forward when the data grows.
+func (receive *Vcursor) writeAt(p []byte, position int64) (n int, err error) {
+	// Check if the cursor can be used and the position is valid
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+	if position < 0 {
+		err = ErrNegativePosition
+		return
+	}
+	if len(p) == 0 {
+		return
+	}
+
+	// Hold the segment lock while writing
+	sg := receive.segment
+	err = sg.lockForOverwrite()
+	if err != nil {
+		return
+	}
+	defer func() {
+		err1 := sg.unlock()
+		if err == nil {
+			err = err1
+		}
+	}()
+
+	// GrowShm holds the lock while it copies the data, so a segment it replaced is seen here
+	if sg.moved() {
+		err = ErrShmMoved
+		return
+	}
+
+	// Under WriteAllOrNothing, check that all of p fits before writing any of it
+	start := DefualtMinShmSize + position
+	if sg.writes == WriteAllOrNothing && start+int64(len(p)) > sg.size {
+		err = ErrNotEnoughSpace
+		return
+	}
+
+	// Create a cursor over the attached memory, and write what fits, writeWithId reports the part which did not fit
+	vg := &Vsegment{
+		key:    sg.key,
+		id:     sg.id,
+		offset: start,
+		size:   sg.size,
+		mem:    sg.mem,
+	}
+	var count int64
+	count, err = vg.writeWithId(p)
+	n = int(count)
+
+	// Move the offset forward to the end of the written data, it is never moved back
+	if n > 0 {
+		sg.advanceWithId(vg.offset)
+	}
+
+	// Return the number of bytes written
+	return
+}
+
+// Read reads up to len(p) bytes at the position of the cursor and moves the position forward, it returns io.EOF at the end of the data.
+func (receive *Vcursor) Read(p []byte) (n int, err error) {
+	defer receive.wrapError(&err, "Read")
+
+	// Read at the position, io.Reader only expects io.EOF when nothing was read
+	n, err = receive.readAt(p, receive.position)
+	receive.position += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+
+	// Return the number of bytes read
+	return
+}
+
+// ReadAt reads len(p) bytes at the position off without moving the cursor, it returns io.EOF when the data ends before.
+func (receive *Vcursor) ReadAt(p []byte, off int64) (n int, err error) {
+	defer receive.wrapError(&err, "ReadAt")
+
+	n, err = receive.readAt(p, off)
+	return
+}
+
+// Write writes p at the position of the cursor and moves the position forward.
+func (receive *Vcursor) Write(p []byte) (n int, err error) {
+	defer receive.wrapError(&err, "Write")
+
+	n, err = receive.writeAt(p, receive.position)
+	receive.position += int64(n)
+	return
+}
+
+// WriteAt writes p at the position off without moving the cursor.
+func (receive *Vcursor) WriteAt(p []byte, off int64) (n int, err error) {
+	defer receive.wrapError(&err, "WriteAt")
+
+	n, err = receive.writeAt(p, off)
+	return
+}
+
+/*
+Seek sets the position of the cursor, relative to the beginning of the data, the current position or the end of the data
+for io.SeekStart, io.SeekCurrent and io.SeekEnd, and returns the new position.
+Positions after the end of the data are allowed, a write there fills the gap with the bytes already in the segment.
+*/
+func (receive *Vcursor) Seek(offset int64, whence int) (position int64, err error) {
+	defer receive.wrapError(&err, "Seek")
+
+	// Check if the cursor can be used
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+
+	// Find the position the offset is relative to
+	switch whence {
+	case io.SeekStart:
+		position = offset
+	case io.SeekCurrent:
+		position = receive.position + offset
+	case io.SeekEnd:
+		position = receive.length() + offset
+	default:
+		err = ErrInvalidWhence
+		return
+	}
+
+	// The position can not be before the data
+	if position < 0 {
+		position = receive.position
+		err = ErrNegativePosition
+		return
+	}
+
+	// Move the cursor
+	receive.position = position
+	return
+}
+
+// Close closes the cursor, the segment stays attached.
+func (receive *Vcursor) Close() (err error) {
+	defer receive.wrapError(&err, "Close")
+
+	// Check if the cursor can be used
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+
+	// Close the cursor
+	receive.closed = true
+	return
+}
+
+// CursorShm returns a new cursor at the beginning of the data of the segment identified by a key, see Vcursor.
+func CursorShm(key int64) (cursor *Vcursor, err error) {
+	// Find the attached segment for the given key
+	var sg *Vsegment
+	sg, err = defaultRegistry.Segment(key)
+	if err != nil {
+		return
+	}
+
+	// Create the cursor
+	cursor, err = sg.Cursor()
+
+	// Return the cursor
+	return
+}
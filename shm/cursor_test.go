@@ -0,0 +1,162 @@
+package shm
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Test_Check_Shm_Cursor checks that the cursors read and write the data of a segment through the io interfaces.
+func Test_Check_Shm_Cursor(t *testing.T) {
+	// The io helpers of the standard library work on the data
+	t.Run("io helpers", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 50
+
+		// Create the segment
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 4096, Backend: MemoryBackend{}})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+
+		// Write values with encoding/binary through bufio, the offset follows the data
+		cursor, err := CursorShm(testShmKey)
+		require.NoError(t, err)
+		writer := bufio.NewWriter(cursor)
+		err = binary.Write(writer, binary.LittleEndian, []int32{1, 2, 3}) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		require.NoError(t, err)
+		err = writer.Flush()
+		require.NoError(t, err)
+		offset, err := ReadOffset(testShmKey)
+		require.NoError(t, err)
+		require.Equal(t, int64(DefualtMinShmSize+12), offset)
+
+		// The values written through the cursor are the values of ReadRowInInt32s, and the other way around
+		values := make([]int32, 3)
+		err = ReadRowInInt32s(testShmKey, 0, values)
+		require.NoError(t, err)
+		require.Equal(t, []int32{1, 2, 3}, values)
+		err = AppendInt32s(testShmKey, 4)
+		require.NoError(t, err)
+		position, err := cursor.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+		require.Equal(t, int64(0), position)
+		read := make([]int32, 4)
+		err = binary.Read(cursor, binary.LittleEndian, read)
+		require.NoError(t, err)
+		require.Equal(t, []int32{1, 2, 3, 4}, read)
+
+		// The cursor stops at the end of the data
+		n, err := cursor.Read(make([]byte, 1))
+		require.Equal(t, 0, n)
+		require.Equal(t, io.EOF, err)
+
+		// io.Copy and compress/gzip write and read the data after the values
+		position, err = cursor.Seek(0, io.SeekEnd)
+		require.NoError(t, err)
+		require.Equal(t, int64(16), position)
+		text := strings.Repeat("filebasez ", 100)
+		compressor := gzip.NewWriter(cursor)
+		_, err = io.Copy(compressor, strings.NewReader(text))
+		require.NoError(t, err)
+		err = compressor.Close()
+		require.NoError(t, err)
+		reader, err := CursorShm(testShmKey)
+		require.NoError(t, err)
+		_, err = reader.Seek(16, io.SeekStart)
+		require.NoError(t, err)
+		decompressor, err := gzip.NewReader(reader)
+		require.NoError(t, err)
+		var out bytes.Buffer
+		_, err = io.Copy(&out, decompressor)
+		require.NoError(t, err)
+		require.Equal(t, text, out.String())
+
+		// A closed cursor can not be used, the segment stays attached
+		err = cursor.Close()
+		require.NoError(t, err)
+		_, err = cursor.Read(make([]byte, 1))
+		require.ErrorIs(t, err, ErrCursorClosed)
+		err = cursor.Close()
+		require.ErrorIs(t, err, ErrCursorClosed)
+		err = ReadRowInInt32s(testShmKey, 0, values)
+		require.NoError(t, err)
+	})
+
+	// ReadAt, WriteAt and Seek keep to the rules of the io interfaces
+	t.Run("positions", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 51
+
+		// Create a segment with room for 8 bytes of data
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 8, Backend: MemoryBackend{}})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		sg, err := Segment(testShmKey)
+		require.NoError(t, err)
+		cursor, err := sg.Cursor()
+		require.NoError(t, err)
+
+		// WriteAt does not move the cursor, and the data ends after the last byte written
+		n, err := cursor.WriteAt([]byte("bc"), 1)
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+		n, err = cursor.Write([]byte("a"))
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+		offset, err := sg.ReadOffset()
+		require.NoError(t, err)
+		require.Equal(t, int64(DefualtMinShmSize+3), offset)
+
+		// ReadAt returns io.EOF when the data ends before the buffer is full
+		p := make([]byte, 4)
+		n, err = cursor.ReadAt(p, 0)
+		require.Equal(t, io.EOF, err)
+		require.Equal(t, 3, n)
+		require.Equal(t, []byte("abc"), p[:n])
+		n, err = cursor.ReadAt(p[:2], 1)
+		require.NoError(t, err)
+		require.Equal(t, []byte("bc"), p[:n])
+
+		// Seeking before the data or with an unknown whence fails, and keeps the position
+		_, err = cursor.Seek(-1, io.SeekStart)
+		require.ErrorIs(t, err, ErrNegativePosition)
+		_, err = cursor.Seek(0, 3)
+		require.ErrorIs(t, err, ErrInvalidWhence)
+		position, err := cursor.Seek(0, io.SeekCurrent)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), position)
+
+		// A write which does not fit is cut at the end of the segment, unless the handle writes all or nothing
+		n, err = cursor.WriteAt([]byte("defgh!"), 3)
+		require.ErrorIs(t, err, ErrDataDevided)
+		require.Equal(t, 5, n)
+		strict := NewRegistry()
+		err = strict.OpenShmWithOpts(Vopts{Key: testShmKey, Backend: MemoryBackend{}, Writes: WriteAllOrNothing})
+		require.NoError(t, err)
+		defer func() {
+			err1 := strict.CloseShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		strictSg, err := strict.Segment(testShmKey)
+		require.NoError(t, err)
+		strictCursor, err := strictSg.Cursor()
+		require.NoError(t, err)
+		n, err = strictCursor.WriteAt([]byte("xy"), 7)
+		require.ErrorIs(t, err, ErrNotEnoughSpace)
+		require.Equal(t, 0, n)
+		n, err = strictCursor.ReadAt(p[:1], 7)
+		require.NoError(t, err)
+		require.Equal(t, []byte("h"), p[:n])
+	})
+}
@@ -0,0 +1,6 @@
+//go:build !cgo || shm_memory
+
+package shm
+
+// defaultBackend is the backend of the segments whose options do not choose one, System V needs cgo, so the segments are kept in the process
+var defaultBackend Backend = MemoryBackend{}
@@ -0,0 +1,6 @@
+//go:build cgo && !shm_memory
+
+package shm
+
+// defaultBackend is the backend of the segments whose options do not choose one
+var defaultBackend Backend = SysvBackend{}
@@ -0,0 +1,129 @@
+package shm
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"syscall"
+)
+
+/*
+OpError is the error returned by the exported functions of the package.
+It records the operation which failed, the key and the id of the segment, the errno of the system call if there was one,
+and the sentinel error of the package, such as ErrShmNotExist, if the failure has one.
+errors.Is matches both, so errors.Is(err, ErrShmNotExist) and errors.Is(err, syscall.ENOENT) are true for a missing segment.
+*/
+type OpError struct {
+	Op    string        // the operation, the name of the system call or of the exported function
+	Key   int64         // the key of the segment, 0 if unknown
+	Id    int64         // the id of the segment, 0 if unknown
+	Errno syscall.Errno // the errno of the system call, 0 if the failure did not come from the kernel
+	Err   error         // the sentinel error of the package, nil if there is only the errno
+}
+
+// Error formats the operation, the key, the id, the sentinel error and the errno.
+func (e *OpError) Error() (message string) {
+	// Start with the operation and the segment
+	message = e.Op
+	if e.Key != 0 {
+		message += " key " + strconv.FormatInt(e.Key, 10)
+	}
+	if e.Id != 0 {
+		message += " id " + strconv.FormatInt(e.Id, 10)
+	}
+
+	// Add the causes
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	if e.Errno != 0 {
+		message += ": " + e.Errno.Error()
+	}
+
+	// Return the message
+	return
+}
+
+// Unwrap returns the sentinel error, or the errno when there is no sentinel error.
+func (e *OpError) Unwrap() (err error) {
+	err = e.Err
+	if err == nil && e.Errno != 0 {
+		err = e.Errno
+	}
+	return
+}
+
+// Is reports whether the target is the sentinel error or the errno of the failure.
+func (e *OpError) Is(target error) (match bool) {
+	match = e.Errno != 0 && errors.Is(e.Errno, target)
+	return
+}
+
+// opError creates the error of a failed operation, the cause is kept as the errno when it is one, otherwise as the error.
+func opError(op string, key, id int64, cause, sentinel error) (err *OpError) {
+	err = &OpError{Op: op, Key: key, Id: id, Err: sentinel}
+	var errno syscall.Errno
+	switch {
+	case errors.As(cause, &errno):
+		err.Errno = errno
+	case err.Err == nil:
+		err.Err = cause
+	}
+	return
+}
+
+// wrapError turns the error returned by an exported function into an *OpError, errors which already are one are kept.
+func wrapError(err *error, op string, key, id int64) {
+	// Nothing failed
+	if *err == nil {
+		return
+	}
+
+	// Keep the operation, the key and the id of the first failure
+	var opErr *OpError
+	if errors.As(*err, &opErr) {
+		return
+	}
+
+	// Record where the error came from
+	*err = opError(op, key, id, *err, nil)
+}
+
+// wrapError is the wrapError of the methods of the segment, which records the key and the id of the segment.
+func (receive *Vsegment) wrapError(err *error, op string) {
+	var key, id int64
+	if receive != nil {
+		key, id = receive.key, receive.id
+	}
+	wrapError(err, op, key, id)
+}
+
+// wrapError is the wrapError of the methods of the chain, which records the key of the chain.
+func (receive *Vchain) wrapError(err *error, op string) {
+	var key int64
+	if receive != nil {
+		key = receive.key
+	}
+	wrapError(err, op, key, 0)
+}
+
+// wrapError is the wrapError of the methods of the cursor, io.EOF is returned as it is, since the io interfaces compare it directly.
+func (receive *Vcursor) wrapError(err *error, op string) {
+	if *err == io.EOF {
+		return
+	}
+	var segment *Vsegment
+	if receive != nil {
+		segment = receive.segment
+	}
+	segment.wrapError(err, op)
+}
+
+// wrapError is the wrapError of the methods of the view, which records the key and the id of the segment.
+func (receive *Vview) wrapError(err *error, op string) {
+	var key, id int64
+	if receive != nil {
+		key, id = receive.key, receive.id
+	}
+	wrapError(err, op, key, id)
+}
@@ -0,0 +1,80 @@
+package shm
+
+import (
+	"errors"
+	"github.com/stretchr/testify/require"
+	"syscall"
+	"testing"
+)
+
+// Test_Check_Shm_Errors checks that the errors carry the operation, the key, the id and the errno, and match both the sentinel errors and the errnos.
+func Test_Check_Shm_Errors(t *testing.T) {
+	// The failures of the backend keep the errno of the system call
+	t.Run("errno of the backend", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 46
+
+		// Create the segment with the default backend
+		opts := Vopts{Key: testShmKey, Size: DefualtMinShmSize + 16}
+		err := NewShm(opts)
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+
+		// The same key can not be created twice
+		err = NewRegistry().NewShm(opts)
+		require.ErrorIs(t, err, syscall.EEXIST) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		var opErr *OpError
+		require.True(t, errors.As(err, &opErr))
+		require.Equal(t, testShmKey, opErr.Key)
+		require.Equal(t, syscall.EEXIST, opErr.Errno)
+
+		// A missing segment matches the sentinel error and ENOENT
+		err = NewRegistry().OpenShm(testShmKey + 1)
+		require.ErrorIs(t, err, ErrShmNotExist)
+		require.ErrorIs(t, err, syscall.ENOENT)
+		require.True(t, errors.As(err, &opErr))
+		require.Equal(t, testShmKey+1, opErr.Key)
+	})
+
+	// The failures of the package record the method and the segment
+	t.Run("sentinel errors of the methods", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 47
+
+		// Create the segment
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 16, Backend: MemoryBackend{}})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		sg, err := Segment(testShmKey)
+		require.NoError(t, err)
+
+		// Reading beyond the data fails with the sentinel error and the id of the segment
+		err = ReadRowInInt32s(testShmKey, 4, make([]int32, 1))
+		require.ErrorIs(t, err, ErrShmReadingBeyond)
+		var opErr *OpError
+		require.True(t, errors.As(err, &opErr))
+		require.Equal(t, OpError{Op: "ReadRowInInt32s", Key: testShmKey, Id: sg.id, Err: ErrShmReadingBeyond}, *opErr)
+		require.False(t, errors.Is(err, syscall.ENOENT))
+
+		// Keys which were never registered are reported with the key
+		err = CloseShm(testShmKey + 1)
+		require.ErrorIs(t, err, ErrShmNotExist)
+	})
+
+	// The message names the operation, the segment and both causes
+	t.Run("error messages", func(t *testing.T) {
+		err := &OpError{Op: "shmget", Key: 48, Errno: syscall.EACCES}
+		require.Equal(t, "shmget key 48: "+syscall.EACCES.Error(), err.Error())
+		require.ErrorIs(t, err, syscall.EACCES)
+		err = &OpError{Op: "open", Key: 48, Id: 7, Errno: syscall.ENOENT, Err: ErrShmNotExist}
+		require.Equal(t, "open key 48 id 7: shm not exist: "+syscall.ENOENT.Error(), err.Error())
+		require.ErrorIs(t, err, ErrShmNotExist)
+		require.ErrorIs(t, err, syscall.ENOENT)
+	})
+}
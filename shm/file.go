@@ -0,0 +1,107 @@
+package shm
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+/*
+FileBackend keeps the segments in regular files under Dir, mapped with mmap and MAP_SHARED,
+so the data survives reboots and can be opened again with OpenShmWithOpts after a restart.
+The file of a key is named "filebasez.<key>" and starts with the same header NewShm writes for every backend.
+The kernel writes the changes back to the file by itself, Sync forces it when the data has to be durable at a given point.
+The id of a segment is the inode number of its file, so a handle never removes a file which replaced its own, like PosixBackend.
+The header records the key as the id instead, so a file which was copied or restored from a backup still matches its header.
+*/
+type FileBackend struct {
+	// Dir is the directory of the files, the current directory is used when it is empty
+	Dir string
+}
+
+// Syncer is implemented by the backends whose segments can be flushed to a disk, Vsegment.Sync uses it.
+type Syncer interface {
+	// Sync writes the changes of the attached memory back to the disk and waits until they are written.
+	Sync(mem []byte) (err error)
+}
+
+// mapped returns the mapped file implementation under the directory.
+func (receive FileBackend) mapped() (file mappedFile) {
+	file = mappedFile{dir: receive.Dir}
+	return
+}
+
+// headerId returns the key as the id recorded in the header, the inode number changes when the file is copied, see headerIder.
+func (receive FileBackend) headerId(key, id int64) (headerId int64) {
+	headerId = key
+	return
+}
+
+// Create creates the file of the segment and grows it to the size with ftruncate.
+func (receive FileBackend) Create(key, size int64, flag VsysFlags, perm os.FileMode) (id int64, err error) {
+	id, err = receive.mapped().create(key, size, flag, perm)
+	return
+}
+
+// Open checks that the file of the segment exists.
+func (receive FileBackend) Open(key int64) (id int64, err error) {
+	id, err = receive.mapped().open(key)
+	return
+}
+
+// Attach maps the file of the segment with mmap and MAP_SHARED, so every process mapping it sees the same memory.
+func (receive FileBackend) Attach(key, id, size int64) (mem []byte, err error) {
+	mem, err = receive.mapped().attach(key, id, size)
+	return
+}
+
+// AttachReadOnly maps the file of the segment with mmap and MAP_SHARED for reading only.
+func (receive FileBackend) AttachReadOnly(key, id, size int64) (mem []byte, err error) {
+	mem, err = receive.mapped().attachReadOnly(key, id, size)
+	return
+}
+
+// Detach unmaps the memory with munmap, the changes which are not written back yet are still written by the kernel.
+func (receive FileBackend) Detach(mem []byte) (err error) {
+	err = receive.mapped().detach(mem)
+	return
+}
+
+// Stat retrieves the size of the file of the segment.
+func (receive FileBackend) Stat(key, id int64) (size int64, err error) {
+	size, err = receive.mapped().stat(key, id)
+	return
+}
+
+// Remove deletes the file of the segment, the memory is freed after the last mapping is removed.
+func (receive FileBackend) Remove(key, id int64) (err error) {
+	err = receive.mapped().remove(key, id)
+	return
+}
+
+// Prepare creates the file "filebasez.<key>.new" of the size and maps it, see Replacer.
+func (receive FileBackend) Prepare(key, size int64, perm os.FileMode) (id int64, mem []byte, err error) {
+	id, mem, err = receive.mapped().prepare(key, size, perm)
+	return
+}
+
+// Replace renames the prepared file over the file of the segment, and syncs the directory.
+func (receive FileBackend) Replace(key, id int64) (err error) {
+	err = receive.mapped().replace(key, id)
+	return
+}
+
+// Discard deletes the prepared file.
+func (receive FileBackend) Discard(key, id int64) (err error) {
+	err = receive.mapped().discard(key, id)
+	return
+}
+
+// Sync writes the changes of the attached memory back to the file with msync and MS_SYNC.
+func (receive FileBackend) Sync(mem []byte) (err error) {
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&mem[0])), uintptr(len(mem)), syscall.MS_SYNC)
+	if errno != 0 {
+		err = opError("msync", 0, 0, errno, nil)
+	}
+	return
+}
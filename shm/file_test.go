@@ -0,0 +1,92 @@
+package shm
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// Test_Check_Shm_File_Backend checks segments kept in regular files, including Sync and opening them again.
+func Test_Check_Shm_File_Backend(t *testing.T) {
+	// The testShmKey is the shared memory key for testing
+	var testShmKey int64 = 19
+
+	// Create a new file-backed segment with Key=testShmKey and Size=DefualtMinShmSize+16
+	backend := FileBackend{Dir: t.TempDir()}
+	opts := Vopts{
+		Key:     testShmKey,
+		Size:    DefualtMinShmSize + 16,
+		Backend: backend,
+	}
+	err := NewShm(opts)
+	require.NoError(t, err)
+
+	// Append values and write them back to the file
+	err = AppendInt32s(testShmKey, 1, 2, 3)
+	require.NoError(t, err)
+	err = SyncShm(testShmKey) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+	require.NoError(t, err)
+
+	// The file holds the same header and data as the attached memory
+	path := filepath.Join(backend.Dir, "filebasez.19")
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Len(t, raw, DefualtMinShmSize+16)
+	require.Equal(t, ShmMagic, string(raw[0:4]))
+	require.Equal(t, MajorVersion, binary.LittleEndian.Uint16(raw[4:6]))
+	require.Equal(t, uint64(DefualtMinShmSize+12), binary.LittleEndian.Uint64(raw[56:64]))
+	require.Equal(t, []byte{1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0}, raw[DefualtMinShmSize:DefualtMinShmSize+12])
+
+	// Close the segment, as if the process restarted, and open the file again
+	err = CloseShm(testShmKey)
+	require.NoError(t, err)
+	err = OpenShmWithOpts(Vopts{Key: testShmKey, Backend: backend})
+	require.NoError(t, err)
+
+	// The id of the segment is the inode number of the file, the header records the key instead
+	stat, err := os.Stat(path)
+	require.NoError(t, err)
+	sg, err := Segment(testShmKey)
+	require.NoError(t, err)
+	require.Equal(t, int64(stat.Sys().(*syscall.Stat_t).Ino), sg.id)
+	info, err := InfoShm(testShmKey)
+	require.NoError(t, err)
+	require.Equal(t, testShmKey, info.Id)
+	values := make([]int32, 3)
+	err = ReadRowInInt32s(testShmKey, 0, values)
+	require.NoError(t, err)
+	require.Equal(t, []int32{1, 2, 3}, values)
+	err = CloseShm(testShmKey)
+	require.NoError(t, err)
+
+	// A copy of the file in another directory can be opened as well
+	restored := FileBackend{Dir: t.TempDir()}
+	err = os.WriteFile(filepath.Join(restored.Dir, "filebasez.19"), raw, 0600)
+	require.NoError(t, err)
+	reader := NewRegistry()
+	err = reader.OpenShmWithOpts(Vopts{Key: testShmKey, Backend: restored})
+	require.NoError(t, err)
+	err = reader.DeleteShm(testShmKey)
+	require.NoError(t, err)
+
+	// Segments kept in memory have nothing to write back
+	err = NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize})
+	require.NoError(t, err)
+	err = SyncShm(testShmKey)
+	require.NoError(t, err)
+	err = DeleteShm(testShmKey)
+	require.NoError(t, err)
+
+	// Deleting the file-backed segment removes the file
+	err = OpenShmWithOpts(Vopts{Key: testShmKey, Backend: backend})
+	require.NoError(t, err)
+	err = DeleteShm(testShmKey)
+	require.NoError(t, err)
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+	err = OpenShmWithOpts(Vopts{Key: testShmKey, Backend: backend})
+	require.ErrorIs(t, err, ErrShmNotExist)
+}
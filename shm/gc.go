@@ -0,0 +1,82 @@
+package shm
+
+import "time"
+
+/*
+Segments are only removed by DeleteShm, so a process which crashes, or a test which panics before its deferred DeleteShm,
+leaves its segments behind until the host reboots. GcShm finds and removes such orphaned segments.
+A filebasez segment is orphaned when no process is attached to it, and either the time to live recorded in its header has passed,
+or it has no time to live and the process which created it is gone.
+A segment created with a time to live is meant to outlive its creator, so it is kept until the time to live passes.
+The creator PID is only meaningful in the PID namespace of the creator, so run GcShm in the same namespace as the services.
+*/
+
+// VgcOpts contains the options of GcShm
+type VgcOpts struct {
+	DryRun bool // only report the orphaned segments, without removing them
+}
+
+/*
+GcShm removes the orphaned filebasez segments of the host with IPC_RMID, and returns them.
+Only the segments of the effective user are recognized, see ListShm, so run it as the user of the services.
+Every segment is checked for attachments again right before it is removed, so a process which just attached it keeps it.
+With DryRun, the segments which would be removed are returned, and nothing is removed.
+*/
+func GcShm(opts VgcOpts) (collected []Ventry, err error) {
+	defer wrapError(&err, "GcShm", 0, 0)
+
+	// List the segments of the host with their headers
+	var entries []Ventry
+	entries, err = ListShm()
+	if err != nil {
+		return
+	}
+
+	// Find the orphaned segments
+	now := time.Now()
+	for _, entry := range entries {
+		if !entry.orphaned(now) {
+			continue
+		}
+
+		// Only report the segment in a dry run
+		if opts.DryRun {
+			collected = append(collected, entry)
+			continue
+		}
+
+		// Skip the segment when a process attached it since it was listed, or it is already gone
+		stat, err1 := SysvBackend{}.KernelStat(entry.Key, entry.Id)
+		if err1 != nil || stat.Attaches != 0 || stat.Removed {
+			continue
+		}
+
+		// Remove the segment
+		err = SysvBackend{}.Remove(entry.Key, entry.Id)
+		if err != nil {
+			return
+		}
+		collected = append(collected, entry)
+	}
+
+	// Return the collected segments
+	return
+}
+
+// orphaned tells if the segment is a filebasez segment which nobody uses anymore at the time now.
+func (receive Ventry) orphaned(now time.Time) (orphaned bool) {
+	// Only filebasez segments without attachments are collected, and segments being destroyed are already taken care of
+	if !receive.Filebasez || receive.Attaches != 0 || receive.Removed {
+		return
+	}
+
+	// A segment with a time to live is kept until it has passed, also when its creator is gone
+	if receive.TTL > 0 && !receive.Created.IsZero() {
+		orphaned = now.After(receive.Created.Add(receive.TTL))
+		return
+	}
+
+	// The process which created the segment is gone, an unknown creator is never considered gone
+	orphaned = receive.CreatorPid > 0 && !processAlive(uint32(receive.CreatorPid))
+	return
+}
@@ -0,0 +1,116 @@
+package shm
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/require"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// Test_Check_Shm_Gc_Function checks that orphaned segments are found and removed, and that the others are kept.
+func Test_Check_Shm_Gc_Function(t *testing.T) {
+	// Orphaned segments are detected from their attachments, their creator and their time to live
+	t.Run("detect orphans", func(t *testing.T) {
+		// Find the PID of a process which is gone
+		cmd := exec.Command("true")
+		err := cmd.Run()
+		require.NoError(t, err)
+		dead := cmd.Process.Pid
+
+		now := time.Now()
+		alive := Ventry{Filebasez: true, CreatorPid: os.Getpid()}
+		require.False(t, alive.orphaned(now))
+
+		// The creator is gone
+		orphan := alive
+		orphan.CreatorPid = dead
+		require.True(t, orphan.orphaned(now)) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+
+		// The time to live has passed
+		expired := alive
+		expired.Created = now.Add(-2 * time.Minute)
+		expired.TTL = time.Minute
+		require.True(t, expired.orphaned(now))
+		expired.TTL = time.Hour
+		require.False(t, expired.orphaned(now))
+
+		// A segment with a time to live outlives its creator until the time to live has passed
+		lasting := expired
+		lasting.CreatorPid = dead
+		require.False(t, lasting.orphaned(now))
+		lasting.TTL = time.Minute
+		require.True(t, lasting.orphaned(now))
+
+		// Segments in use, segments being destroyed and segments of other programs are never collected
+		attached := orphan
+		attached.Attaches = 1
+		require.False(t, attached.orphaned(now))
+		removed := orphan
+		removed.Removed = true
+		require.False(t, removed.orphaned(now))
+		foreign := orphan
+		foreign.Filebasez = false
+		require.False(t, foreign.orphaned(now))
+	})
+
+	// Only System V segments are listed by the kernel
+	if _, ok := defaultBackend.(SysvBackend); !ok {
+		return
+	}
+
+	// Expired segments are removed, unless it is a dry run
+	t.Run("collect the host", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 36
+
+		// Create an expired segment and a segment which lives forever, and detach both
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize, TTL: time.Minute})
+		require.NoError(t, err)
+		sg, err := Segment(testShmKey)
+		require.NoError(t, err)
+		binary.LittleEndian.PutUint64(sg.mem[64:72], uint64(time.Now().Add(-2*time.Minute).Unix()))
+		info, err := InfoShm(testShmKey)
+		require.NoError(t, err)
+		require.Equal(t, time.Minute, info.TTL)
+		err = CloseShm(testShmKey)
+		require.NoError(t, err)
+		err = NewShm(Vopts{Key: testShmKey + 1, Size: DefualtMinShmSize})
+		require.NoError(t, err)
+		err = CloseShm(testShmKey + 1)
+		require.NoError(t, err)
+		defer func() {
+			err1 := OpenShm(testShmKey + 1)
+			require.NoError(t, err1)
+			err1 = DeleteShm(testShmKey + 1)
+			require.NoError(t, err1)
+		}()
+
+		// collected tells if the segment for the key is in the collected segments
+		collected := func(entries []Ventry, key int64) bool {
+			for _, entry := range entries {
+				if entry.Key == key {
+					return true
+				}
+			}
+			return false
+		}
+
+		// A dry run only reports the expired segment
+		entries, err := GcShm(VgcOpts{DryRun: true})
+		require.NoError(t, err)
+		require.True(t, collected(entries, testShmKey))
+		require.False(t, collected(entries, testShmKey+1))
+		_, err = StatShm(testShmKey)
+		require.NoError(t, err)
+
+		// The expired segment is removed, the other one is kept
+		entries, err = GcShm(VgcOpts{})
+		require.NoError(t, err)
+		require.True(t, collected(entries, testShmKey))
+		require.False(t, collected(entries, testShmKey+1))
+		err = OpenShm(testShmKey)
+		require.ErrorIs(t, err, ErrShmNotExist)
+	})
+}
@@ -0,0 +1,347 @@
+package shm
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+/*
+A segment can not be resized, so GrowShm replaces it with a larger one under the same key, like realloc:
+
+ 1. It holds the segment lock, so OverwriteOrAppendInt32sByShift and other lock holders wait.
+ 2. It seals the segment, so no append starts, and waits for the appends in flight to finish.
+ 3. It copies the header and the data into the larger segment, and updates the id, the size and the checksum in the new header.
+    Backends which implement Replacer build the new segment beside the old one and put it in place at once,
+    the other backends remove the old segment first, which stays attached, and create the new one for the key.
+ 4. It writes a forwarding record into the old header, with the id of the new segment, and marks the old segment as moved.
+
+The word at bytes 88:92 of the header holds the moved state: bit 0 is set once the segment is replaced,
+bit 31 while GrowShm seals it, and the bits between count the appends in flight.
+Appends count themselves there before they reserve their space, and wait while the segment is sealed,
+so they either land in the old segment before it is copied, or fail with ErrShmMoved and are retried in the new one.
+The appends of a crashed process are never finished, so GrowShm waits for them for appendWaitTimeout at most,
+and an append still running afterwards returns ErrShmMovedWhileAppending, as its values may not have been copied.
+
+Processes which still have the old segment attached see that it moved with Vsegment.Moved, and follow it with RefreshShm.
+Writes into a moved segment fail with ErrShmMoved, so no data is written where nobody reads it anymore.
+The extension functions follow the move themselves and write into the new segment.
+Handles replaced by GrowShm and RefreshShm stay attached until the key is closed or deleted in the registry,
+so goroutines which still hold them get ErrShmMoved instead of touching detached memory.
+Without a Replacer, OpenShm can not find the key for a moment between removing the old segment and creating the new one.
+*/
+
+// moved states of the word at bytes 88:92 of the header
+const (
+	movedDone    uint32 = 1                         // GrowShm replaced the segment
+	movedAppend  uint32 = 2                         // one append in flight
+	movedSealed  uint32 = 1 << 31                   // GrowShm is copying the segment, appends wait for it
+	movedAppends uint32 = movedSealed - movedAppend // the number of appends in flight
+)
+
+// appendWaitTimeout is how long GrowShm waits for the appends in flight, the appends of a crashed process never finish.
+const appendWaitTimeout = time.Second
+
+// error list for growing
+const (
+	ErrShmMoved               = Error("shm was replaced by a larger segment, refresh it")
+	ErrShmMovedWhileAppending = Error("shm was replaced by a larger segment while appending, the values may not have been copied")
+	ErrShrinkShm              = Error("shm can only grow")
+)
+
+// movedWord returns the moved state in the forwarding record of the header for atomic operations.
+func (receive *Vsegment) movedWord() (word *uint32) {
+	word = (*uint32)(unsafe.Pointer(&receive.mem[88]))
+	return
+}
+
+// Moved tells if GrowShm replaced the segment with a larger one, and the segment has to be refreshed with RefreshShm.
+func (receive *Vsegment) Moved() (moved bool) {
+	// A handle which can not be used is not moved
+	if receive.acquire() != nil {
+		return
+	}
+	defer receive.release()
+
+	// Read the moved state
+	moved = receive.moved()
+	return
+}
+
+// moved is Moved for the callers which acquired the handle.
+func (receive *Vsegment) moved() (moved bool) {
+	moved = atomic.LoadUint32(receive.movedWord())&movedDone != 0
+	return
+}
+
+/*
+beginAppend counts an append in the moved state, and returns ErrShmMoved when the segment was replaced.
+While GrowShm seals the segment, it waits for the segment lock, which GrowShm holds until it is done.
+A seal which is still there once the lock is taken was left by a GrowShm which died, and it is removed.
+*/
+func (receive *Vsegment) beginAppend() (err error) {
+	word := receive.movedWord()
+	for {
+		// Count the append, unless the segment moved or is sealed
+		state := atomic.LoadUint32(word)
+		if state&movedDone != 0 {
+			err = ErrShmMoved
+			return
+		}
+		if state&movedSealed == 0 {
+			if atomic.CompareAndSwapUint32(word, state, state+movedAppend) {
+				return
+			}
+			continue
+		}
+
+		// Wait for GrowShm, and remove the seal of a GrowShm which died
+		err = receive.lockForWriting()
+		if err != nil {
+			return
+		}
+		if state = atomic.LoadUint32(word); state&movedSealed != 0 && state&movedDone == 0 {
+			atomic.CompareAndSwapUint32(word, state, state&^movedSealed)
+		}
+		err = receive.unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// endAppend stops counting the append, and returns ErrShmMovedWhileAppending when GrowShm stopped waiting for it.
+func (receive *Vsegment) endAppend() (err error) {
+	// Uncount the append, and wake GrowShm up after the last one
+	word := receive.movedWord()
+	state := atomic.AddUint32(word, ^(movedAppend - 1))
+	if state&movedSealed != 0 && state&movedAppends == 0 {
+		futexWake(word, 1)
+	}
+
+	// The segment was copied while the values were written
+	if state&movedDone != 0 {
+		err = ErrShmMovedWhileAppending
+	}
+	return
+}
+
+// sealAppends stops new appends, and waits up to appendWaitTimeout for the appends in flight, the caller holds the segment lock.
+func (receive *Vsegment) sealAppends() {
+	// Seal the segment
+	word := receive.movedWord()
+	for state := atomic.LoadUint32(word); !atomic.CompareAndSwapUint32(word, state, state|movedSealed); {
+		state = atomic.LoadUint32(word)
+	}
+
+	// Wait for the appends in flight, endAppend wakes the waiter up after the last one
+	deadline := time.Now().Add(appendWaitTimeout)
+	for state := atomic.LoadUint32(word); state&movedAppends != 0 && time.Now().Before(deadline); state = atomic.LoadUint32(word) {
+		futexWait(word, state, lockRecheckInterval)
+	}
+}
+
+// finishMove removes the seal, and marks the segment as replaced when moved is true, the appends waiting for the seal continue.
+func (receive *Vsegment) finishMove(moved bool) {
+	word := receive.movedWord()
+	for {
+		state := atomic.LoadUint32(word)
+		next := state &^ movedSealed
+		if moved {
+			next |= movedDone
+		}
+		if atomic.CompareAndSwapUint32(word, state, next) {
+			return
+		}
+	}
+}
+
+/*
+GrowShm replaces the segment registered for the key with a larger segment of the size, keeping the header and the data,
+and registers the new segment. Handles returned by Segment for the old segment return ErrShmMoved for writes afterwards.
+The registry is only locked to find and to register the segments, so other keys can be used while the data is copied.
+When the key is closed or followed by RefreshShm meanwhile, the new segment is left to the backend and not registered again.
+When the larger segment can not be created, the old segment is kept, or created again with its old size by the backends
+which can not build the new segment beside it, and the error is returned.
+*/
+func (receive *Vregistry) GrowShm(key, size int64) (err error) {
+	defer wrapError(&err, "GrowShm", key, 0)
+
+	// Check if the key can be used
+	err = checkKey(key)
+	if err != nil {
+		return
+	}
+
+	// Find the segment in the registry, and keep it attached while it is copied, the registry is not locked meanwhile
+	receive.mu.RLock()
+	sg := receive.segments[key]
+	if sg == nil {
+		receive.mu.RUnlock()
+		err = ErrShmNotExist
+		return
+	}
+	err = sg.acquire()
+	receive.mu.RUnlock()
+	if err != nil {
+		return
+	}
+	defer sg.release()
+
+	// A segment can only grow, and the segments of a chain keep their size, a chain grows by links
+	if size <= sg.size {
+		err = ErrShrinkShm
+		return
+	}
+	if typ := VshmType(decodeInfo(sg.mem[:DefualtMinShmSize]).Type); typ == TypeChain || typ == TypeChainLink {
+		err = ErrShmTypeMismatch
+		return
+	}
+
+	// Hold the segment lock, so no lock holder writes while the data is copied
+	err = sg.lockForWriting()
+	if err != nil {
+		return
+	}
+	defer func() {
+		err1 := sg.unlock()
+		if err == nil {
+			err = err1
+		}
+	}()
+	if sg.moved() {
+		err = ErrShmMoved
+		return
+	}
+
+	// Stop the appends, so the data does not change while it is copied
+	sg.sealAppends()
+
+	// Check the offset before the old segment is removed, relocate could not restore a segment with a broken offset
+	if offset := int64(atomic.LoadUint64(sg.offsetWord())); offset < DefualtMinShmSize || offset > sg.size {
+		sg.finishMove(false)
+		err = ErrInvalidShmHeader
+		return
+	}
+
+	// Copy the header and the data to the larger segment, or to a segment of the old size when the larger one fails
+	info := decodeInfo(sg.mem[:DefualtMinShmSize])
+	opts := Vopts{
+		Key:       key,
+		Size:      size,
+		Backend:   sg.backend,
+		Mode:      info.Mode,
+		HugePages: VsysFlags(info.Flag)&StatusHugePages != 0,
+		NoReserve: VsysFlags(info.Flag)&StatusNoReserve != 0,
+		Writes:    sg.writes,
+	}.withCreationFlags()
+	next, err := sg.replaceShmWithKey(opts, sg.relocate, sg.relocate)
+	if next == nil {
+		sg.finishMove(false)
+		return
+	}
+
+	// Forward the old segment to the new one, the appends waiting for the seal fail with ErrShmMoved
+	binary.LittleEndian.PutUint64(sg.mem[80:88], uint64(next.id))
+	sg.finishMove(true)
+
+	// Register the new segment, and keep the old one attached for the goroutines which still hold it
+	receive.mu.Lock()
+	defer receive.mu.Unlock()
+	if receive.segments[key] != sg {
+		// The key was closed, or RefreshShm followed the move already
+		_ = next.Close()
+		return
+	}
+	receive.segments[key] = next
+	receive.retired[key] = append(receive.retired[key], sg)
+
+	// Return the error value
+	return
+}
+
+// relocate copies the header and the data of the segment to the new segment, and writes the magic number of the new segment last.
+func (receive *Vsegment) relocate(next *Vsegment) (err error) {
+	// The offset comes from the shared header, it must lie inside the old segment and the data must fit into the new one
+	offset := int64(atomic.LoadUint64(receive.offsetWord()))
+	if offset < DefualtMinShmSize || offset > receive.size {
+		err = ErrInvalidShmHeader
+		return
+	}
+	if offset > next.size {
+		err = ErrNotEnoughSpace
+		return
+	}
+
+	// Copy the header after the magic number and the data up to the offset
+	copy(next.mem[4:offset], receive.mem[4:offset])
+
+	// The new segment has its own id and size, it is unlocked and not moved
+	binary.LittleEndian.PutUint64(next.mem[32:40], uint64(next.headerId()))
+	binary.LittleEndian.PutUint64(next.mem[40:48], uint64(next.size))
+	binary.LittleEndian.PutUint32(next.mem[52:56], lockUnlocked)
+	for i := 80; i < 92; i++ {
+		next.mem[i] = 0
+	}
+	binary.LittleEndian.PutUint32(next.mem[48:52], headerChecksum(next.mem))
+
+	// Write the magic number last, so the new header is complete once it can be seen
+	atomic.StoreUint32(next.magicWord(), atomic.LoadUint32(receive.magicWord()))
+
+	// Return the error value
+	return
+}
+
+/*
+RefreshShm follows the segment registered for the key to the segment which replaced it, when GrowShm moved it in any process.
+It returns whether the segment had moved. Handles returned by Segment for the old segment keep returning ErrShmMoved for writes.
+*/
+func (receive *Vregistry) RefreshShm(key int64) (moved bool, err error) {
+	defer wrapError(&err, "RefreshShm", key, 0)
+
+	// Check if the key can be used
+	err = checkKey(key)
+	if err != nil {
+		return
+	}
+
+	receive.mu.Lock()
+	defer receive.mu.Unlock()
+
+	// Find the segment in the registry, and check if it moved
+	sg := receive.segments[key]
+	if sg == nil {
+		err = ErrShmNotExist
+		return
+	}
+	moved = sg.Moved()
+	if !moved {
+		return
+	}
+
+	// Open the segment which is now registered for the key in the backend, the moved segment stays registered when it fails
+	next, err := openValidShm(Vopts{Key: key, Backend: sg.backend, Writes: sg.writes}, headerWaitTimeout)
+	if err != nil {
+		return
+	}
+
+	// Register the new segment, and keep the old one attached for the goroutines which still hold it
+	receive.segments[key] = next
+	receive.retired[key] = append(receive.retired[key], sg)
+
+	// Return the moved state
+	return
+}
+
+// GrowShm replaces the segment identified by a key with a larger segment, see Vregistry.GrowShm.
+func GrowShm(key, size int64) (err error) {
+	err = defaultRegistry.GrowShm(key, size)
+	return
+}
+
+// RefreshShm follows the segment identified by a key after GrowShm moved it, see Vregistry.RefreshShm.
+func RefreshShm(key int64) (moved bool, err error) {
+	moved, err = defaultRegistry.RefreshShm(key)
+	return
+}
@@ -0,0 +1,379 @@
+package shm
+
+import (
+	"errors"
+	"github.com/stretchr/testify/require"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// limitedBackend is an in-process backend which refuses to create segments larger than the limit, like shmget over SHMMAX.
+type limitedBackend struct {
+	MemoryBackend
+	limit int64
+}
+
+// Create refuses segments larger than the limit.
+func (receive limitedBackend) Create(key, size int64, flag VsysFlags, perm os.FileMode) (id int64, err error) {
+	if size > receive.limit {
+		err = syscall.EINVAL
+		return
+	}
+	id, err = receive.MemoryBackend.Create(key, size, flag, perm)
+	return
+}
+
+// Test_Check_Shm_Grow_Function checks that segments grow with their data, and that other handles follow the move.
+func Test_Check_Shm_Grow_Function(t *testing.T) {
+	// The segment is replaced by a larger one, and other attachments are forwarded to it
+	t.Run("grow and refresh", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 43
+
+		// Create a full segment with Key=testShmKey and room for two values
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 8, Mode: 0640})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		err = AppendInt32s(testShmKey, 1, 2)
+		require.NoError(t, err)
+		err = AppendInt32s(testShmKey, 3)
+		require.ErrorIs(t, err, ErrEndOfFile)
+
+		// Another registry has the segment attached, like another process
+		reader := NewRegistry()
+		err = reader.OpenShm(testShmKey)
+		require.NoError(t, err)
+		old, err := reader.Segment(testShmKey)
+		require.NoError(t, err)
+		before, err := InfoShm(testShmKey)
+		require.NoError(t, err)
+
+		// Grow the segment, the header and the data are kept
+		err = GrowShm(testShmKey, DefualtMinShmSize+64) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		require.NoError(t, err)
+		info, err := InfoShm(testShmKey)
+		require.NoError(t, err)
+		require.Equal(t, int64(DefualtMinShmSize+64), info.Size)
+		require.Equal(t, int64(DefualtMinShmSize+8), info.Offset)
+		require.Equal(t, os.FileMode(0640), info.Mode)
+		require.Equal(t, before.Created, info.Created)
+		values := make([]int32, 2)
+		err = ReadRowInInt32s(testShmKey, 0, values)
+		require.NoError(t, err)
+		require.Equal(t, []int32{1, 2}, values)
+		err = AppendInt32s(testShmKey, 3)
+		require.NoError(t, err)
+
+		// The old attachment is forwarded, and takes no more data
+		require.True(t, old.Moved())
+		err = old.AppendInt32s(4)
+		require.ErrorIs(t, err, ErrShmMoved)
+		err = old.OverwriteOrAppendInt32sByShift(DefualtMinShmSize, false, 4)
+		require.ErrorIs(t, err, ErrShmMoved)
+
+		// Refreshing follows the move to the new segment
+		moved, err := reader.RefreshShm(testShmKey)
+		require.NoError(t, err)
+		require.True(t, moved)
+		sg, err := reader.Segment(testShmKey)
+		require.NoError(t, err)
+		require.False(t, sg.Moved())
+		values = make([]int32, 3)
+		err = sg.ReadRowInInt32s(0, values)
+		require.NoError(t, err)
+		require.Equal(t, []int32{1, 2, 3}, values)
+		moved, err = reader.RefreshShm(testShmKey)
+		require.NoError(t, err)
+		require.False(t, moved)
+		err = reader.CloseShm(testShmKey)
+		require.NoError(t, err)
+
+		// Segments do not shrink
+		err = GrowShm(testShmKey, DefualtMinShmSize+64)
+		require.ErrorIs(t, err, ErrShrinkShm)
+	})
+
+	// The data is kept in a segment of the old size when the larger segment can not be created
+	t.Run("keep the data on failure", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 44
+		backend := limitedBackend{limit: DefualtMinShmSize + 8}
+
+		// Create a full segment with room for two values
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 8, Backend: backend})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		err = AppendInt32s(testShmKey, 5, 6)
+		require.NoError(t, err)
+
+		// Growing over the limit fails, the data stays under the key
+		err = GrowShm(testShmKey, DefualtMinShmSize+64)
+		require.ErrorIs(t, err, syscall.EINVAL)
+		info, err := InfoShm(testShmKey)
+		require.NoError(t, err)
+		require.Equal(t, int64(DefualtMinShmSize+8), info.Size)
+		values := make([]int32, 2)
+		err = ReadRowInInt32s(testShmKey, 0, values)
+		require.NoError(t, err)
+		require.Equal(t, []int32{5, 6}, values)
+
+		// Other registries can open the segment
+		reader := NewRegistry()
+		err = reader.OpenShmWithOpts(Vopts{Key: testShmKey, Backend: backend})
+		require.NoError(t, err)
+		err = reader.CloseShm(testShmKey)
+		require.NoError(t, err)
+	})
+	// Appends running while the segment grows land in the new segment, none of them is lost
+	t.Run("grow while appending", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 60
+		const appenders, appends = 4, 200
+
+		// Create a segment with room for all the values
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 2*appenders*appends*4})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		writer := NewRegistry()
+		err = writer.OpenShm(testShmKey)
+		require.NoError(t, err)
+		defer func() {
+			err1 := writer.CloseShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+
+		// Half of the goroutines append through the extension functions, the others through the handles of another registry
+		var started sync.WaitGroup
+		var wg sync.WaitGroup
+		errs := make([]error, 2*appenders)
+		for i := 0; i < 2*appenders; i++ {
+			started.Add(1)
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				var once sync.Once
+				defer once.Do(started.Done)
+				for j := 0; j < appends; j++ {
+					if j == appends/4 {
+						once.Do(started.Done)
+					}
+					value := int32(i*appends + j)
+					if i < appenders {
+						errs[i] = AppendInt32s(testShmKey, value)
+					} else {
+						errs[i] = appendFollowing(writer, testShmKey, value)
+					}
+					if errs[i] != nil {
+						return
+					}
+				}
+			}(i)
+		}
+
+		// Grow the segment while the goroutines append
+		started.Wait()
+		err = GrowShm(testShmKey, DefualtMinShmSize+4*appenders*appends*4) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		require.NoError(t, err)
+		wg.Wait()
+		for _, err1 := range errs {
+			require.NoError(t, err1)
+		}
+
+		// Every value was appended once to the new segment
+		offset, err := ReadOffset(testShmKey)
+		require.NoError(t, err)
+		values := make([]int32, (offset-DefualtMinShmSize)/4)
+		require.Len(t, values, 2*appenders*appends)
+		err = ReadRowInInt32s(testShmKey, 0, values)
+		require.NoError(t, err)
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		for i, value := range values {
+			require.Equal(t, int32(i), value)
+		}
+	})
+
+	// The file backend builds the larger file beside the old one, and renames it over the old one
+	t.Run("grow a file", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 61
+		backend := FileBackend{Dir: t.TempDir()}
+		reader := NewRegistry()
+
+		// Create a full file, and attach it in another registry
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 8, Backend: backend})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		err = AppendInt32s(testShmKey, 7, 8)
+		require.NoError(t, err)
+		err = reader.OpenShmWithOpts(Vopts{Key: testShmKey, Backend: backend})
+		require.NoError(t, err)
+		old, err := Segment(testShmKey)
+		require.NoError(t, err)
+
+		// Grow the file, only the new file is left under the key
+		err = GrowShm(testShmKey, DefualtMinShmSize+64)
+		require.NoError(t, err)
+		entries, err := os.ReadDir(backend.Dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+
+		// The replaced handle has the id of the old file, so it can not remove the new one
+		err = old.deleteWithId()
+		require.ErrorIs(t, err, ErrShmNotExist)
+		entries, err = os.ReadDir(backend.Dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		values := make([]int32, 2)
+		err = ReadRowInInt32s(testShmKey, 0, values)
+		require.NoError(t, err)
+		require.Equal(t, []int32{7, 8}, values)
+
+		// The other registry follows the move
+		moved, err := reader.RefreshShm(testShmKey)
+		require.NoError(t, err)
+		require.True(t, moved)
+		sg, err := reader.Segment(testShmKey)
+		require.NoError(t, err)
+		require.Equal(t, int64(DefualtMinShmSize+64), sg.size)
+		err = reader.CloseShm(testShmKey)
+		require.NoError(t, err)
+	})
+
+	// Appends of crashed processes do not stop GrowShm, and the seal of a crashed GrowShm does not stop the appends
+	t.Run("crashed appends and grows", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 62
+
+		// Create a segment with Key=testShmKey
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 64, Backend: MemoryBackend{}})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		sg, err := Segment(testShmKey)
+		require.NoError(t, err)
+
+		// A seal without the lock held is removed by the next append
+		atomic.StoreUint32(sg.movedWord(), movedSealed)
+		err = sg.AppendInt32s(1)
+		require.NoError(t, err)
+		require.Equal(t, uint32(0), atomic.LoadUint32(sg.movedWord()))
+
+		// An append which does not finish in time is not waited for, and it learns that its values may be lost
+		err = sg.beginAppend()
+		require.NoError(t, err)
+		err = GrowShm(testShmKey, DefualtMinShmSize+128)
+		require.NoError(t, err)
+		err = sg.endAppend()
+		require.ErrorIs(t, err, ErrShmMovedWhileAppending)
+		err = sg.AppendInt32s(2)
+		require.ErrorIs(t, err, ErrShmMoved)
+		err = AppendInt32s(testShmKey, 2)
+		require.NoError(t, err)
+	})
+
+	// GrowShm waiting for the segment lock does not stop the other keys of the registry, nor the lock holder
+	t.Run("grow while locked", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing, the otherShmKey is used meanwhile
+		var testShmKey, otherShmKey int64 = 63, 64
+
+		// Create two segments, and lock the first one
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 8, Backend: MemoryBackend{}})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		err = NewShm(Vopts{Key: otherShmKey, Size: DefualtMinShmSize + 8, Backend: MemoryBackend{}})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(otherShmKey)
+			require.NoError(t, err1)
+		}()
+		err = LockShm(testShmKey)
+		require.NoError(t, err)
+
+		// Grow the locked segment, GrowShm waits for the lock
+		done := make(chan error)
+		go func() {
+			done <- GrowShm(testShmKey, DefualtMinShmSize+64)
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		// The registry is still usable, and the lock can be released
+		_, err = InfoShm(otherShmKey)
+		require.NoError(t, err)
+		_, err = InfoShm(testShmKey)
+		require.NoError(t, err)
+		err = UnlockShm(testShmKey)
+		require.NoError(t, err)
+		err = <-done
+		require.NoError(t, err)
+		info, err := InfoShm(testShmKey)
+		require.NoError(t, err)
+		require.Equal(t, int64(DefualtMinShmSize+64), info.Size)
+	})
+
+	// An offset outside the segment is refused before anything is copied, and the segment stays usable
+	t.Run("grow with a broken offset", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 65
+
+		// Create a segment, and break its offset like another process could
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 64, Backend: MemoryBackend{}})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		sg, err := Segment(testShmKey)
+		require.NoError(t, err)
+		atomic.StoreUint64(sg.offsetWord(), DefualtMinShmSize+200)
+
+		// Growing fails, the segment is neither locked nor sealed afterwards
+		err = GrowShm(testShmKey, DefualtMinShmSize+400)
+		require.ErrorIs(t, err, ErrInvalidShmHeader)
+		require.Equal(t, uint32(0), atomic.LoadUint32(sg.movedWord()))
+		err = sg.TryLock()
+		require.NoError(t, err)
+		err = sg.Unlock()
+		require.NoError(t, err)
+	})
+}
+
+// appendFollowing appends the value to the segment of the registry, and follows the segment when it moved, like another process would.
+func appendFollowing(registry *Vregistry, key int64, value int32) (err error) {
+	for {
+		var sg *Vsegment
+		sg, err = registry.Segment(key)
+		if err != nil {
+			return
+		}
+		err = sg.AppendInt32s(value)
+		if !errors.Is(err, ErrShmMoved) {
+			return
+		}
+		_, err = registry.RefreshShm(key)
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package shm
+
+import "hash/fnv"
+
+/*
+Hand-picked integer keys collide easily when several services share a host.
+A key can be derived from an existing file with ftok instead, so every service uses the path of a file it owns,
+or from a name like "orders/index", which is hashed into the key range.
+*/
+
+// error list for the keys
+const (
+	ErrIllegalProjId = Error("project id should be between 0 and 127")
+	ErrDeriveShmKey  = Error("derive shm key failed")
+	ErrEmptyShmName  = Error("shm name should not be empty")
+)
+
+// maxProjIdValue keeps the project id, which ftok puts into the highest byte of the key, from making the key negative
+const maxProjIdValue = 0x7f
+
+/*
+KeyFromPath derives a key from the path of an existing file and a project id with ftok.
+The same file and project id give the same key in every process, as long as the file is not recreated.
+When projID is 0, the project id of filebasez (IPC_KEY_PROJID) is used.
+*/
+func KeyFromPath(path string, projID int) (key int64, err error) {
+	defer wrapError(&err, "KeyFromPath", 0, 0)
+
+	// Check if the project id keeps the key positive
+	if projID < 0 || projID > maxProjIdValue {
+		err = ErrIllegalProjId
+		return
+	}
+
+	// Derive the key with ftok
+	key, err = ftok(path, projID)
+
+	// Return the key
+	return
+}
+
+/*
+KeyFromName derives a key from a name, such as "orders/index", with the 32-bit FNV-1a hash.
+The hash is folded into the positive key range, so different names may still give the same key,
+but two names colliding is unlikely as long as only a few thousand names are used on a host.
+
+Names are not unique: the name is not recorded anywhere, only the key is, so OpenShmByName opens the segment of another name
+which gives the same key without noticing, and NewShmByName fails with EEXIST when that segment exists.
+Callers which can not tolerate that keep their own identity in the data, or derive the keys from files they own with KeyFromPath.
+*/
+func KeyFromName(name string) (key int64, err error) {
+	defer wrapError(&err, "KeyFromName", 0, 0)
+
+	// Check if the name is empty
+	if name == "" {
+		err = ErrEmptyShmName
+		return
+	}
+
+	// Hash the name and fold it into the range between 1 and defaultMaxKeyValue
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	key = int64(h.Sum32())%defaultMaxKeyValue + 1
+
+	// Return the key
+	return
+}
+
+// NewShmByPath creates a new segment whose key is derived from the path and the project id, and returns the key.
+func NewShmByPath(path string, projID int, size int64) (key int64, err error) {
+	// Derive the key
+	key, err = KeyFromPath(path, projID)
+	if err != nil {
+		return
+	}
+
+	// Create the segment with the derived key
+	err = NewShm(Vopts{Key: key, Size: size})
+
+	// Return the key and the error value
+	return
+}
+
+// OpenShmByPath opens an existing segment whose key is derived from the path and the project id, and returns the key.
+func OpenShmByPath(path string, projID int) (key int64, err error) {
+	// Derive the key
+	key, err = KeyFromPath(path, projID)
+	if err != nil {
+		return
+	}
+
+	// Open the segment with the derived key
+	err = OpenShm(key)
+
+	// Return the key and the error value
+	return
+}
+
+// NewShmByName creates a new segment whose key is derived from the name, and returns the key.
+func NewShmByName(name string, size int64) (key int64, err error) {
+	// Derive the key
+	key, err = KeyFromName(name)
+	if err != nil {
+		return
+	}
+
+	// Create the segment with the derived key
+	err = NewShm(Vopts{Key: key, Size: size})
+
+	// Return the key and the error value
+	return
+}
+
+// OpenShmByName opens an existing segment whose key is derived from the name, and returns the key, see KeyFromName for colliding names.
+func OpenShmByName(name string) (key int64, err error) {
+	// Derive the key
+	key, err = KeyFromName(name)
+	if err != nil {
+		return
+	}
+
+	// Open the segment with the derived key
+	err = OpenShm(key)
+
+	// Return the key and the error value
+	return
+}
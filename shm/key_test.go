@@ -0,0 +1,84 @@
+package shm
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test_Check_Shm_Key_Function checks the keys derived from paths with ftok and from names.
+func Test_Check_Shm_Key_Function(t *testing.T) {
+	// Keys derived from the path of an existing file
+	t.Run("path keys", func(t *testing.T) {
+		// Create a file which owns the key
+		path := filepath.Join(t.TempDir(), "orders")
+		err := os.WriteFile(path, nil, 0600)
+		require.NoError(t, err)
+
+		// Create the segment by path
+		key, err := NewShmByPath(path, 1, DefualtMinShmSize+16) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(key)
+			require.NoError(t, err1)
+		}()
+
+		// The same path and project id give the same key, other project ids give other keys
+		same, err := KeyFromPath(path, 1)
+		require.NoError(t, err)
+		require.Equal(t, key, same)
+		other, err := KeyFromPath(path, 0)
+		require.NoError(t, err)
+		require.NotEqual(t, key, other)
+
+		// The segment can be opened again by path
+		err = AppendInt32s(key, 7)
+		require.NoError(t, err)
+		err = CloseShm(key)
+		require.NoError(t, err)
+		opened, err := OpenShmByPath(path, 1)
+		require.NoError(t, err)
+		require.Equal(t, key, opened)
+		values := make([]int32, 1)
+		err = ReadRowInInt32s(key, 0, values)
+		require.NoError(t, err)
+		require.Equal(t, []int32{7}, values)
+
+		// Missing files and project ids which make the key negative are refused
+		_, err = NewShmByPath(filepath.Join(t.TempDir(), "missing"), 1, DefualtMinShmSize)
+		require.ErrorIs(t, err, ErrDeriveShmKey)
+		_, err = KeyFromPath(path, 0x80)
+		require.ErrorIs(t, err, ErrIllegalProjId)
+	})
+
+	// Keys derived from names
+	t.Run("name keys", func(t *testing.T) {
+		// Create the segment by name
+		key, err := NewShmByName("filebasez-test/orders/index", DefualtMinShmSize+16)
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(key)
+			require.NoError(t, err1)
+		}()
+
+		// The same name gives the same key, and other names give other keys
+		same, err := KeyFromName("filebasez-test/orders/index")
+		require.NoError(t, err)
+		require.Equal(t, key, same)
+		other, err := KeyFromName("filebasez-test/orders/data")
+		require.NoError(t, err)
+		require.NotEqual(t, key, other)
+
+		// The segment can be opened again by name
+		err = CloseShm(key)
+		require.NoError(t, err)
+		opened, err := OpenShmByName("filebasez-test/orders/index")
+		require.NoError(t, err)
+		require.Equal(t, key, opened)
+
+		// Empty names are refused
+		_, err = KeyFromName("")
+		require.ErrorIs(t, err, ErrEmptyShmName)
+	})
+}
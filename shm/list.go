@@ -0,0 +1,200 @@
+package shm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Ventry describes one System V segment of the host, as listed by ListShm.
+The headers of the segments which filebasez could have created are probed, so these entries tell their version and data structure type.
+*/
+type Ventry struct {
+	Key        int64
+	Id         int64
+	Size       int64
+	Uid        int         // owner user id
+	Gid        int         // owner group id
+	Mode       os.FileMode // permission bits
+	Pinned     bool        // the segment is locked in RAM with SHM_LOCK
+	Removed    bool        // the segment is marked to be destroyed after the last detach
+	CreatorPid int         // the process which created the segment
+	LastPid    int         // the process which called shmat or shmdt last
+	Attaches   int64       // the number of current attachments
+	Filebasez  bool        // the segment holds a filebasez header, including the headers before 2.0
+	Major      uint16      // the version in the header, only set for filebasez segments
+	Minor      uint16
+	Patch      uint16
+	Type       VshmType      // the data structure in the header, only set for filebasez segments of the current major version
+	Created    time.Time     // the creation time in the header, only set for filebasez segments since 2.1
+	TTL        time.Duration // the time to live in the header, only set for filebasez segments since 2.1
+	HeaderErr  error         // why the header can not be opened, ErrForeignShm for segments of other programs, ErrShmNotProbed for unprobed ones, nil when OpenShm accepts it
+}
+
+// sysvipcShmPath is the file the kernel lists the System V segments in
+const sysvipcShmPath = "/proc/sysvipc/shm"
+
+// error list for listing
+const (
+	ErrParseSysvipc = Error("failed to parse the list of System V segments")
+	ErrShmNotProbed = Error("shm header is not probed, the segment belongs to another user")
+)
+
+/*
+ListShm lists every System V segment of the host from /proc/sysvipc/shm, including the segments of other programs.
+Segments are owned by the effective user which created them, so only the segments of the effective user of the process
+are probed for a header, and the others are listed with ErrShmNotProbed in HeaderErr, even when the process could read them.
+Segments smaller than any filebasez header are listed with ErrForeignShm without probing.
+
+Probing reads the header through a short read-only attachment. The attachment is visible to the other processes of the host:
+the kernel records this process as the last one which attached the segment, updates its attach and detach times,
+and counts one more attachment while the header is copied. Segments the process may not read are listed with the error of shmat in HeaderErr.
+The segments are not registered.
+*/
+func ListShm() (entries []Ventry, err error) {
+	defer wrapError(&err, "ListShm", 0, 0)
+
+	// Open the list of the kernel
+	file, err := os.Open(sysvipcShmPath)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	// Parse the segments
+	entries, err = parseSysvipcShm(file)
+	if err != nil {
+		return
+	}
+
+	// Probe the header of every segment
+	for i := range entries {
+		entries[i].probe()
+	}
+
+	// Return the entries
+	return
+}
+
+/*
+parseSysvipcShm parses the list of System V segments in the format of /proc/sysvipc/shm.
+The columns are found by the names in the first line, because newer kernels append columns such as rss and swap.
+*/
+func parseSysvipcShm(reader io.Reader) (entries []Ventry, err error) {
+	// Find the columns in the first line
+	scanner := bufio.NewScanner(reader)
+	if !scanner.Scan() {
+		err = ErrParseSysvipc
+		return
+	}
+	columns := make(map[string]int)
+	for i, name := range strings.Fields(scanner.Text()) {
+		columns[name] = i
+	}
+	for _, name := range []string{"key", "shmid", "perms", "size", "cpid", "lpid", "nattch", "uid", "gid"} {
+		if _, ok := columns[name]; !ok {
+			err = ErrParseSysvipc
+			return
+		}
+	}
+
+	// Parse one segment per line
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < len(columns) {
+			err = ErrParseSysvipc
+			return
+		}
+
+		// number parses the column with the name in the base
+		var parseErr error
+		number := func(name string, base int) (value int64) {
+			value, err1 := strconv.ParseInt(fields[columns[name]], base, 64)
+			if err1 != nil {
+				parseErr = ErrParseSysvipc
+			}
+			return
+		}
+
+		// The permissions are octal, and they carry SHM_DEST and SHM_LOCKED above the permission bits
+		perms := number("perms", 8)
+		entry := Ventry{
+			Key:        number("key", 10),
+			Id:         number("shmid", 10),
+			Size:       number("size", 10),
+			Uid:        int(number("uid", 10)),
+			Gid:        int(number("gid", 10)),
+			Mode:       os.FileMode(perms).Perm(),
+			Pinned:     perms&02000 != 0,
+			Removed:    perms&01000 != 0,
+			CreatorPid: int(number("cpid", 10)),
+			LastPid:    int(number("lpid", 10)),
+			Attaches:   number("nattch", 10),
+		}
+		if parseErr != nil {
+			err = parseErr
+			return
+		}
+		entries = append(entries, entry)
+	}
+	err = scanner.Err()
+
+	// Return the entries
+	return
+}
+
+// probe reads the header of the segment and records what it holds, when filebasez could have created the segment.
+func (receive *Ventry) probe() {
+	// Segments which are too small for any header, or which belong to other users, are not attached
+	if receive.Size < legacyShmSize {
+		receive.HeaderErr = ErrForeignShm
+		return
+	}
+	if receive.Uid != os.Geteuid() {
+		receive.HeaderErr = ErrShmNotProbed
+		return
+	}
+
+	// Copy the header through a read-only attachment
+	header, err := readSysvHeader(receive.Id, receive.Size)
+	if err != nil {
+		receive.HeaderErr = err
+		return
+	}
+
+	// Validate the header the same way OpenShm does
+	sg := &Vsegment{key: receive.Key, id: receive.Id, size: receive.Size, mem: header}
+	receive.HeaderErr = validateInfo(sg)
+	switch {
+	case receive.HeaderErr == ErrForeignShm:
+		// Segments of other programs have nothing else to tell
+	case string(header[0:4]) == ShmMagic:
+		// The version is always at the same place after the magic number, but the rest of the layout depends on the major version
+		receive.Filebasez = true
+		receive.Major = binary.LittleEndian.Uint16(header[4:6])
+		receive.Minor = binary.LittleEndian.Uint16(header[6:8])
+		receive.Patch = binary.LittleEndian.Uint16(header[8:10])
+		if receive.Major == MajorVersion {
+			vinfo := decodeInfo(header)
+			receive.Type = VshmType(vinfo.Type)
+			receive.Created = vinfo.Created
+			receive.TTL = vinfo.TTL
+		}
+	default:
+		// The headers before 2.0 start with the version
+		receive.Filebasez = true
+		receive.Major = binary.LittleEndian.Uint16(header[0:2])
+		receive.Minor = binary.LittleEndian.Uint16(header[2:4])
+		receive.Patch = binary.LittleEndian.Uint16(header[4:6])
+	}
+}
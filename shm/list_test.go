@@ -0,0 +1,109 @@
+package shm
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Test_Check_Shm_List_Function checks that every segment of the host is listed, and that filebasez segments are recognized.
+func Test_Check_Shm_List_Function(t *testing.T) {
+	// The list of the kernel is parsed by the names of its columns
+	t.Run("parse the list", func(t *testing.T) {
+		// A list of a kernel with the rss and swap columns
+		list := `       key      shmid perms                  size  cpid  lpid nattch   uid   gid  cuid  cgid      atime      dtime      ctime                   rss                  swap
+        34         12  3600                   112  4242  4243      2  1000  1001  1000  1001 1700000000          0 1700000000                  4096                     0
+         0         13   644                  4096     7     7      0     0     0     0     0          0          0 1700000000                     0                     0
+`
+		entries, err := parseSysvipcShm(strings.NewReader(list)) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		require.Equal(t, Ventry{
+			Key:        34,
+			Id:         12,
+			Size:       112,
+			Uid:        1000,
+			Gid:        1001,
+			Mode:       0600,
+			Pinned:     true,
+			Removed:    true,
+			CreatorPid: 4242,
+			LastPid:    4243,
+			Attaches:   2,
+		}, entries[0])
+		require.Equal(t, os.FileMode(0644), entries[1].Mode)
+		require.False(t, entries[1].Pinned)
+
+		// Lists without the expected columns or with broken numbers are refused
+		_, err = parseSysvipcShm(strings.NewReader(""))
+		require.ErrorIs(t, err, ErrParseSysvipc)
+		_, err = parseSysvipcShm(strings.NewReader("key shmid\n1 2\n"))
+		require.ErrorIs(t, err, ErrParseSysvipc)
+		_, err = parseSysvipcShm(strings.NewReader(strings.Replace(list, "4243", "4z43", 1)))
+		require.ErrorIs(t, err, ErrParseSysvipc)
+	})
+
+	// Segments which filebasez can not have created are not attached
+	t.Run("skip the segments of others", func(t *testing.T) {
+		// A segment of another user is not probed
+		entry := Ventry{Id: -1, Size: 1024, Uid: os.Geteuid() + 1}
+		entry.probe()
+		require.ErrorIs(t, entry.HeaderErr, ErrShmNotProbed)
+		require.False(t, entry.Filebasez)
+
+		// A segment smaller than any header is foreign
+		entry = Ventry{Id: -1, Size: legacyShmSize - 1, Uid: os.Geteuid()}
+		entry.probe()
+		require.ErrorIs(t, entry.HeaderErr, ErrForeignShm)
+	})
+
+	// Only System V segments are listed by the kernel
+	if _, ok := defaultBackend.(SysvBackend); !ok {
+		return
+	}
+
+	// The segments of this process are listed with their headers
+	t.Run("list the host", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 34
+
+		// Create a filebasez segment and a segment without any header
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 16, Type: TypeSpeedyArrayInt32})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		foreign, err := newWithReturnId(Vopts{Key: testShmKey + 1, Size: DefualtMinShmSize, Backend: SysvBackend{}})
+		require.NoError(t, err)
+		defer func() {
+			err1 := foreign.deleteWithId()
+			require.NoError(t, err1)
+		}()
+
+		// Find both segments in the list
+		entries, err := ListShm()
+		require.NoError(t, err)
+		found := make(map[int64]Ventry)
+		for _, entry := range entries {
+			found[entry.Key] = entry
+		}
+		sg, err := Segment(testShmKey)
+		require.NoError(t, err)
+		entry := found[testShmKey]
+		require.Equal(t, sg.id, entry.Id)
+		require.Equal(t, int64(DefualtMinShmSize+16), entry.Size)
+		require.Equal(t, os.Getuid(), entry.Uid)
+		require.Equal(t, os.FileMode(0600), entry.Mode)
+		require.Equal(t, int64(1), entry.Attaches)
+		require.True(t, entry.Filebasez)
+		require.Equal(t, MajorVersion, entry.Major)
+		require.Equal(t, TypeSpeedyArrayInt32, entry.Type)
+		require.NoError(t, entry.HeaderErr)
+		entry = found[testShmKey+1]
+		require.Equal(t, foreign.id, entry.Id)
+		require.False(t, entry.Filebasez)
+		require.Equal(t, ErrForeignShm, entry.HeaderErr)
+	})
+}
@@ -0,0 +1,423 @@
+package shm
+
+import (
+	"bytes"
+	"errors"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+/*
+The lock is a futex word stored at bytes 52:56 of the header, so every process attached to the segment shares it.
+The word is 0 when unlocked, otherwise it holds the PID of the owner process in its low 22 bits and a tag of its PID namespace above,
+and the highest bit is set when other holders may be sleeping in the kernel.
+Because the owner is recorded, a process that dies while holding the lock can be detected and the lock taken over.
+A PID only names a process inside its own PID namespace, so the owner is only checked when the tags match,
+an owner of another namespace is always considered alive.
+The futex operations are not private, because the waiters live in different processes.
+*/
+
+// lock states of the futex word
+const (
+	lockUnlocked       uint32 = 0
+	lockWaiters        uint32 = 1 << 31   // set when holders may be sleeping on the futex word
+	lockOwnerMask      uint32 = 1<<31 - 1 // the PID and the namespace tag of the owner
+	lockPidMask        uint32 = 1<<22 - 1 // PIDs are below PID_MAX_LIMIT, which is 1<<22
+	lockNamespaceShift        = 22
+)
+
+// futex operations, reference: https://man7.org/linux/man-pages/man2/futex.2.html
+const (
+	futexOpWait = 0
+	futexOpWake = 1
+)
+
+/*
+lockRecheckInterval is how long a waiter sleeps before checking the owner again.
+A dead owner never wakes up the waiters, so they have to wake up by themselves.
+*/
+const lockRecheckInterval = 100 * time.Millisecond
+
+// error list for the lock
+const (
+	ErrShmLocked     = Error("shm is locked by another holder")
+	ErrShmNotLocked  = Error("shm is not locked")
+	ErrLockNotOwner  = Error("shm lock is owned by another process")
+	ErrLockOwnerDied = Error("shm lock owner died, the protected data may be inconsistent")
+)
+
+// lockPid is the PID and the namespace tag recorded in the futex word by this process
+var lockPid = uint32(os.Getpid()) | pidNamespaceTag()<<lockNamespaceShift
+
+/*
+pidNamespaceTag returns a 9-bit tag of the PID namespace of the process, taken from the inode of /proc/self/ns/pid.
+It is 0 when the namespace can not be read. Two namespaces share a tag with a chance of 1 in 511.
+*/
+func pidNamespaceTag() (tag uint32) {
+	// The link reads like pid:[4026531836]
+	link, err := os.Readlink("/proc/self/ns/pid")
+	if err != nil {
+		return
+	}
+
+	// Fold the hash of the link into 1..511, so a known namespace never has the tag 0
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(link))
+	tag = hash.Sum32()%(lockOwnerMask>>lockNamespaceShift) + 1
+	return
+}
+
+// lockWord returns the futex word in the header of the attached memory.
+func (receive *Vsegment) lockWord() (word *uint32, err error) {
+	// Check if the segment can be used
+	err = receive.checkAttached()
+	if err != nil {
+		return
+	}
+
+	// The attached memory is page aligned, so bytes 52:56 are aligned for 32-bit atomic operations
+	word = (*uint32)(unsafe.Pointer(&receive.mem[52]))
+
+	// Return the futex word
+	return
+}
+
+/*
+Lock acquires the segment lock, sleeping in the kernel while another process or goroutine holds it.
+When the owner process died while holding the lock, the lock is taken over and ErrLockOwnerDied is returned.
+The lock is held in that case, and the caller has to validate the protected data before calling Unlock.
+
+The owner is checked with its PID, which only works in the PID namespace of the owner.
+Containers which share the IPC namespace or /dev/shm but not the PID namespace never take over each other's locks,
+so the lock of an owner which died in another namespace is only taken over by a process of that namespace.
+The namespaces are told apart by a 9-bit tag, two of them may share it, and then a live owner of the other namespace can look dead.
+Segments shared between hosts, for example through FileBackend on a network file system, must not rely on the takeover.
+
+The lock belongs to the process, not to a goroutine, and it is not reentrant.
+The overwrites and the cursor writes of this handle take the lock themselves, so they return ErrShmLocked while it is held,
+instead of waiting for their own process. Other handles of the segment in the process and GrowShm can not tell the holder apart,
+they wait for the lock, so the holder must not call them before Unlock.
+*/
+func (receive *Vsegment) Lock() (err error) {
+	defer receive.wrapError(&err, "Lock")
+
+	// Keep the segment attached while locking
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+
+	// Acquire the segment lock, and remember that this handle holds it
+	err = receive.lock()
+	receive.markHeld(err)
+	return
+}
+
+// markHeld records that the lock is held through this handle, when locking returned the error.
+func (receive *Vsegment) markHeld(err error) {
+	if err == nil || errors.Is(err, ErrLockOwnerDied) {
+		atomic.StoreUint32(&receive.held, 1)
+	}
+}
+
+/*
+lock acquires the segment lock like Lock, the caller has acquired the handle.
+The handle is released while sleeping in the kernel, so Close never waits for the lock, and ErrShmNotAttached is returned when it closed meanwhile.
+*/
+func (receive *Vsegment) lock() (err error) {
+	// Get the futex word
+	var word *uint32
+	word, err = receive.lockWord()
+	if err != nil {
+		return
+	}
+
+	// Fast path: the lock is free and nobody waits for it
+	if atomic.CompareAndSwapUint32(word, lockUnlocked, lockPid) {
+		return
+	}
+
+	// Slow path: once this holder has slept, it keeps the waiters bit, so that the other sleepers are woken up on Unlock
+	var waiters uint32
+	for {
+		state := atomic.LoadUint32(word)
+
+		// The lock is free
+		if state == lockUnlocked {
+			if atomic.CompareAndSwapUint32(word, lockUnlocked, lockPid|waiters) {
+				return
+			}
+			continue
+		}
+
+		// The owner died while holding the lock, take it over and keep the waiters bit
+		if !ownerAlive(state) {
+			if atomic.CompareAndSwapUint32(word, state, lockPid|state&lockWaiters) {
+				err = ErrLockOwnerDied
+				return
+			}
+			continue
+		}
+
+		// Tell the owner that there is a waiter, and sleep until it wakes us up or the recheck interval passes
+		if state&lockWaiters == 0 && !atomic.CompareAndSwapUint32(word, state, state|lockWaiters) {
+			continue
+		}
+		waiters = lockWaiters
+		receive.use.RUnlock()
+		futexWait(word, state|lockWaiters, lockRecheckInterval)
+		receive.use.RLock()
+
+		// The handle may have been closed while sleeping
+		if receive.mem == nil {
+			err = ErrShmNotAttached
+			return
+		}
+	}
+}
+
+/*
+TryLock acquires the segment lock without waiting, it returns ErrShmLocked when the lock is held.
+Like Lock, it takes over the lock of a dead owner and returns ErrLockOwnerDied.
+*/
+func (receive *Vsegment) TryLock() (err error) {
+	defer receive.wrapError(&err, "TryLock")
+
+	// Keep the segment attached while locking
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+
+	// Remember that this handle holds the lock once it is taken
+	defer func() {
+		receive.markHeld(err)
+	}()
+
+	// Get the futex word
+	var word *uint32
+	word, err = receive.lockWord()
+	if err != nil {
+		return
+	}
+
+	for {
+		state := atomic.LoadUint32(word)
+
+		// The lock is free
+		if state == lockUnlocked {
+			if atomic.CompareAndSwapUint32(word, lockUnlocked, lockPid) {
+				return
+			}
+			continue
+		}
+
+		// The owner died while holding the lock, take it over and keep the waiters bit
+		if !ownerAlive(state) {
+			if atomic.CompareAndSwapUint32(word, state, lockPid|state&lockWaiters) {
+				err = ErrLockOwnerDied
+				return
+			}
+			continue
+		}
+
+		// The owner is alive
+		err = ErrShmLocked
+		return
+	}
+}
+
+/*
+Unlock releases the segment lock and wakes up one waiter if there is any.
+Any goroutine of the owner process may release the lock, but other processes can not.
+*/
+func (receive *Vsegment) Unlock() (err error) {
+	defer receive.wrapError(&err, "Unlock")
+
+	// Keep the segment attached while unlocking
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+
+	// Release the segment lock, this handle does not hold it anymore
+	err = receive.unlock()
+	if err == nil {
+		atomic.StoreUint32(&receive.held, 0)
+	}
+	return
+}
+
+// unlock releases the segment lock like Unlock, the caller has acquired the handle.
+func (receive *Vsegment) unlock() (err error) {
+	// Get the futex word
+	var word *uint32
+	word, err = receive.lockWord()
+	if err != nil {
+		return
+	}
+
+	// Check the owner before releasing the lock
+	state := atomic.LoadUint32(word)
+	switch {
+	case state == lockUnlocked:
+		err = ErrShmNotLocked
+		return
+	case state&lockOwnerMask != lockPid:
+		err = ErrLockNotOwner
+		return
+	}
+
+	// Release the lock, the previous state tells if a waiter has to be woken up
+	if atomic.SwapUint32(word, lockUnlocked)&lockWaiters != 0 {
+		futexWake(word, 1)
+	}
+
+	// Return the error value
+	return
+}
+
+/*
+lockForWriting acquires the segment lock for the overwrite path, the caller has acquired the handle.
+When the previous owner died, the offset is checked: overwrites only move it forward after the values are written,
+so an offset inside the segment can be trusted and the write can go on.
+The values the dead owner was overwriting may still be half written.
+*/
+func (receive *Vsegment) lockForWriting() (err error) {
+	// Acquire the segment lock
+	err = receive.lock()
+	if !errors.Is(err, ErrLockOwnerDied) {
+		return
+	}
+
+	// Validate the offset left by the dead owner
+	err = nil
+	offset := int64(atomic.LoadUint64(receive.offsetWord()))
+	if offset < DefualtMinShmSize || offset > receive.size {
+		_ = receive.unlock()
+		err = ErrInvalidShmHeader
+	}
+
+	// Return the error value
+	return
+}
+
+// lockForOverwrite acquires the segment lock like lockForWriting, and returns ErrShmLocked while the lock is held through Lock of this handle.
+func (receive *Vsegment) lockForOverwrite() (err error) {
+	// The holder would wait for itself
+	if atomic.LoadUint32(&receive.held) != 0 {
+		err = ErrShmLocked
+		return
+	}
+
+	// Acquire the segment lock
+	err = receive.lockForWriting()
+	return
+}
+
+// ownerAlive tells if the owner recorded in the lock state may still hold the lock, an owner of another PID namespace can not be checked, so it is considered alive.
+func ownerAlive(state uint32) (alive bool) {
+	// Compare the namespace tags first
+	owner := state & lockOwnerMask
+	if owner&^lockPidMask != lockPid&^lockPidMask {
+		alive = true
+		return
+	}
+
+	// Check the process in this namespace
+	alive = processAlive(owner & lockPidMask)
+	return
+}
+
+/*
+processAlive checks if the process with the given PID still exists by sending it the signal 0.
+EPERM means the process exists but belongs to another user.
+A zombie process still answers the signal, so its state in /proc is checked as well.
+*/
+func processAlive(pid uint32) (alive bool) {
+	// Send the signal 0, which only checks the process
+	err := syscall.Kill(int(pid), 0)
+	alive = err == nil || err == syscall.EPERM
+	if !alive {
+		return
+	}
+
+	// The state is the field after the command name in parentheses, "Z" means the process has exited but is not reaped yet
+	stat, err := os.ReadFile("/proc/" + strconv.FormatUint(uint64(pid), 10) + "/stat")
+	if err != nil {
+		return
+	}
+	if i := bytes.LastIndexByte(stat, ')'); i >= 0 && i+2 < len(stat) && stat[i+2] == 'Z' {
+		alive = false
+	}
+
+	// Return whether the process is alive
+	return
+}
+
+// futexWait sleeps while the word holds the value, at most for the timeout; EAGAIN, EINTR and ETIMEDOUT only mean the caller has to check the word again.
+func futexWait(word *uint32, value uint32, timeout time.Duration) {
+	ts := syscall.NsecToTimespec(int64(timeout))
+	_, _, _ = syscall.Syscall6(syscall.SYS_FUTEX, uintptr(unsafe.Pointer(word)), futexOpWait, uintptr(value), uintptr(unsafe.Pointer(&ts)), 0, 0)
+}
+
+// futexWake wakes up at most count holders sleeping on the word.
+func futexWake(word *uint32, count int) {
+	_, _, _ = syscall.Syscall6(syscall.SYS_FUTEX, uintptr(unsafe.Pointer(word)), futexOpWake, uintptr(count), 0, 0, 0)
+}
+
+// LockShm acquires the lock of the segment registered for the key in the default registry.
+func LockShm(key int64) (err error) {
+	// Find the attached segment for the given key
+	var sg *Vsegment
+	sg, err = defaultRegistry.Segment(key)
+	if err != nil {
+		return
+	}
+
+	// Acquire the segment lock
+	err = sg.Lock()
+
+	// Return the error value
+	return
+}
+
+// TryLockShm acquires the lock of the segment registered for the key in the default registry without waiting.
+func TryLockShm(key int64) (err error) {
+	// Find the attached segment for the given key
+	var sg *Vsegment
+	sg, err = defaultRegistry.Segment(key)
+	if err != nil {
+		return
+	}
+
+	// Try to acquire the segment lock
+	err = sg.TryLock()
+
+	// Return the error value
+	return
+}
+
+// UnlockShm releases the lock of the segment registered for the key in the default registry.
+func UnlockShm(key int64) (err error) {
+	// Find the attached segment for the given key
+	var sg *Vsegment
+	sg, err = defaultRegistry.Segment(key)
+	if err != nil {
+		return
+	}
+
+	// Release the segment lock
+	err = sg.Unlock()
+
+	// Return the error value
+	return
+}
@@ -0,0 +1,302 @@
+package shm
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The lockWriterEnv environment variable turns the test binary into a writer process for Test_Check_Shm_Lock_Function
+const lockWriterEnv = "FILEBASEZ_LOCK_WRITER_KEY"
+
+// lockWriterRows is the number of rows every writer process appends
+const lockWriterRows = 200
+
+// The lockHolderEnv environment variable turns the test binary into a process which dies while holding the lock
+const lockHolderEnv = "FILEBASEZ_LOCK_HOLDER_KEY"
+
+// processBackend returns the backend shared with the child processes, MemoryBackend is only seen by this process.
+func processBackend() (backend Backend) {
+	backend = defaultBackend
+	if _, ok := backend.(MemoryBackend); ok {
+		backend = PosixBackend{}
+	}
+	return
+}
+
+// startLockHolder starts a process which opens the segment, locks it and exits after the delay without unlocking it.
+func startLockHolder(t *testing.T, key int64, delay time.Duration) (cmd *exec.Cmd) {
+	cmd = exec.Command(os.Args[0], "-test.run=^Test_Check_Shm_Lock_Holder$")
+	cmd.Env = append(os.Environ(), lockHolderEnv+"="+strconv.FormatInt(key, 10), "FILEBASEZ_LOCK_HOLDER_DELAY="+delay.String())
+	require.NoError(t, cmd.Start())
+	return
+}
+
+/*
+Test_Check_Shm_Lock_Function checks the segment lock,
+including Lock, TryLock and Unlock, and appends from several processes at the same time.
+*/
+func Test_Check_Shm_Lock_Function(t *testing.T) {
+	// Lock, try to lock and unlock a segment
+	t.Run("lock, try lock and unlock", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 12
+
+		// Create a new shared memory segment with Key=testShmKey and Size=1024
+		err := NewShm(Vopts{Key: testShmKey, Size: 1024})
+		require.NoError(t, err)
+
+		// Delete the shared memory segment with Key=testShmKey
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+
+		// Unlocking a free lock is refused
+		err = UnlockShm(testShmKey)
+		require.ErrorIs(t, err, ErrShmNotLocked)
+
+		// The lock can only be taken once
+		err = LockShm(testShmKey) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		require.NoError(t, err)
+		err = TryLockShm(testShmKey)
+		require.ErrorIs(t, err, ErrShmLocked)
+
+		// A waiter sleeps until the lock is released
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err1 := LockShm(testShmKey)
+			require.NoError(t, err1)
+			err1 = UnlockShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		err = UnlockShm(testShmKey)
+		require.NoError(t, err)
+		wg.Wait()
+
+		// The lock is free again
+		err = TryLockShm(testShmKey)
+		require.NoError(t, err)
+		err = UnlockShm(testShmKey)
+		require.NoError(t, err)
+
+		// A lock owned by another living process can not be released
+		sg, err := Segment(testShmKey)
+		require.NoError(t, err)
+		word, err := sg.lockWord()
+		require.NoError(t, err)
+		*word = uint32(os.Getppid()) | lockPid&^lockPidMask
+		err = UnlockShm(testShmKey)
+		require.ErrorIs(t, err, ErrLockNotOwner)
+		err = TryLockShm(testShmKey)
+		require.ErrorIs(t, err, ErrShmLocked)
+
+		// The PID of an owner in another PID namespace can not be checked, so its lock is never taken over
+		otherNamespace := ((lockPid>>lockNamespaceShift)%511 + 1) << lockNamespaceShift
+		require.False(t, ownerAlive(lockPidMask|lockPid&^lockPidMask))
+		require.True(t, ownerAlive(lockPidMask|otherNamespace))
+		*word = lockPidMask | otherNamespace
+		err = TryLockShm(testShmKey)
+		require.ErrorIs(t, err, ErrShmLocked)
+		*word = lockUnlocked
+	})
+
+	// Take over the lock when the owner process dies while holding it
+	t.Run("recover the lock of a dead owner", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 14
+
+		// Create a new shared memory segment with Key=testShmKey and Size=1024, which the holder processes can open
+		err := NewShm(Vopts{Key: testShmKey, Size: 1024, Backend: processBackend()})
+		require.NoError(t, err)
+
+		// Delete the shared memory segment with Key=testShmKey
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+
+		// TryLock takes over the lock after the holder died
+		holder := startLockHolder(t, testShmKey, 0)
+		require.NoError(t, holder.Wait())
+		err = TryLockShm(testShmKey) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		require.ErrorIs(t, err, ErrLockOwnerDied)
+		err = UnlockShm(testShmKey)
+		require.NoError(t, err)
+
+		// Lock sleeps while the holder is alive, and takes over the lock when it dies
+		holder = startLockHolder(t, testShmKey, 300*time.Millisecond)
+		for TryLockShm(testShmKey) == nil {
+			// The holder has not locked the segment yet
+			require.NoError(t, UnlockShm(testShmKey))
+			time.Sleep(time.Millisecond)
+		}
+		err = LockShm(testShmKey)
+		require.ErrorIs(t, err, ErrLockOwnerDied)
+		require.NoError(t, holder.Wait())
+		err = UnlockShm(testShmKey)
+		require.NoError(t, err)
+
+		// Writes check the offset left by the dead holder and go on
+		holder = startLockHolder(t, testShmKey, 0)
+		require.NoError(t, holder.Wait())
+		err = OverwriteOrAppendInt32sByShift(testShmKey, DefualtMinShmSize, true, 1, 2, 3)
+		require.NoError(t, err)
+		values := make([]int32, 3)
+		err = ReadRowInInt32s(testShmKey, 0, values)
+		require.NoError(t, err)
+		require.Equal(t, []int32{1, 2, 3}, values)
+		err = TryLockShm(testShmKey)
+		require.NoError(t, err)
+		err = UnlockShm(testShmKey)
+		require.NoError(t, err)
+	})
+
+	// The holder of the lock can not overwrite through its handle, the overwrite would wait for its own process
+	t.Run("overwrite while locked", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 68
+
+		// Create a segment with some values, and lock it
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 16, Backend: MemoryBackend{}})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		err = AppendInt32s(testShmKey, 1, 2)
+		require.NoError(t, err)
+		err = LockShm(testShmKey)
+		require.NoError(t, err)
+
+		// The overwrites and the cursor writes refuse the lock of their own handle
+		err = OverwriteOrAppendInt32sByShift(testShmKey, DefualtMinShmSize, false, 3) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		require.ErrorIs(t, err, ErrShmLocked)
+		sg, err := Segment(testShmKey)
+		require.NoError(t, err)
+		cursor, err := sg.Cursor()
+		require.NoError(t, err)
+		_, err = cursor.Write([]byte{3, 0, 0, 0})
+		require.ErrorIs(t, err, ErrShmLocked)
+
+		// Once the lock is released, the overwrites take it themselves
+		err = UnlockShm(testShmKey)
+		require.NoError(t, err)
+		err = OverwriteOrAppendInt32sByShift(testShmKey, DefualtMinShmSize, false, 3)
+		require.NoError(t, err)
+		_, err = cursor.WriteAt([]byte{4, 0, 0, 0}, 4)
+		require.NoError(t, err)
+		values := make([]int32, 2)
+		err = ReadRowInInt32s(testShmKey, 0, values)
+		require.NoError(t, err)
+		require.Equal(t, []int32{3, 4}, values)
+	})
+
+	// Append rows from several processes, every row must stay intact
+	t.Run("append from several processes", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 13
+
+		// Every writer appends lockWriterRows rows of four int32 values
+		writers := 4
+		opts := Vopts{
+			Key:     testShmKey,
+			Size:    DefualtMinShmSize + int64(writers*lockWriterRows*16),
+			Backend: processBackend(),
+		}
+		err := NewShm(opts)
+		require.NoError(t, err)
+
+		// Delete the shared memory segment with Key=testShmKey
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+
+		// Start the writer processes, they run Test_Check_Shm_Lock_Writer in the test binary
+		commands := make([]*exec.Cmd, 0, writers)
+		for i := 1; i <= writers; i++ {
+			cmd := exec.Command(os.Args[0], "-test.run=^Test_Check_Shm_Lock_Writer$")
+			cmd.Env = append(os.Environ(), lockWriterEnv+"="+strconv.FormatInt(testShmKey, 10), "FILEBASEZ_LOCK_WRITER_ID="+strconv.Itoa(i))
+			require.NoError(t, cmd.Start())
+			commands = append(commands, cmd)
+		}
+		for _, cmd := range commands {
+			require.NoError(t, cmd.Wait())
+		}
+
+		// The offset has been advanced by every row
+		offset, err := ReadOffset(testShmKey)
+		require.NoError(t, err)
+		require.Equal(t, opts.Size, offset)
+
+		// Every row holds four copies of the writer id, and every writer wrote all of its rows
+		counts := make(map[int32]int)
+		row := make([]int32, 4)
+		for shift := int64(0); shift < offset-DefualtMinShmSize; shift += 16 {
+			err = ReadRowInInt32s(testShmKey, shift, row)
+			require.NoError(t, err)
+			require.Equal(t, []int32{row[0], row[0], row[0], row[0]}, row)
+			counts[row[0]]++
+		}
+		for i := 1; i <= writers; i++ {
+			require.Equal(t, lockWriterRows, counts[int32(i)])
+		}
+	})
+}
+
+// Test_Check_Shm_Lock_Writer is a writer process for Test_Check_Shm_Lock_Function, it does nothing when run directly.
+func Test_Check_Shm_Lock_Writer(t *testing.T) {
+	// Only run as a writer process
+	if os.Getenv(lockWriterEnv) == "" {
+		return
+	}
+	key, err := strconv.ParseInt(os.Getenv(lockWriterEnv), 10, 64)
+	require.NoError(t, err)
+	id, err := strconv.Atoi(os.Getenv("FILEBASEZ_LOCK_WRITER_ID"))
+	require.NoError(t, err)
+
+	// Open the segment created by the parent process
+	err = OpenShmWithOpts(Vopts{Key: key, Backend: processBackend()})
+	require.NoError(t, err)
+	defer func() {
+		err1 := CloseShm(key)
+		require.NoError(t, err1)
+	}()
+
+	// Append the rows, the reservation of the offset keeps them from overlapping
+	v := int32(id)
+	for i := 0; i < lockWriterRows; i++ {
+		err = AppendInt32s(key, v, v, v, v)
+		require.NoError(t, err)
+	}
+}
+
+// Test_Check_Shm_Lock_Holder is a process for Test_Check_Shm_Lock_Function which dies while holding the lock, it does nothing when run directly.
+func Test_Check_Shm_Lock_Holder(t *testing.T) {
+	// Only run as a holder process
+	if os.Getenv(lockHolderEnv) == "" {
+		return
+	}
+	key, err := strconv.ParseInt(os.Getenv(lockHolderEnv), 10, 64)
+	require.NoError(t, err)
+	delay, err := time.ParseDuration(os.Getenv("FILEBASEZ_LOCK_HOLDER_DELAY"))
+	require.NoError(t, err)
+
+	// Open the segment created by the parent process and lock it
+	err = OpenShmWithOpts(Vopts{Key: key, Backend: processBackend()})
+	require.NoError(t, err)
+	err = LockShm(key)
+	require.NoError(t, err)
+
+	// Die without unlocking the segment
+	time.Sleep(delay)
+	os.Exit(0)
+}
@@ -0,0 +1,153 @@
+package shm
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+/*
+MemoryBackend keeps the segments in Go byte slices inside the process, without any system call.
+Every MemoryBackend value shares the same segments, so a key created through one registry can be opened through another,
+but other processes can not see them, and they are gone when the process exits, even when a test panics before deleting them.
+It implements the same operations as the other backends, so NewShm, InfoShm, AppendInt32s, ReadRowInInt32s and the lock work the same way.
+*/
+type MemoryBackend struct{}
+
+// memorySegment is a segment kept by MemoryBackend
+type memorySegment struct {
+	id  int64
+	mem []byte
+}
+
+// memoryStore holds the segments of MemoryBackend by key
+var memoryStore = struct {
+	mu       sync.Mutex
+	lastId   int64
+	segments map[int64]*memorySegment
+}{
+	segments: make(map[int64]*memorySegment),
+}
+
+// Create allocates a zeroed segment, following the create and exclusive flags like shmget.
+func (MemoryBackend) Create(key, size int64, flag VsysFlags, perm os.FileMode) (id int64, err error) {
+	// Huge pages and the swap reservation are options of shmget, Go memory can not be allocated with them
+	if flag&(StatusHugePages|StatusNoReserve) != 0 {
+		err = opError("create", key, 0, nil, ErrUnsupportedFlag)
+		return
+	}
+
+	memoryStore.mu.Lock()
+	defer memoryStore.mu.Unlock()
+
+	// An existing segment is returned unless the exclusive flag is given
+	if segment := memoryStore.segments[key]; segment != nil {
+		if flag&StatusIpcExclusive != 0 {
+			err = opError("create", key, 0, syscall.EEXIST, nil)
+			return
+		}
+		id = segment.id
+		return
+	}
+
+	// Nothing is created without the create flag
+	if flag&StatusIpcCreate == 0 {
+		err = opError("create", key, 0, syscall.ENOENT, ErrShmNotExist)
+		return
+	}
+
+	// A segment needs at least one byte
+	if size <= 0 {
+		err = opError("create", key, 0, syscall.EINVAL, nil)
+		return
+	}
+
+	// Allocate the memory as 64-bit words, so the atomic fields and the futex word in the header are aligned like in a mapped page
+	words := make([]uint64, (size+7)/8)
+	mem := unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), size)
+
+	// Store the segment with a new id, the id is never 0
+	memoryStore.lastId++
+	id = memoryStore.lastId
+	memoryStore.segments[key] = &memorySegment{
+		id:  id,
+		mem: mem,
+	}
+
+	// Return the id
+	return
+}
+
+// Open resolves the id of an existing segment.
+func (MemoryBackend) Open(key int64) (id int64, err error) {
+	memoryStore.mu.Lock()
+	defer memoryStore.mu.Unlock()
+
+	// Find the segment
+	segment := memoryStore.segments[key]
+	if segment == nil {
+		err = opError("open", key, 0, syscall.ENOENT, ErrShmNotExist)
+		return
+	}
+
+	// Return the id
+	id = segment.id
+	return
+}
+
+// Attach returns the memory of the segment, every attachment shares the same memory.
+func (MemoryBackend) Attach(key, id, size int64) (mem []byte, err error) {
+	memoryStore.mu.Lock()
+	defer memoryStore.mu.Unlock()
+
+	// Find the segment with the id
+	segment := memoryStore.segments[key]
+	if segment == nil || segment.id != id || int64(len(segment.mem)) < size {
+		err = opError("attach", key, id, nil, ErrShmAttach)
+		return
+	}
+
+	// Return the memory limited to the size
+	mem = segment.mem[:size:size]
+	return
+}
+
+// Detach does nothing, the memory is freed by the garbage collector after the segment is removed and no longer used.
+func (MemoryBackend) Detach(mem []byte) (err error) {
+	return
+}
+
+// Stat returns the size of the segment.
+func (MemoryBackend) Stat(key, id int64) (size int64, err error) {
+	memoryStore.mu.Lock()
+	defer memoryStore.mu.Unlock()
+
+	// Find the segment with the id
+	segment := memoryStore.segments[key]
+	if segment == nil || segment.id != id {
+		err = opError("stat", key, id, nil, ErrFailToRetrieveShmSize)
+		return
+	}
+
+	// Return the size
+	size = int64(len(segment.mem))
+	return
+}
+
+// Remove forgets the segment, the memory which is still attached stays usable until it is no longer used.
+func (MemoryBackend) Remove(key, id int64) (err error) {
+	memoryStore.mu.Lock()
+	defer memoryStore.mu.Unlock()
+
+	// Find the segment with the id, so a recreated segment is not removed
+	segment := memoryStore.segments[key]
+	if segment == nil || segment.id != id {
+		err = opError("remove", key, id, syscall.ENOENT, ErrShmNotExist)
+		return
+	}
+
+	// Forget the segment
+	delete(memoryStore.segments, key)
+	return
+}
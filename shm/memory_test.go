@@ -0,0 +1,62 @@
+package shm
+
+import (
+	"github.com/stretchr/testify/require"
+	"syscall"
+	"testing"
+)
+
+// Test_Check_Shm_Memory_Backend checks segments kept in Go byte slices inside the process.
+func Test_Check_Shm_Memory_Backend(t *testing.T) {
+	// The testShmKey is the shared memory key for testing
+	var testShmKey int64 = 23
+
+	// Create a new in-process segment with Key=testShmKey and Size=DefualtMinShmSize+16
+	opts := Vopts{
+		Key:     testShmKey,
+		Size:    DefualtMinShmSize + 16,
+		Backend: MemoryBackend{},
+	}
+	err := NewShm(opts) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+	require.NoError(t, err)
+
+	// The same key can not be created twice
+	err = NewRegistry().NewShm(opts)
+	require.ErrorIs(t, err, syscall.EEXIST)
+
+	// The extension functions work on the segment
+	info, err := InfoShm(testShmKey)
+	require.NoError(t, err)
+	require.Equal(t, MajorVersion, info.Major)
+	require.Equal(t, int64(DefualtMinShmSize+16), info.Size)
+	require.Equal(t, int64(DefualtMinShmSize), info.Offset)
+	err = AppendInt32s(testShmKey, 1, 2)
+	require.NoError(t, err)
+	err = OverwriteOrAppendInt32sByShift(testShmKey, DefualtMinShmSize+8, true, 3)
+	require.NoError(t, err)
+
+	// Another registry opens the same memory
+	reader := NewRegistry()
+	err = reader.OpenShmWithOpts(Vopts{Key: testShmKey, Backend: MemoryBackend{}})
+	require.NoError(t, err)
+	sg, err := reader.Segment(testShmKey)
+	require.NoError(t, err)
+	values := make([]int32, 3)
+	err = sg.ReadRowInInt32s(0, values)
+	require.NoError(t, err)
+	require.Equal(t, []int32{1, 2, 3}, values)
+	err = sg.Lock()
+	require.NoError(t, err)
+	err = TryLockShm(testShmKey)
+	require.ErrorIs(t, err, ErrShmLocked)
+	err = sg.Unlock()
+	require.NoError(t, err)
+	err = reader.CloseShm(testShmKey)
+	require.NoError(t, err)
+
+	// Deleting the segment forgets it
+	err = DeleteShm(testShmKey)
+	require.NoError(t, err)
+	err = NewRegistry().OpenShmWithOpts(Vopts{Key: testShmKey, Backend: MemoryBackend{}})
+	require.ErrorIs(t, err, ErrShmNotExist)
+}
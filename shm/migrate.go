@@ -0,0 +1,154 @@
+package shm
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+)
+
+/*
+The headers written before 2.0 have no magic number, they start with the version:
+
+	 0:6   major, minor and patch versions
+	 6:14  key
+	14:22  id
+	22:30  size
+	30:34  flag
+	34:38  parameter
+	38:46  offset
+	46:50  type, never written
+
+The data starts right after the header, at byte 50.
+*/
+
+// the layout of the versions before 2.0
+const (
+	legacyMajorVersion uint16 = 1
+	legacyShmSize             = 2 + 2 + 2 + 8 + 8 + 8 + 4 + 4 + 8 + 4 // version, key, id, size, flag, parameter, offset and type
+)
+
+/*
+Migrate rewrites the header of the segment for the key to the layout of the running library version, and records the type in it.
+The headers before 2.0 do not tell which data structure the segment holds, so the caller passes it,
+TypeSpeedyArrayInt32 for the segments of speedyArray.SpdArrayInt32 and TypeRaw for the values written by the extension functions.
+The data is moved behind the larger header in place when the segment has enough free space after the offset,
+otherwise the segment is replaced by a segment grown by the difference, see Replacer for how the old data is kept until then.
+Segments which already have the current layout are left as they are.
+The segment must not be used by any process while it is migrated, and it is not registered afterwards, so OpenShm it as usual.
+*/
+func Migrate(key int64, typ VshmType) (err error) {
+	err = MigrateWithOpts(Vopts{Key: key, Type: typ})
+	return
+}
+
+// MigrateWithOpts migrates the segment like Migrate, using the key, the backend and the type in the options.
+func MigrateWithOpts(opts Vopts) (err error) {
+	defer wrapError(&err, "Migrate", opts.Key, 0)
+
+	// Check if the key can be used
+	err = checkKey(opts.Key)
+	if err != nil {
+		return
+	}
+
+	// Attach the segment without validating its header
+	sg, err := openShmWithKey(opts)
+	if err != nil {
+		return
+	}
+	defer func() {
+		err1 := sg.Close()
+		if err == nil {
+			err = err1
+		}
+	}()
+
+	// Segments with the magic number already have the current layout, or a layout of a newer major version
+	if sg.size >= DefualtMinShmSize && string(sg.mem[0:4]) == ShmMagic {
+		err = validateInfo(sg)
+		return
+	}
+
+	// Find the offset of the old layout
+	offset, err := legacyOffset(sg)
+	if err != nil {
+		return
+	}
+
+	// The data moves by the difference between the header sizes, in place when it fits
+	growth := int64(DefualtMinShmSize - legacyShmSize)
+	if offset+growth <= sg.size {
+		err = migrateInto(sg, sg.mem[legacyShmSize:offset], opts)
+		return
+	}
+
+	// Otherwise write the new header and the data into a larger segment, or put the old header and data back when it fails
+	opts.Size = sg.size + growth
+	opts.Mode = parameterMode(sg.mem[34:38])
+	next, err := sg.replaceShmWithKey(opts.withCreationFlags(), func(next *Vsegment) error {
+		return migrateInto(next, sg.mem[legacyShmSize:offset], opts)
+	}, func(next *Vsegment) error {
+		copy(next.mem, sg.mem)
+		binary.LittleEndian.PutUint64(next.mem[14:22], uint64(next.headerId()))
+		return nil
+	})
+	if next != nil {
+		err1 := next.Close()
+		if err == nil {
+			err = err1
+		}
+	}
+
+	// Return the error value
+	return
+}
+
+// migrateInto writes the data behind the current header of the segment, then the header itself, and moves the offset with the data.
+func migrateInto(segment *Vsegment, data []byte, opts Vopts) (err error) {
+	// Move the data behind the new header, copy handles the overlap, then clear the old header
+	end := DefualtMinShmSize + int64(len(data))
+	copy(segment.mem[DefualtMinShmSize:end], data)
+	for i := 0; i < DefualtMinShmSize; i++ {
+		segment.mem[i] = 0
+	}
+
+	// Write the new header, and move the offset to the end of the data
+	err = segment.initWithId(opts)
+	if err != nil {
+		return
+	}
+	atomic.StoreUint64(segment.offsetWord(), uint64(end))
+
+	// Return the error value
+	return
+}
+
+/*
+legacyOffset checks the header of a version before 2.0, and returns where its data ends.
+Segments which do not hold such a header are refused with ErrForeignShm.
+*/
+func legacyOffset(segment *Vsegment) (offset int64, err error) {
+	// The header must fit in the segment, and it must start with a 1.x version
+	if segment.size < legacyShmSize || binary.LittleEndian.Uint16(segment.mem[0:2]) != legacyMajorVersion {
+		err = ErrForeignShm
+		return
+	}
+
+	// Check that the header describes this segment
+	key := int64(binary.LittleEndian.Uint64(segment.mem[6:14]))
+	id := int64(binary.LittleEndian.Uint64(segment.mem[14:22]))
+	size := int64(binary.LittleEndian.Uint64(segment.mem[22:30]))
+	if key != segment.key || id != segment.headerId() || size != segment.size {
+		err = ErrInvalidShmHeader
+		return
+	}
+
+	// Check that the offset stays between the header and the end of the segment
+	offset = int64(binary.LittleEndian.Uint64(segment.mem[38:46]))
+	if offset < legacyShmSize || offset > segment.size {
+		err = ErrInvalidShmHeader
+		return
+	}
+
+	// Return the offset
+	return
+}
@@ -0,0 +1,162 @@
+package shm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+// newLegacyShm creates a segment with the key, the size and the backend of the options, holding a header of version 1.minor and the values,
+// as the versions before 2.0 wrote them.
+func newLegacyShm(t *testing.T, opts Vopts, minor uint16, values ...int32) {
+	// Create a segment without any header
+	sg, err := newWithReturnId(opts)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, sg.Close())
+	}()
+
+	// Write the header of the old layout
+	headerSize := int64(legacyShmSize)
+	binary.LittleEndian.PutUint16(sg.mem[0:2], 1)
+	binary.LittleEndian.PutUint16(sg.mem[2:4], minor)
+	binary.LittleEndian.PutUint64(sg.mem[6:14], uint64(sg.key))
+	binary.LittleEndian.PutUint64(sg.mem[14:22], uint64(sg.headerId()))
+	binary.LittleEndian.PutUint64(sg.mem[22:30], uint64(sg.size))
+	binary.LittleEndian.PutUint32(sg.mem[30:34], uint32(StatusIpcCreate|StatusIpcExclusive))
+	copy(sg.mem[34:38], []byte{0, 6, 0, 0})
+	binary.LittleEndian.PutUint64(sg.mem[38:46], uint64(headerSize+int64(len(values))*4))
+
+	// Write the values right after the header
+	for i, value := range values {
+		binary.LittleEndian.PutUint32(sg.mem[headerSize+int64(i)*4:], uint32(value))
+	}
+}
+
+// Test_Check_Shm_Migrate_Function checks that the headers of older versions are rewritten to the current layout.
+func Test_Check_Shm_Migrate_Function(t *testing.T) {
+	// A 1.2 header is rewritten in place, when there is room to move the data
+	t.Run("migrate in place", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 25
+		opts := Vopts{Key: testShmKey, Backend: MemoryBackend{}}
+		newLegacyShm(t, Vopts{Key: testShmKey, Size: 1024, Backend: MemoryBackend{}}, 2, 1, 2, 3)
+
+		// The old header can not be opened, it has to be migrated first
+		err := OpenShmWithOpts(opts)
+		require.ErrorIs(t, err, ErrIncompatibleVersion)
+		err = MigrateWithOpts(opts) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		require.NoError(t, err)
+
+		// The segment opens with the current header, and the data moved with the offset
+		err = OpenShmWithOpts(opts)
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		info, err := InfoShm(testShmKey)
+		require.NoError(t, err)
+		require.Equal(t, MajorVersion, info.Major)
+		require.Equal(t, int64(1024), info.Size)
+		require.Equal(t, int64(DefualtMinShmSize+12), info.Offset)
+		values := make([]int32, 3)
+		err = ReadRowInInt32s(testShmKey, 0, values)
+		require.NoError(t, err)
+		require.Equal(t, []int32{1, 2, 3}, values)
+
+		// Migrating the current header changes nothing
+		err = MigrateWithOpts(opts)
+		require.NoError(t, err)
+		info, err = InfoShm(testShmKey)
+		require.NoError(t, err)
+		require.Equal(t, int64(DefualtMinShmSize+12), info.Offset)
+	})
+
+	// A full segment is replaced by a larger one, beside it with the file backend and after removing it with the others
+	for _, backend := range []Backend{MemoryBackend{}, FileBackend{Dir: t.TempDir()}} {
+		t.Run(fmt.Sprintf("migrate into a larger segment with %T", backend), func(t *testing.T) {
+			// The testShmKey is the shared memory key for testing
+			var testShmKey int64 = 26
+			opts := Vopts{Key: testShmKey, Backend: backend, Type: TypeSpeedyArrayInt32}
+			newLegacyShm(t, Vopts{Key: testShmKey, Size: legacyShmSize + 12, Backend: backend}, 2, 4, 5, 6)
+
+			// Migrate the segment and record the type
+			err := MigrateWithOpts(opts)
+			require.NoError(t, err)
+
+			// The segment grew by the difference between the header sizes
+			err = OpenShmWithOpts(opts)
+			require.NoError(t, err)
+			defer func() {
+				err1 := DeleteShm(testShmKey)
+				require.NoError(t, err1)
+			}()
+			info, err := InfoShm(testShmKey)
+			require.NoError(t, err)
+			require.Equal(t, int64(DefualtMinShmSize+12), info.Size)
+			require.Equal(t, int64(DefualtMinShmSize+12), info.Offset)
+			require.Equal(t, int32(TypeSpeedyArrayInt32), info.Type)
+			values := make([]int32, 3)
+			err = ReadRowInInt32s(testShmKey, 0, values)
+			require.NoError(t, err)
+			require.Equal(t, []int32{4, 5, 6}, values)
+		})
+	}
+
+	// A larger segment which can not be filled leaves the old segment in place
+	t.Run("keep the old segment when the larger one fails", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 58
+		backend := FileBackend{Dir: t.TempDir()}
+		newLegacyShm(t, Vopts{Key: testShmKey, Size: legacyShmSize + 12, Backend: backend}, 2, 7, 8, 9)
+
+		// The larger segment is discarded when it can not be filled
+		sg, err := openShmWithKey(Vopts{Key: testShmKey, Backend: backend})
+		require.NoError(t, err)
+		_, err = sg.replaceShmWithKey(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 12, Backend: backend}, func(next *Vsegment) error {
+			return ErrInvalidShmHeader
+		}, nil)
+		require.ErrorIs(t, err, ErrInvalidShmHeader)
+		require.NoError(t, sg.Close())
+
+		// The old header and data are still there, and migrate afterwards
+		err = MigrateWithOpts(Vopts{Key: testShmKey, Backend: backend, Type: TypeRaw})
+		require.NoError(t, err)
+		err = OpenShmWithOpts(Vopts{Key: testShmKey, Backend: backend})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		values := make([]int32, 3)
+		err = ReadRowInInt32s(testShmKey, 0, values)
+		require.NoError(t, err)
+		require.Equal(t, []int32{7, 8, 9}, values)
+		entries, err := os.ReadDir(backend.Dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	})
+
+	// Segments which were never written by filebasez are refused
+	t.Run("refuse foreign segments", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 27
+
+		// Create a segment without any header
+		sg, err := newWithReturnId(Vopts{Key: testShmKey, Size: 1024, Backend: MemoryBackend{}})
+		require.NoError(t, err)
+		defer func() {
+			err1 := sg.deleteWithId()
+			require.NoError(t, err1)
+		}()
+
+		// Nothing is migrated
+		err = MigrateWithOpts(Vopts{Key: testShmKey, Backend: MemoryBackend{}})
+		require.ErrorIs(t, err, ErrForeignShm)
+		err = MigrateWithOpts(Vopts{Key: testShmKey + 1, Backend: MemoryBackend{}})
+		require.ErrorIs(t, err, ErrShmNotExist)
+	})
+}
@@ -0,0 +1,313 @@
+package shm
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+/*
+mappedFile keeps every segment in a file named "filebasez.<key>" in its directory, and maps it with mmap and MAP_SHARED,
+so every process mapping the file sees the same memory. PosixBackend and FileBackend only differ in the directory and the header id.
+The id of a segment is the inode number of its file, which tells a removed and recreated segment from the one which was attached.
+*/
+type mappedFile struct {
+	dir string
+}
+
+// mappedOpenFlags are the flags shm_open uses to open a segment for reading and writing
+const mappedOpenFlags = syscall.O_RDWR | syscall.O_NOFOLLOW | syscall.O_CLOEXEC
+
+// path returns the path of the file of the segment for the key.
+func (receive mappedFile) path(key int64) (path string) {
+	path = filepath.Join(receive.dir, "filebasez."+strconv.FormatInt(key, 10))
+	return
+}
+
+// idOf returns the id of the segment whose file has the stat.
+func (receive mappedFile) idOf(key int64, stat *syscall.Stat_t) (id int64) {
+	id = int64(stat.Ino)
+	return
+}
+
+// create creates the file of the segment and grows it to the size with ftruncate.
+func (receive mappedFile) create(key, size int64, flag VsysFlags, perm os.FileMode) (id int64, err error) {
+	// Huge pages and the swap reservation are options of shmget, a file can not be created with them
+	if flag&(StatusHugePages|StatusNoReserve) != 0 {
+		err = opError("open", key, 0, nil, ErrUnsupportedFlag)
+		return
+	}
+
+	// Translate the shmget flags into the open flags
+	mode := mappedOpenFlags
+	if flag&StatusIpcCreate != 0 {
+		mode |= syscall.O_CREAT
+	}
+	if flag&StatusIpcExclusive != 0 {
+		mode |= syscall.O_EXCL
+	}
+
+	// Unless otherwise specified, segment is owner-read/write (no exec)
+	if perm == 0 {
+		perm = defaultShmPermission
+	}
+
+	// Open the file of the segment
+	var fd int
+	fd, err = syscall.Open(receive.path(key), mode, uint32(perm.Perm()))
+	if err != nil {
+		err = opError("open", key, 0, err, nil)
+		return
+	}
+	defer func() {
+		_ = syscall.Close(fd)
+	}()
+
+	// Grow the file to the size, a new file is empty
+	var stat syscall.Stat_t
+	err = syscall.Fstat(fd, &stat)
+	if err != nil {
+		err = opError("fstat", key, 0, err, nil)
+		return
+	}
+	if stat.Size == 0 {
+		// The umask of the process is applied by open, so set the permissions of the new file again, like shmget does not apply it
+		err = syscall.Fchmod(fd, uint32(perm.Perm()))
+		if err != nil {
+			err = opError("fchmod", key, 0, err, nil)
+			return
+		}
+	}
+	if stat.Size < size {
+		err = syscall.Ftruncate(fd, size)
+		if err != nil {
+			err = opError("ftruncate", key, 0, err, nil)
+			return
+		}
+	}
+
+	// Return the id
+	id = receive.idOf(key, &stat)
+	return
+}
+
+// preparedPath returns the path of the file which is prepared to replace the segment for the key, see Replacer.
+func (receive mappedFile) preparedPath(key int64) (path string) {
+	path = receive.path(key) + ".new"
+	return
+}
+
+// prepare creates the file which replaces the segment for the key, grows it to the size and maps it.
+func (receive mappedFile) prepare(key, size int64, perm os.FileMode) (id int64, mem []byte, err error) {
+	// A file left by an interrupted replacement is not used by anybody, so start over
+	path := receive.preparedPath(key)
+	_ = syscall.Unlink(path)
+
+	// Unless otherwise specified, segment is owner-read/write (no exec)
+	if perm == 0 {
+		perm = defaultShmPermission
+	}
+
+	// Create the file, and remove it again when it can not be used
+	fd, err := syscall.Open(path, mappedOpenFlags|syscall.O_CREAT|syscall.O_EXCL, uint32(perm.Perm()))
+	if err != nil {
+		err = opError("open", key, 0, err, nil)
+		return
+	}
+	defer func() {
+		_ = syscall.Close(fd)
+		if err != nil {
+			_ = syscall.Unlink(path)
+		}
+	}()
+
+	// Set the permissions again without the umask, and grow the file to the size
+	err = syscall.Fchmod(fd, uint32(perm.Perm()))
+	if err != nil {
+		err = opError("fchmod", key, 0, err, nil)
+		return
+	}
+	err = syscall.Ftruncate(fd, size)
+	if err != nil {
+		err = opError("ftruncate", key, 0, err, nil)
+		return
+	}
+
+	// Find the id of the file
+	var stat syscall.Stat_t
+	err = syscall.Fstat(fd, &stat)
+	if err != nil {
+		err = opError("fstat", key, 0, err, nil)
+		return
+	}
+	id = receive.idOf(key, &stat)
+
+	// Map the whole file
+	mem, err = syscall.Mmap(fd, 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		err = opError("mmap", key, id, err, ErrShmAttach)
+		return
+	}
+
+	// Return the id and the attached memory
+	return
+}
+
+// replace renames the prepared file over the file of the segment for the key, and syncs the directory, so the rename reaches the disk.
+func (receive mappedFile) replace(key, id int64) (err error) {
+	// Check that the prepared file is still the one with the id
+	var stat syscall.Stat_t
+	err = syscall.Stat(receive.preparedPath(key), &stat)
+	if err != nil || receive.idOf(key, &stat) != id {
+		err = opError("stat", key, id, err, ErrShmNotExist)
+		return
+	}
+
+	// Put the prepared file in place, the file it replaces is unlinked by the rename
+	err = syscall.Rename(receive.preparedPath(key), receive.path(key))
+	if err != nil {
+		err = opError("rename", key, id, err, nil)
+		return
+	}
+
+	// Write the directory entry back to the disk, the file is in place already, so this is done on a best effort basis
+	dir := receive.dir
+	if dir == "" {
+		dir = "."
+	}
+	if fd, err1 := syscall.Open(dir, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0); err1 == nil {
+		_ = syscall.Fsync(fd)
+		_ = syscall.Close(fd)
+	}
+	return
+}
+
+// discard unlinks the prepared file for the key, when it is still the one with the id.
+func (receive mappedFile) discard(key, id int64) (err error) {
+	// Check that the prepared file is still the one with the id
+	var stat syscall.Stat_t
+	err = syscall.Stat(receive.preparedPath(key), &stat)
+	if err != nil || receive.idOf(key, &stat) != id {
+		err = opError("stat", key, id, err, ErrShmNotExist)
+		return
+	}
+
+	// Remove the file
+	err = syscall.Unlink(receive.preparedPath(key))
+	if err != nil {
+		err = opError("unlink", key, id, err, nil)
+	}
+	return
+}
+
+// open resolves the id of the file of an existing segment.
+func (receive mappedFile) open(key int64) (id int64, err error) {
+	// Find the file of the segment
+	var stat syscall.Stat_t
+	err = syscall.Stat(receive.path(key), &stat)
+	if err != nil {
+		// Only ENOENT means that there is no segment
+		var sentinel error
+		if err == syscall.ENOENT {
+			sentinel = ErrShmNotExist
+		}
+		err = opError("stat", key, 0, err, sentinel)
+		return
+	}
+
+	// Return the id
+	id = receive.idOf(key, &stat)
+	return
+}
+
+// attach maps the file of the segment with mmap and MAP_SHARED.
+func (receive mappedFile) attach(key, id, size int64) (mem []byte, err error) {
+	mem, err = receive.attachWith(key, id, size, false)
+	return
+}
+
+// attachReadOnly maps the file of the segment with mmap and MAP_SHARED for reading only.
+func (receive mappedFile) attachReadOnly(key, id, size int64) (mem []byte, err error) {
+	mem, err = receive.attachWith(key, id, size, true)
+	return
+}
+
+// attachWith maps the file of the segment, for reading only when readOnly is true.
+func (receive mappedFile) attachWith(key, id, size int64, readOnly bool) (mem []byte, err error) {
+	// Choose the open flags and the protection of the mapping
+	flags, prot := mappedOpenFlags, syscall.PROT_READ|syscall.PROT_WRITE
+	if readOnly {
+		flags, prot = mappedOpenFlags&^syscall.O_RDWR|syscall.O_RDONLY, syscall.PROT_READ
+	}
+
+	// Open the file of the segment
+	fd, err := syscall.Open(receive.path(key), flags, 0)
+	if err != nil {
+		err = opError("open", key, id, err, ErrShmAttach)
+		return
+	}
+	defer func() {
+		_ = syscall.Close(fd)
+	}()
+
+	// Check that the file is still the segment with the id
+	var stat syscall.Stat_t
+	err = syscall.Fstat(fd, &stat)
+	if err != nil || receive.idOf(key, &stat) != id || stat.Size < size {
+		err = opError("fstat", key, id, err, ErrShmAttach)
+		return
+	}
+
+	// Map the whole segment, the mapping stays valid after the file is closed
+	mem, err = syscall.Mmap(fd, 0, int(size), prot, syscall.MAP_SHARED)
+	if err != nil {
+		err = opError("mmap", key, id, err, ErrShmAttach)
+		return
+	}
+
+	// Return the attached memory
+	return
+}
+
+// detach unmaps the memory with munmap.
+func (receive mappedFile) detach(mem []byte) (err error) {
+	err = syscall.Munmap(mem)
+	if err != nil {
+		err = opError("munmap", 0, 0, err, nil)
+	}
+	return
+}
+
+// stat retrieves the size of the file of the segment.
+func (receive mappedFile) stat(key, id int64) (size int64, err error) {
+	// Find the file of the segment and check that it is still the segment with the id
+	var stat syscall.Stat_t
+	err = syscall.Stat(receive.path(key), &stat)
+	if err != nil || receive.idOf(key, &stat) != id {
+		err = opError("stat", key, id, err, ErrFailToRetrieveShmSize)
+		return
+	}
+
+	// Return the size
+	size = stat.Size
+	return
+}
+
+// remove unlinks the file of the segment, the memory is freed after the last mapping is removed.
+func (receive mappedFile) remove(key, id int64) (err error) {
+	// Check that the file is still the segment with the id, so a recreated segment is not removed
+	var stat syscall.Stat_t
+	err = syscall.Stat(receive.path(key), &stat)
+	if err != nil || receive.idOf(key, &stat) != id {
+		err = opError("stat", key, id, err, ErrShmNotExist)
+		return
+	}
+
+	// Remove the file
+	err = syscall.Unlink(receive.path(key))
+	if err != nil {
+		err = opError("unlink", key, id, err, nil)
+	}
+	return
+}
@@ -0,0 +1,135 @@
+package shm
+
+/*
+A pinned segment is kept in RAM by the kernel and never swapped out, which latency-sensitive readers rely on.
+Pinning belongs to the segment, not to the process, so it stays in effect after the process which pinned it detaches,
+until UnpinShm is called or the segment is destroyed.
+*/
+
+// Pinner is implemented by the backends whose segments can be pinned in RAM, PinShm and UnpinShm use it.
+type Pinner interface {
+	// Pin keeps the segment in RAM. It fails with syscall.EPERM without CAP_IPC_LOCK,
+	// and with syscall.ENOMEM when the pinned memory would exceed RLIMIT_MEMLOCK.
+	Pin(key, id int64) (err error)
+
+	// Unpin lets the kernel swap the segment out again.
+	Unpin(key, id int64) (err error)
+
+	// Pinned tells if the segment is pinned.
+	Pinned(key, id int64) (pinned bool, err error)
+}
+
+// error list for pinning
+const (
+	ErrPinUnsupported = Error("shm backend can not pin segments")
+)
+
+// pinner returns the backend of the segment as a Pinner, the caller has acquired the handle.
+func (receive *Vsegment) pinner() (pinner Pinner, err error) {
+	// Only the backends which implement Pinner can pin segments
+	var ok bool
+	pinner, ok = receive.backend.(Pinner)
+	if !ok {
+		err = ErrPinUnsupported
+	}
+
+	// Return the pinner
+	return
+}
+
+// Pin keeps the segment in RAM, see Pinner.Pin for the errors.
+func (receive *Vsegment) Pin() (err error) {
+	defer receive.wrapError(&err, "Pin")
+
+	// Keep the segment attached while it is used
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+
+	// Find the pinner of the backend
+	var pinner Pinner
+	pinner, err = receive.pinner()
+	if err != nil {
+		return
+	}
+
+	// Pin the segment
+	err = pinner.Pin(receive.key, receive.id)
+
+	// Return the error value
+	return
+}
+
+// Unpin lets the kernel swap the segment out again.
+func (receive *Vsegment) Unpin() (err error) {
+	defer receive.wrapError(&err, "Unpin")
+
+	// Keep the segment attached while it is used
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+
+	// Find the pinner of the backend
+	var pinner Pinner
+	pinner, err = receive.pinner()
+	if err != nil {
+		return
+	}
+
+	// Unpin the segment
+	err = pinner.Unpin(receive.key, receive.id)
+
+	// Return the error value
+	return
+}
+
+// pinned tells if the segment is pinned, segments of backends which can not pin are never pinned.
+func (receive *Vsegment) pinned() (pinned bool, err error) {
+	// Segments of backends which can not pin are never pinned
+	pinner, ok := receive.backend.(Pinner)
+	if !ok {
+		return
+	}
+
+	// Ask the backend
+	pinned, err = pinner.Pinned(receive.key, receive.id)
+
+	// Return the pinned state
+	return
+}
+
+// PinShm keeps the segment identified by a key in RAM, see Vsegment.Pin.
+func PinShm(key int64) (err error) {
+	// Find the attached segment for the given key
+	var sg *Vsegment
+	sg, err = defaultRegistry.Segment(key)
+	if err != nil {
+		return
+	}
+
+	// Pin the segment
+	err = sg.Pin()
+
+	// Return the error value
+	return
+}
+
+// UnpinShm lets the kernel swap the segment identified by a key out again, see Vsegment.Unpin.
+func UnpinShm(key int64) (err error) {
+	// Find the attached segment for the given key
+	var sg *Vsegment
+	sg, err = defaultRegistry.Segment(key)
+	if err != nil {
+		return
+	}
+
+	// Unpin the segment
+	err = sg.Unpin()
+
+	// Return the error value
+	return
+}
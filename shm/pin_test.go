@@ -0,0 +1,61 @@
+package shm
+
+import (
+	"github.com/stretchr/testify/require"
+	"syscall"
+	"testing"
+)
+
+// Test_Check_Shm_Pin_Function checks that segments are pinned in RAM and unpinned again, and that InfoShm reports it.
+func Test_Check_Shm_Pin_Function(t *testing.T) {
+	// The testShmKey is the shared memory key for testing
+	var testShmKey int64 = 32
+
+	// Create a new segment with Key=testShmKey and Size=DefualtMinShmSize
+	err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize})
+	require.NoError(t, err)
+	defer func() {
+		err1 := DeleteShm(testShmKey)
+		require.NoError(t, err1)
+	}()
+
+	// Only System V segments can be pinned
+	if _, ok := defaultBackend.(SysvBackend); !ok {
+		err = PinShm(testShmKey)
+		require.ErrorIs(t, err, ErrPinUnsupported)
+		return
+	}
+
+	// A new segment is not pinned
+	info, err := InfoShm(testShmKey)
+	require.NoError(t, err)
+	require.False(t, info.Pinned)
+
+	// Pin the segment, which needs CAP_IPC_LOCK or enough RLIMIT_MEMLOCK
+	err = PinShm(testShmKey) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+	if err == syscall.EPERM || err == syscall.ENOMEM {
+		t.Skipf("the process is not allowed to pin memory: %v", err)
+	}
+	require.NoError(t, err)
+	info, err = InfoShm(testShmKey)
+	require.NoError(t, err)
+	require.True(t, info.Pinned)
+
+	// Unpin the segment again
+	err = UnpinShm(testShmKey)
+	require.NoError(t, err)
+	info, err = InfoShm(testShmKey)
+	require.NoError(t, err)
+	require.False(t, info.Pinned)
+
+	// In-process segments can not be pinned
+	registry := NewRegistry()
+	err = registry.NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize, Backend: MemoryBackend{}})
+	require.NoError(t, err)
+	sg, err := registry.Segment(testShmKey)
+	require.NoError(t, err)
+	err = sg.Pin()
+	require.ErrorIs(t, err, ErrPinUnsupported)
+	err = registry.DeleteShm(testShmKey)
+	require.NoError(t, err)
+}
@@ -0,0 +1,84 @@
+package shm
+
+import "os"
+
+/*
+PosixBackend keeps the segments in POSIX shared memory, which are files under /dev/shm mapped with mmap.
+The segment of a key is named "filebasez.<key>", so it can be listed, chowned and chmodded like any other file,
+and the keys derived from names with KeyFromName give every named segment its own file.
+Opening the file under /dev/shm is what shm_open does on Linux, so the segments are shared with programs using shm_open.
+The id of a segment is the inode number of its file, which tells a removed and recreated segment from the one which was attached.
+*/
+type PosixBackend struct{}
+
+// posixShmDir is the directory where Linux keeps POSIX shared memory
+const posixShmDir = "/dev/shm"
+
+// posixShm is the mapped file implementation under /dev/shm
+var posixShm = mappedFile{dir: posixShmDir}
+
+// posixShmPath returns the path of the segment for the key.
+func posixShmPath(key int64) (path string) {
+	path = posixShm.path(key)
+	return
+}
+
+// Create creates the file of the segment and grows it to the size with ftruncate.
+func (PosixBackend) Create(key, size int64, flag VsysFlags, perm os.FileMode) (id int64, err error) {
+	id, err = posixShm.create(key, size, flag, perm)
+	return
+}
+
+// Open resolves the inode number of the file of an existing segment.
+func (PosixBackend) Open(key int64) (id int64, err error) {
+	id, err = posixShm.open(key)
+	return
+}
+
+// Attach maps the file of the segment with mmap and MAP_SHARED, so every process mapping it sees the same memory.
+func (PosixBackend) Attach(key, id, size int64) (mem []byte, err error) {
+	mem, err = posixShm.attach(key, id, size)
+	return
+}
+
+// AttachReadOnly maps the file of the segment with mmap and MAP_SHARED for reading only.
+func (PosixBackend) AttachReadOnly(key, id, size int64) (mem []byte, err error) {
+	mem, err = posixShm.attachReadOnly(key, id, size)
+	return
+}
+
+// Detach unmaps the memory with munmap.
+func (PosixBackend) Detach(mem []byte) (err error) {
+	err = posixShm.detach(mem)
+	return
+}
+
+// Stat retrieves the size of the file of the segment.
+func (PosixBackend) Stat(key, id int64) (size int64, err error) {
+	size, err = posixShm.stat(key, id)
+	return
+}
+
+// Remove unlinks the file of the segment like shm_unlink, the memory is freed after the last mapping is removed.
+func (PosixBackend) Remove(key, id int64) (err error) {
+	err = posixShm.remove(key, id)
+	return
+}
+
+// Prepare creates the file "filebasez.<key>.new" under /dev/shm of the size and maps it, see Replacer.
+func (PosixBackend) Prepare(key, size int64, perm os.FileMode) (id int64, mem []byte, err error) {
+	id, mem, err = posixShm.prepare(key, size, perm)
+	return
+}
+
+// Replace renames the prepared file over the file of the segment.
+func (PosixBackend) Replace(key, id int64) (err error) {
+	err = posixShm.replace(key, id)
+	return
+}
+
+// Discard unlinks the prepared file.
+func (PosixBackend) Discard(key, id int64) (err error) {
+	err = posixShm.discard(key, id)
+	return
+}
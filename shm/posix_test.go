@@ -0,0 +1,64 @@
+package shm
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+// Test_Check_Shm_Posix_Backend checks segments kept in POSIX shared memory under /dev/shm.
+func Test_Check_Shm_Posix_Backend(t *testing.T) {
+	// The testShmKey is the shared memory key for testing
+	var testShmKey int64 = 18
+
+	// Create a new POSIX shared memory segment with Key=testShmKey and Size=DefualtMinShmSize+16
+	opts := Vopts{
+		Key:     testShmKey,
+		Size:    DefualtMinShmSize + 16,
+		Backend: PosixBackend{},
+	}
+	err := NewShm(opts) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+	require.NoError(t, err)
+
+	// The segment is a file under /dev/shm with the default permissions
+	stat, err := os.Stat(posixShmPath(testShmKey))
+	require.NoError(t, err)
+	require.Equal(t, int64(DefualtMinShmSize+16), stat.Size())
+	require.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+
+	// The same key can not be created twice, and it is not a System V segment
+	err = NewRegistry().NewShm(opts)
+	require.Error(t, err)
+	err = NewRegistry().OpenShm(testShmKey)
+	require.ErrorIs(t, err, ErrShmNotExist)
+
+	// The extension functions work on the segment
+	info, err := InfoShm(testShmKey)
+	require.NoError(t, err)
+	require.Equal(t, int64(DefualtMinShmSize+16), info.Size)
+	err = AppendInt32s(testShmKey, 1, 2)
+	require.NoError(t, err)
+	err = OverwriteOrAppendInt32sByShift(testShmKey, DefualtMinShmSize+8, true, 3)
+	require.NoError(t, err)
+
+	// Another registry opens the segment through the same backend and reads the values
+	reader := NewRegistry()
+	err = reader.OpenShmWithOpts(Vopts{Key: testShmKey, Backend: PosixBackend{}})
+	require.NoError(t, err)
+	sg, err := reader.Segment(testShmKey)
+	require.NoError(t, err)
+	values := make([]int32, 3)
+	err = sg.ReadRowInInt32s(0, values)
+	require.NoError(t, err)
+	require.Equal(t, []int32{1, 2, 3}, values)
+	err = reader.CloseShm(testShmKey)
+	require.NoError(t, err)
+
+	// Deleting the segment removes the file
+	err = DeleteShm(testShmKey)
+	require.NoError(t, err)
+	_, err = os.Stat(posixShmPath(testShmKey))
+	require.True(t, os.IsNotExist(err))
+	err = NewRegistry().OpenShmWithOpts(Vopts{Key: testShmKey, Backend: PosixBackend{}})
+	require.ErrorIs(t, err, ErrShmNotExist)
+}
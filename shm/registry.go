@@ -0,0 +1,335 @@
+package shm
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+/*
+Vregistry maps keys to the attached segments of one caller.
+Every caller may create its own registry with NewRegistry, so that the same key can be attached in different places
+of the same process without sharing the handle. The extension functions use the default registry of the process.
+A registry is safe for concurrent use by multiple goroutines, and so are the segment handles it returns,
+but a handle closed by CloseShm or DeleteShm returns ErrShmNotAttached, so the handle is taken again with Segment.
+A handle replaced by GrowShm or RefreshShm returns ErrShmMoved for writes, and stays attached until the key is closed or deleted.
+*/
+type Vregistry struct {
+	mu       sync.RWMutex
+	segments map[int64]*Vsegment
+	retired  map[int64][]*Vsegment // the handles replaced by GrowShm and RefreshShm, detached with the key
+}
+
+// defaultRegistry is the registry used by the extension functions
+var defaultRegistry = NewRegistry()
+
+// how long NewShm waits under PolicyCreateOrOpen for the process which created the segment to write its header
+const (
+	headerWaitTimeout  = time.Second
+	headerWaitInterval = time.Millisecond
+)
+
+// NewRegistry creates an empty registry.
+func NewRegistry() (registry *Vregistry) {
+	registry = &Vregistry{
+		segments: make(map[int64]*Vsegment),
+		retired:  make(map[int64][]*Vsegment),
+	}
+	return
+}
+
+// checkKey checks that the key can be used as a System V key.
+func checkKey(key int64) (err error) {
+	// Check if the key is negative or zero
+	if key <= 0 {
+		err = ErrNegativeOrZeroShmKey
+		return
+	}
+
+	// Check if the value of key exceeds the default maximum allowed value
+	if key > defaultMaxKeyValue {
+		err = ErrExceedDefaultMaxKeyValue
+		return
+	}
+
+	// Return the error value
+	return
+}
+
+/*
+NewShm creates a new segment with the specified options, writes its header and registers it.
+It returns an error if the key is already registered or any of the writes fail.
+The registry is locked while the segment is created, so two goroutines can not register the same key.
+Under PolicyCreateOrOpen, a segment which already exists is opened like OpenShmWithOpts instead,
+after waiting for the process which created it to finish the header, so many processes can start with the same options.
+*/
+func (receive *Vregistry) NewShm(opts Vopts) (err error) {
+	defer wrapError(&err, "NewShm", opts.Key, 0)
+
+	// Check if the key can be used
+	err = checkKey(opts.Key)
+	if err != nil {
+		return
+	}
+
+	// The header must fit into the segment, so smaller segments are refused before they are created
+	if opts.Size > 0 && opts.Size < DefualtMinShmSize {
+		err = ErrShmSizeBelowHeader
+		return
+	}
+
+	receive.mu.Lock()
+	defer receive.mu.Unlock()
+
+	// Check if the segment is already registered
+	if receive.segments[opts.Key] != nil {
+		err = ErrShmAlreadyExist
+		return
+	}
+
+	// Create the shared memory segment
+	sg, err := newWithReturnId(opts)
+	if opts.Policy == PolicyCreateOrOpen && errors.Is(err, syscall.EEXIST) {
+		// Another process created the segment first, so open it instead of writing the header again
+		sg, err = openValidShm(opts, headerWaitTimeout)
+		if err != nil {
+			return
+		}
+		receive.segments[opts.Key] = sg
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	// Store the attached segment in the registry
+	receive.segments[opts.Key] = sg
+
+	// Write the header, a segment whose header can not be written is removed again
+	err = sg.initWithId(opts)
+	if err != nil {
+		delete(receive.segments, opts.Key)
+		_ = sg.deleteWithId()
+	}
+
+	// Return the error value
+	return
+}
+
+/*
+OpenShm opens an existing shared memory segment by key, which may have been created by NewShm in another process.
+It resolves the id of the System V segment without any creation flags, validates the header written by NewShm and registers the segment.
+*/
+func (receive *Vregistry) OpenShm(key int64) (err error) {
+	err = receive.OpenShmWithOpts(Vopts{Key: key})
+	return
+}
+
+/*
+OpenShmWithOpts opens an existing segment like OpenShm, using the key and the backend in the options.
+When the options name a type other than TypeRaw, segments holding another data structure are refused with ErrShmTypeMismatch.
+*/
+func (receive *Vregistry) OpenShmWithOpts(opts Vopts) (err error) {
+	defer wrapError(&err, "OpenShm", opts.Key, 0)
+
+	// Check if the key can be used
+	key := opts.Key
+	err = checkKey(key)
+	if err != nil {
+		return
+	}
+
+	receive.mu.Lock()
+	defer receive.mu.Unlock()
+
+	// Check if the segment is already registered
+	if receive.segments[key] != nil {
+		err = ErrShmAlreadyExist
+		return
+	}
+
+	// Attach the existing shared memory segment and validate its header
+	sg, err := openValidShm(opts, 0)
+	if err != nil {
+		return
+	}
+
+	// Store the attached segment in the registry
+	receive.segments[key] = sg
+
+	// Return the error value
+	return
+}
+
+/*
+openValidShm attaches the existing segment for the key in the options, and validates its header and its type.
+The magic number is written last by NewShm, so it waits up to the timeout while the magic number is still missing.
+*/
+func openValidShm(opts Vopts, timeout time.Duration) (sg *Vsegment, err error) {
+	// Resolve the id of the existing shared memory segment and attach it
+	sg, err = openShmWithKey(opts)
+	if err != nil {
+		return
+	}
+
+	// Wait for the process which created the segment to finish the header
+	if sg.size >= DefualtMinShmSize {
+		deadline := time.Now().Add(timeout)
+		for atomic.LoadUint32(sg.magicWord()) == 0 && time.Now().Before(deadline) {
+			time.Sleep(headerWaitInterval)
+		}
+	}
+
+	// Validate the header against the running library version and the segment itself
+	err = validateInfo(sg)
+	if err != nil {
+		_ = sg.Close()
+		sg = nil
+		return
+	}
+
+	// Check that the segment holds the data structure the caller expects
+	if opts.Type != TypeRaw && VshmType(decodeInfo(sg.mem[:DefualtMinShmSize]).Type) != opts.Type {
+		_ = sg.Close()
+		sg = nil
+		err = ErrShmTypeMismatch
+		return
+	}
+
+	// Return the attached segment
+	return
+}
+
+/*
+CloseShm detaches the segment registered for the key and removes the key from the registry.
+Unlike DeleteShm, the segment itself is kept, so it can be opened again with OpenShm.
+*/
+func (receive *Vregistry) CloseShm(key int64) (err error) {
+	defer wrapError(&err, "CloseShm", key, 0)
+
+	// Remove the segment from the registry
+	var sg *Vsegment
+	var retired []*Vsegment
+	sg, retired, err = receive.remove(key)
+	if err != nil {
+		return
+	}
+
+	// Detach the segment, and the segments it replaced
+	err = sg.Close()
+	for _, old := range retired {
+		_ = old.Close()
+	}
+
+	// Return the error value
+	return
+}
+
+/*
+DeleteShm detaches and removes the segment registered for the key, and clears the key in the registry,
+so that the key can be used by NewShm again.
+*/
+func (receive *Vregistry) DeleteShm(key int64) (err error) {
+	defer wrapError(&err, "DeleteShm", key, 0)
+
+	// Remove the segment from the registry
+	var sg *Vsegment
+	var retired []*Vsegment
+	sg, retired, err = receive.remove(key)
+	if err != nil {
+		return
+	}
+
+	// Detach and close the shared memory segment using the corresponding shared memory ID, the segments it replaced are already removed
+	err = sg.deleteWithId()
+	for _, old := range retired {
+		_ = old.Close()
+	}
+
+	// Return the error value
+	return
+}
+
+// Segment returns the attached segment handle registered for the key.
+func (receive *Vregistry) Segment(key int64) (segment *Vsegment, err error) {
+	defer wrapError(&err, "Segment", key, 0)
+
+	// Check if the key can be used
+	err = checkKey(key)
+	if err != nil {
+		return
+	}
+
+	// Find the segment in the registry
+	receive.mu.RLock()
+	segment = receive.segments[key]
+	receive.mu.RUnlock()
+	if segment == nil {
+		err = ErrShmNotExist
+		return
+	}
+
+	// Check if the segment is still attached
+	err = segment.acquire()
+	if err != nil {
+		return
+	}
+	segment.release()
+
+	// Return the segment
+	return
+}
+
+/*
+followMoves calls the function with the segment registered for the key, and again with the segment which replaced it
+while the function fails with ErrShmMoved, so the writes of the extension functions follow GrowShm in any process.
+*/
+func (receive *Vregistry) followMoves(key int64, function func(sg *Vsegment) error) (err error) {
+	for {
+		// Find the attached segment for the given key, and call the function with it
+		var sg *Vsegment
+		sg, err = receive.Segment(key)
+		if err != nil {
+			return
+		}
+		err = function(sg)
+		if !errors.Is(err, ErrShmMoved) {
+			return
+		}
+
+		// Follow the move, the registry may have followed it already
+		_, err = receive.RefreshShm(key)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// remove takes the segment registered for the key out of the registry, with the segments it replaced.
+func (receive *Vregistry) remove(key int64) (segment *Vsegment, retired []*Vsegment, err error) {
+	// Check if the key can be used
+	err = checkKey(key)
+	if err != nil {
+		return
+	}
+
+	receive.mu.Lock()
+	defer receive.mu.Unlock()
+
+	// Find the segment in the registry
+	segment = receive.segments[key]
+	if segment == nil {
+		err = ErrShmNotExist
+		return
+	}
+
+	// Forget the key
+	retired = receive.retired[key]
+	delete(receive.segments, key)
+	delete(receive.retired, key)
+
+	// Return the segment
+	return
+}
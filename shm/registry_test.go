@@ -0,0 +1,164 @@
+package shm
+
+import (
+	"errors"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+// Test_Check_Shm_Registry checks the key registry, including keys above 1024, separate registries and concurrent use.
+func Test_Check_Shm_Registry(t *testing.T) {
+	// Keys are no longer limited to 1024, and a deleted key can be created again
+	t.Run("register large keys", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 1<<20 + 16
+
+		// Create, delete and create the segment again with the same key
+		for i := 0; i < 2; i++ {
+			err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 16}) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+			require.NoError(t, err)
+			err = AppendInt32s(testShmKey, 1)
+			require.NoError(t, err)
+			err = DeleteShm(testShmKey)
+			require.NoError(t, err)
+		}
+
+		// A deleted key is no longer registered
+		_, err := Segment(testShmKey)
+		require.ErrorIs(t, err, ErrShmNotExist)
+		err = DeleteShm(testShmKey)
+		require.ErrorIs(t, err, ErrShmNotExist)
+
+		// Keys beyond key_t are refused
+		err = NewShm(Vopts{Key: defaultMaxKeyValue + 1, Size: DefualtMinShmSize})
+		require.ErrorIs(t, err, ErrExceedDefaultMaxKeyValue)
+	})
+
+	// Every caller can attach the same key in its own registry
+	t.Run("separate registries", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 17
+
+		// Create the segment in the first registry
+		owner := NewRegistry()
+		err := owner.NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 16})
+		require.NoError(t, err)
+		defer func() {
+			err1 := owner.DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+
+		// The default registry does not see it until it is opened there
+		_, err = Segment(testShmKey)
+		require.ErrorIs(t, err, ErrShmNotExist)
+
+		// Open the segment in a second registry
+		reader := NewRegistry()
+		err = reader.OpenShm(testShmKey)
+		require.NoError(t, err)
+
+		// Values appended through one registry are read through the other
+		sg, err := owner.Segment(testShmKey)
+		require.NoError(t, err)
+		err = sg.AppendInt32s(4, 5)
+		require.NoError(t, err)
+
+		other, err := reader.Segment(testShmKey)
+		require.NoError(t, err)
+		require.NotSame(t, sg, other)
+		values := make([]int32, 2)
+		err = other.ReadRowInInt32s(0, values)
+		require.NoError(t, err)
+		require.Equal(t, []int32{4, 5}, values)
+
+		// Closing the key in the second registry keeps it in the first one
+		err = reader.CloseShm(testShmKey)
+		require.NoError(t, err)
+		_, err = owner.Segment(testShmKey)
+		require.NoError(t, err)
+	})
+
+	// Goroutines create and delete segments at the same time
+	t.Run("concurrent registration", func(t *testing.T) {
+		// The first key used by the goroutines
+		var testShmKey int64 = 1<<20 + 32
+
+		// Every goroutine creates, uses and deletes its own keys, while all of them race for the same key
+		var wg sync.WaitGroup
+		created := make([]bool, 8)
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				key := testShmKey + 1 + int64(i)
+				for j := 0; j < 10; j++ {
+					err := NewShm(Vopts{Key: key, Size: DefualtMinShmSize + 16})
+					require.NoError(t, err)
+					_, err = ReadOffset(key)
+					require.NoError(t, err)
+					err = DeleteShm(key)
+					require.NoError(t, err)
+				}
+				created[i] = NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 16}) == nil
+			}(i)
+		}
+		wg.Wait()
+
+		// Only one goroutine registered the shared key
+		count := 0
+		for i := 0; i < len(created); i++ {
+			if created[i] {
+				count++
+			}
+		}
+		require.Equal(t, 1, count)
+		err := DeleteShm(testShmKey)
+		require.NoError(t, err)
+	})
+	// Handles closed while goroutines still use them return errors instead of touching the detached memory
+	t.Run("close handles in use", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 57
+
+		// Create the segment, and take its handle like a caller which keeps it
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 4096, Backend: PosixBackend{}})
+		require.NoError(t, err)
+		sg, err := Segment(testShmKey)
+		require.NoError(t, err)
+
+		// Append, read and lock through the handle until it is closed
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					_, err1 := sg.AppendInt32sReturnShift(1)
+					if err1 == nil {
+						err1 = sg.ReadRowInInt32s(0, make([]int32, 1))
+					}
+					if err1 == nil {
+						err1 = sg.Lock()
+					}
+					if err1 == nil {
+						err1 = sg.Unlock()
+					}
+					if errors.Is(err1, ErrShmNotAttached) {
+						return
+					}
+					if err1 != nil && !errors.Is(err1, ErrEndOfFile) {
+						require.NoError(t, err1)
+					}
+				}
+			}()
+		}
+
+		// Delete the segment while the goroutines run, they all stop with ErrShmNotAttached
+		err = DeleteShm(testShmKey) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		require.NoError(t, err)
+		wg.Wait()
+		_, err = sg.ReadOffset()
+		require.ErrorIs(t, err, ErrShmNotAttached)
+	})
+}
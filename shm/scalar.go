@@ -0,0 +1,181 @@
+package shm
+
+import (
+	"encoding/binary"
+	"reflect"
+	"unsafe"
+)
+
+/*
+Scalar is the type set of the fixed-width values a segment can hold, including the types defined on them.
+Every value is stored in little-endian byte order in its own width, a bool takes one byte, 1 for true and 0 for false,
+so the int32 values written by AppendValues can be read by ReadRowInInt32s and the other way around.
+*/
+type Scalar interface {
+	~int8 | ~int16 | ~int32 | ~int64 | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~float32 | ~float64 | ~bool
+}
+
+// error list for the values
+const (
+	ErrShmFetchValue = Error("fetch shm value failed")
+)
+
+// scalarSize returns the number of bytes of a value of the type.
+func scalarSize[T Scalar]() (size int) {
+	var zero T
+	size = int(unsafe.Sizeof(zero))
+	return
+}
+
+// encodeScalars encodes the values in little-endian byte order, it is the encoding of every value type.
+func encodeScalars[T Scalar](values []T) (data []byte) {
+	// Allocate the bytes of all the values
+	size := scalarSize[T]()
+	data = make([]byte, len(values)*size)
+
+	// The bits of the value are read with its width, so floats keep their IEEE 754 bits and bools their byte
+	for i := range values {
+		bits := unsafe.Pointer(&values[i])
+		switch size {
+		case 1:
+			data[i] = *(*uint8)(bits)
+		case 2:
+			binary.LittleEndian.PutUint16(data[i*2:], *(*uint16)(bits))
+		case 4:
+			binary.LittleEndian.PutUint32(data[i*4:], *(*uint32)(bits))
+		case 8:
+			binary.LittleEndian.PutUint64(data[i*8:], *(*uint64)(bits))
+		}
+	}
+
+	// Return the encoded values
+	return
+}
+
+// decodeScalars decodes the values which are completely in data, the reverse of encodeScalars.
+func decodeScalars[T Scalar](data []byte, values []T) {
+	// Only 0 and 1 are valid bools, so any other byte is read as true
+	size := scalarSize[T]()
+	var zero T
+	isBool := reflect.TypeOf(zero).Kind() == reflect.Bool
+
+	// Write the bits of every value with its width
+	for i := 0; i < len(values) && (i+1)*size <= len(data); i++ {
+		bits := unsafe.Pointer(&values[i])
+		switch {
+		case isBool:
+			*(*bool)(bits) = data[i] != 0
+		case size == 1:
+			*(*uint8)(bits) = data[i]
+		case size == 2:
+			*(*uint16)(bits) = binary.LittleEndian.Uint16(data[i*2:])
+		case size == 4:
+			*(*uint32)(bits) = binary.LittleEndian.Uint32(data[i*4:])
+		case size == 8:
+			*(*uint64)(bits) = binary.LittleEndian.Uint64(data[i*8:])
+		}
+	}
+}
+
+/*
+Vvalues reads and writes values of the type T in a segment, the same way as the int32 functions of Vsegment do,
+so the appends, the write policy, the segment lock and the errors are the same for every type.
+Go methods can not have type parameters, so the values are reached through ValuesOf, for example ValuesOf[float64](segment).
+*/
+type Vvalues[T Scalar] struct {
+	segment *Vsegment
+}
+
+// ValuesOf returns the values of the type T in the segment.
+func ValuesOf[T Scalar](segment *Vsegment) (values Vvalues[T]) {
+	values = Vvalues[T]{segment: segment}
+	return
+}
+
+// Append writes the values to the end of the data of the segment, see Vsegment.AppendInt32s.
+func (receive Vvalues[T]) Append(values ...T) (err error) {
+	defer receive.segment.wrapError(&err, "AppendValues")
+
+	_, err = receive.segment.appendData(encodeScalars(values))
+	return
+}
+
+// AppendReturnShift appends the values and returns the shift where they were written, see Vsegment.AppendInt32sReturnShift.
+func (receive Vvalues[T]) AppendReturnShift(values ...T) (shmShift int64, err error) {
+	defer receive.segment.wrapError(&err, "AppendValuesReturnShift")
+
+	shmShift, err = receive.segment.appendData(encodeScalars(values))
+	return
+}
+
+// OverwriteOrAppendByShift writes the values at shmShift, which counts from the beginning of the segment, see Vsegment.OverwriteOrAppendInt32sByShift.
+func (receive Vvalues[T]) OverwriteOrAppendByShift(shmShift int64, updateOffset bool, values ...T) (err error) {
+	defer receive.segment.wrapError(&err, "OverwriteOrAppendValuesByShift")
+
+	err = receive.segment.lockedOverwriteOrAppendData(shmShift, updateOffset, encodeScalars(values))
+	return
+}
+
+// ReadRow reads len(values) values starting shmShift bytes after the header, see Vsegment.ReadRowInInt32s.
+func (receive Vvalues[T]) ReadRow(shmShift int64, values []T) (err error) {
+	defer receive.segment.wrapError(&err, "ReadRowInValues")
+
+	// Read the encoded values, and decode the ones which were read completely
+	data := make([]byte, len(values)*scalarSize[T]())
+	count, err := receive.segment.readRowData(shmShift, data)
+	decodeScalars(data[:count], values)
+	if err == nil && count < int64(len(data)) {
+		err = ErrShmFetchValue
+	}
+
+	// Return the error value
+	return
+}
+
+// AppendValues writes the values to the end of the data of the segment identified by a key.
+func AppendValues[T Scalar](key int64, values ...T) (err error) {
+	// Append the values and drop the shift
+	_, err = AppendValuesReturnShift(key, values...)
+
+	// Return the error value
+	return
+}
+
+// AppendValuesReturnShift appends the values to the segment identified by a key and returns the shift where they were written.
+func AppendValuesReturnShift[T Scalar](key int64, values ...T) (shmShift int64, err error) {
+	// Append the values to the attached segment for the given key, following GrowShm
+	err = defaultRegistry.followMoves(key, func(sg *Vsegment) (err error) {
+		shmShift, err = ValuesOf[T](sg).AppendReturnShift(values...)
+		return
+	})
+
+	// Return the shift and the error value
+	return
+}
+
+// OverwriteOrAppendValuesByShift writes the values to the segment identified by a key at shmShift, see Vsegment.OverwriteOrAppendInt32sByShift.
+func OverwriteOrAppendValuesByShift[T Scalar](key int64, shmShift int64, updateOffset bool, values ...T) (err error) {
+	// Write the values to the attached segment for the given key, following GrowShm
+	err = defaultRegistry.followMoves(key, func(sg *Vsegment) error {
+		return ValuesOf[T](sg).OverwriteOrAppendByShift(shmShift, updateOffset, values...)
+	})
+
+	// Return the error value
+	return
+}
+
+// ReadRowInValues reads the values from the segment identified by a key, starting shmShift bytes after the header.
+func ReadRowInValues[T Scalar](key, shmShift int64, values []T) (err error) {
+	// Find the attached segment for the given key
+	var sg *Vsegment
+	sg, err = defaultRegistry.Segment(key)
+	if err != nil {
+		return
+	}
+
+	// Read the values
+	err = ValuesOf[T](sg).ReadRow(shmShift, values)
+
+	// Return the error value
+	return
+}
@@ -0,0 +1,111 @@
+package shm
+
+import (
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+// price is a type defined on float64, which the values accept as well
+type price float64
+
+// checkValues appends the values of one type, and checks that they are read back the same.
+func checkValues[T Scalar](t *testing.T, key int64, values ...T) {
+	shmShift, err := AppendValuesReturnShift(key, values...)
+	require.NoError(t, err)
+	read := make([]T, len(values))
+	err = ReadRowInValues(key, shmShift, read)
+	require.NoError(t, err)
+	require.Equal(t, values, read)
+}
+
+// Test_Check_Shm_Values checks the appends, the overwrites and the reads of every value type.
+func Test_Check_Shm_Values(t *testing.T) {
+	// Every type keeps its values
+	t.Run("value types", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 54
+
+		// Create the segment
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 1024, Backend: MemoryBackend{}})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+
+		// Append and read the values of every type
+		checkValues[int8](t, testShmKey, math.MinInt8, -1, 0, math.MaxInt8) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		checkValues[int16](t, testShmKey, math.MinInt16, -1, math.MaxInt16)
+		checkValues[int32](t, testShmKey, math.MinInt32, -1, math.MaxInt32)
+		checkValues[int64](t, testShmKey, math.MinInt64, -1, math.MaxInt64)
+		checkValues[uint8](t, testShmKey, 0, 1, math.MaxUint8)
+		checkValues[uint16](t, testShmKey, 0, 1, math.MaxUint16)
+		checkValues[uint32](t, testShmKey, 0, 1, math.MaxUint32)
+		checkValues[uint64](t, testShmKey, 0, 1, math.MaxUint64)
+		checkValues[float32](t, testShmKey, -1.5, 0, math.MaxFloat32, float32(math.Inf(1)))
+		checkValues[float64](t, testShmKey, -1.5, math.SmallestNonzeroFloat64, math.MaxFloat64)
+		checkValues[bool](t, testShmKey, true, false, true)
+		checkValues[price](t, testShmKey, 9.99, 120)
+
+		// The values are little-endian, so the int32 functions read what AppendValues wrote
+		shmShift, err := AppendValuesReturnShift[uint16](testShmKey, 0x0201, 0x0403)
+		require.NoError(t, err)
+		int32s := make([]int32, 1)
+		err = ReadRowInInt32s(testShmKey, shmShift, int32s)
+		require.NoError(t, err)
+		require.Equal(t, int32(0x04030201), int32s[0])
+
+		// Overwrite the values in place, and read a byte other than 0 and 1 as true
+		err = OverwriteOrAppendValuesByShift[uint16](testShmKey, DefualtMinShmSize+shmShift, false, 7)
+		require.NoError(t, err)
+		uint16s := make([]uint16, 2)
+		err = ReadRowInValues(testShmKey, shmShift, uint16s)
+		require.NoError(t, err)
+		require.Equal(t, []uint16{7, 0x0403}, uint16s)
+		bools := make([]bool, 2)
+		err = ReadRowInValues(testShmKey, shmShift+2, bools)
+		require.NoError(t, err)
+		require.Equal(t, []bool{true, true}, bools)
+	})
+
+	// The values follow the write policy and stop at the end of the segment
+	t.Run("limits", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 55
+
+		// Create a segment with room for 12 bytes, which writes all or nothing
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 12, Backend: MemoryBackend{}, Writes: WriteAllOrNothing})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		sg, err := Segment(testShmKey)
+		require.NoError(t, err)
+		values := ValuesOf[int64](sg)
+
+		// One int64 fits, the second one is refused without moving the offset
+		err = values.Append(1)
+		require.NoError(t, err)
+		_, err = values.AppendReturnShift(2)
+		require.ErrorIs(t, err, ErrNotEnoughSpace)
+		offset, err := sg.ReadOffset()
+		require.NoError(t, err)
+		require.Equal(t, int64(DefualtMinShmSize+8), offset)
+		err = values.OverwriteOrAppendByShift(DefualtMinShmSize+8, true, 3)
+		require.ErrorIs(t, err, ErrNotEnoughSpace)
+
+		// A row running past the end of the segment can not be read completely
+		err = ValuesOf[int32](sg).Append(4)
+		require.NoError(t, err)
+		read := make([]int64, 2)
+		err = values.ReadRow(8, read)
+		require.ErrorIs(t, err, ErrShmFetchValue)
+		err = values.ReadRow(0, read[:1])
+		require.NoError(t, err)
+		require.Equal(t, int64(1), read[0])
+		err = values.ReadRow(16, read)
+		require.ErrorIs(t, err, ErrShmReadingBeyond)
+	})
+}
@@ -1,3 +1,5 @@
+//go:build cgo
+
 #include "shm.h"
 
 /*
@@ -9,31 +11,21 @@
 */
 
 /*
-    sysv_shm_open is called to create a shared memory segment.
-    It takes three arguments:
-        - size:  the size of the shared memory segment
-        - flags: the flags used to create the shared memory segment, such as IPC_CREAT or IPC_EXCL
-        - perm:  the permissions of the shared memory segment, represented as an octal value
+    sysv_shm_key derives a System V key from an existing file with ftok.
+    It takes two arguments:
+        - path:    the path of an existing file, only its device and inode numbers are used
+        - proj_id: the project id, only its lowest 8 bits are used, and IPC_KEY_PROJID is used when it is 0
 */
-int sysv_shm_open(int size, int flags, int perm) {
-    int shm_id;
-    /*
-        If the size argument is non-zero,
-        the function creates a new shared memory segment with the specified size and permissions
-    */
-    if(size) {
-        // Unless otherwise specified, segment is owner-read/write (no exec)
-        if(!perm){
-            perm = 0600;
-        }
-        return shmget(IPC_PRIVATE, size, flags|perm);
-    } else {
-       return shmget(IPC_PRIVATE, size, 0);
+int sysv_shm_key(const char *path, int proj_id) {
+    // Unless otherwise specified, the project id of filebasez is used
+    if(!proj_id){
+        proj_id = IPC_KEY_PROJID;
     }
+    return (int)ftok(path, proj_id);
 }
 
 // sysv_shm_open_with_key creates or opens a shared memory segment with the given key, size, and permissions.
-int sysv_shm_open_with_key(int key,int size, int flags, int perm) {
+int sysv_shm_open_with_key(int key, size_t size, int flags, int perm) {
     int shm_id;
 
     // If the size parameter is non-zero, it creates a new shared memory segment with the given key, size, and permissions
@@ -48,34 +40,6 @@ int sysv_shm_open_with_key(int key,int size, int flags, int perm) {
     }
 }
 
-/*
-    sysv_shm_write writes data to a shared memory segment identified by an ID, offset, and length,
-    after attaching to it and detaching from it
-    It takes three arguments:
-        - shm_id:  the integer that represents the ID of the shared memory segment that we want to write to
-        - input:   the pointer to the memory location that contains the data that we want to write to the shared memory segment
-        - len:     the integer that represents the length of the data that we want to write to the shared memory segment
-        - offset:  the integer that represents the offset from the beginning of the shared memory segment where we want to start writing the data
-*/
-int sysv_shm_write(int shm_id, void* input, int len, int offset) {
-    // Attach to the given segment to get its memory address
-    char* addr = sysv_shm_attach(shm_id);
-
-    // Check if attaching to the segment was successful
-    if(addr == (char*)(-1)){
-        return -1;
-    }
-
-    // Copy len bytes from input into the shared memory segment starting from offset
-    memcpy(addr+offset, input, len);
-
-    // Detach from the shared memory segment
-    sysv_shm_detach(addr);
-
-    // Return 0 to indicate success
-    return 0;
-}
-
 /*
    sysv_shm_attach takes one parameter shm_id,
    which is an integer that represents the ID of the shared memory segment that we want to attach to.
@@ -85,6 +49,11 @@ void *sysv_shm_attach(int shm_id) {
     return shmat(shm_id, NULL, 0);
 }
 
+// sysv_shm_attach_readonly attaches the shared memory segment with the given ID for reading only, using SHM_RDONLY.
+void *sysv_shm_attach_readonly(int shm_id) {
+    return shmat(shm_id, NULL, SHM_RDONLY);
+}
+
 /*
     sysv_shm_detach takes one parameter addr,
     which is a pointer to the memory address of the shared memory segment that we want to detach from.
@@ -93,33 +62,6 @@ int sysv_shm_detach(void *addr) {
     return shmdt(addr);
 }
 
-/*
-    sysv_shm_read reads data from a shared memory segment identified by shm_id and stores it in output.
-    It takes three arguments:
-        - shm_id: The integer that represents the ID of the shared memory segment that we want to read from
-        - output: The pointer to the memory address where the data read from the shared memory segment
-        - len:    The integer that represents the number of bytes to read from the shared memory segment
-        - offset: The integer that represents the offset (in bytes) from the start of the shared memory segment where the read operation will begin
-*/
-int sysv_shm_read(int shm_id, void* output, int len, int offset) {
-    // Attach to the given segment to get its memory address
-    char* addr = sysv_shm_attach(shm_id);
-
-    // Check if attachment was successful
-    if(addr == (char*)(-1)){
-        return -1;
-    }
-
-    // Copy len bytes from addr into output
-    memcpy(output, addr+offset, len);
-
-    // Detach from the shared memory segment
-    sysv_shm_detach(addr);
-
-    // Return 0 to indicate successful read
-    return 0;
-}
-
 /*
     This code locks a System V shared memory segment with the given ID
     using the shmctl function with the SHM_LOCK command.
@@ -135,6 +77,25 @@ int sysv_shm_unlock(int shm_id) {
     return shmctl(shm_id, SHM_UNLOCK, NULL);
 }
 
+/*
+    sysv_shm_is_locked tells if a System V shared memory segment with the given ID is locked with SHM_LOCK.
+    It returns 1 when the segment is locked, 0 when it is not, and -1 when shmctl fails.
+*/
+int sysv_shm_is_locked(int shm_id) {
+    struct shmid_ds shm;
+
+    // The kernel sets SHM_LOCKED in the mode of the segment while it is locked
+    if(shmctl(shm_id, IPC_STAT, &shm) < 0) {
+        return -1;
+    }
+    return (shm.shm_perm.mode & SHM_LOCKED) != 0;
+}
+
+// sysv_shm_stat copies the kernel statistics of a System V shared memory segment with the given ID using the shmctl function with the IPC_STAT command.
+int sysv_shm_stat(int shm_id, struct shmid_ds *shm) {
+    return shmctl(shm_id, IPC_STAT, shm);
+}
+
 // sysv_shm_close removes a System V shared memory segment with the given ID using the shmctl function with the IPC_RMID command.
 int sysv_shm_close(int shm_id) {
     return shmctl(shm_id, IPC_RMID, NULL);
@@ -1,10 +1,12 @@
 package shm
 
-// #include "shm.h"
-import "C"
 import (
 	"encoding/binary"
+	"hash/crc32"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -17,11 +19,11 @@ type VsysFlags int
    Otherwise, it may be difficult for another process to obtain the shared memory identifier (return value) generated by the current process.
 */
 const (
-	StatusIpcNone                = 0               // the constant with the value of 0 that represents no shared memory creation flag
-	StatusIpcCreate    VsysFlags = C.IPC_CREAT     // the constant with the value of 512 that represents the flag for creating a newWithReturnId shared memory segment, defined as IPC_CREAT in C language
-	StatusIpcExclusive           = C.IPC_EXCL      // the constant with the value of 1024 that represents the flag for creating a newWithReturnId shared memory segment exclusively
-	StatusHugePages              = C.SHM_HUGETLB   // the constant with the value of 2048 that represents the flag for requesting shared memory allocation using huge pages.
-	StatusNoReserve              = C.SHM_NORESERVE // the constant with the value of C.SHM_NORESERVE that represents the flag for creating a shared memory segment without reserving swap space.
+	StatusIpcNone                = 0      // the constant with the value of 0 that represents no shared memory creation flag
+	StatusIpcCreate    VsysFlags = 01000  // the constant with the value of 512 that represents the flag for creating a newWithReturnId shared memory segment, defined as IPC_CREAT in C language
+	StatusIpcExclusive           = 02000  // the constant with the value of 1024 that represents the flag for creating a newWithReturnId shared memory segment exclusively, defined as IPC_EXCL in C language
+	StatusHugePages              = 04000  // the constant with the value of 2048 that represents the flag for requesting shared memory allocation using huge pages, defined as SHM_HUGETLB in C language
+	StatusNoReserve              = 010000 // the constant with the value of 4096 that represents the flag for creating a shared memory segment without reserving swap space, defined as SHM_NORESERVE in C language
 )
 
 // Error Defines a new Error type as a string
@@ -34,17 +36,48 @@ func (e Error) Error() string {
 
 // version information
 const (
-	MajorVersion uint16 = 1
-	MinorVersion uint16 = 2
-	PatchVersion uint16 = 3
+	MajorVersion uint16 = 2
+	MinorVersion uint16 = 3
+	PatchVersion uint16 = 0
 )
 
+// ShmMagic is written at the beginning of every header, it tells a filebasez segment from the segments of other programs
+const ShmMagic = "FBSZ"
+
+/*
+The header at the beginning of every segment is laid out as below, all the values are little-endian.
+
+	 0:4   magic number "FBSZ"
+	 4:10  major, minor and patch versions
+	10:12  padding
+	12:16  type of the data structure
+	16:20  flag
+	20:24  parameter
+	24:32  key
+	32:40  id
+	40:48  size
+	48:52  CRC-32 checksum of bytes 4:48, which are written once by NewShm
+	52:56  lock
+	56:64  offset
+	64:72  creation time in Unix seconds, since 2.1
+	72:80  time to live in seconds, 0 when the segment lives until it is deleted, since 2.1
+	80:88  id of the segment which replaced this one, see GrowShm, since 2.2
+	88:92  moved state, bit 0 once GrowShm replaced this segment, bit 31 while it copies it, and the appends in flight between, since 2.2
+	92:96  number of links following the head of a chain, see NewChain, or the width of the rows of a speedy array, since 2.3
+
+The lock, the offset and the forwarding record change after the segment is created, so they are not covered by the checksum,
+and they are aligned for atomic operations.
+The magic number is written last, so a process which sees it also sees the rest of the header.
+Headers of 2.0 have zeros in place of the creation time and the time to live, so they are never expired.
+All the bytes reserved in 2.0 are used since 2.3, so the next change of the header needs a new major version.
+*/
+
 // default value for shm
 const (
 	defautlShmFlag       = StatusIpcCreate | StatusIpcExclusive
 	defaultShmPermission = 0600
-	defaultMaxKeyValue   = 1 << 10
-	DefualtMinShmSize    = 2 + 2 + 2 + 8 + 8 + 8 + 4 + 4 + 8 + 4
+	defaultMaxKeyValue   = 1<<31 - 1                                                                 // key_t is a 32-bit signed integer
+	DefualtMinShmSize    = 4 + 2 + 2 + 2 + 2 + 4 + 4 + 4 + 8 + 8 + 8 + 4 + 4 + 8 + 8 + 8 + 8 + 4 + 4 // magic, version, padding, type, flag, parameter, key, id, size, checksum, lock, offset, creation time, time to live, forwarding record and links
 )
 
 // error list
@@ -62,6 +95,7 @@ const (
 	ErrShmFetchInt32               = Error("fetch shm int32 failed")
 	ErrExceedDefaultMaxKeyValue    = Error("exceed default max key value")
 	ErrNegativeOrZeroSize          = Error("shm size should not be negative or zero")
+	ErrShmSizeBelowHeader          = Error("shm size should not be smaller than the header")
 	ErrInitializeMajorVersionValue = Error("initialization of major version value failed")
 	ErrInitializeMinorVersionValue = Error("initialization of minor version value failed")
 	ErrInitializePatchVersionValue = Error("initialization of patch version value failed")
@@ -74,36 +108,93 @@ const (
 	ErrInitializeTypeValue         = Error("initialization of type value failed")
 	ErrCorrectOffsetValue          = Error("correct shm offset value failed")
 	ErrShmReadingBeyond            = Error("shm reading beyond boundaries")
+	ErrIncompatibleVersion         = Error("incompatible shm header version")
+	ErrInvalidShmHeader            = Error("invalid shm header")
+	ErrShmAttach                   = Error("attach shm failed")
+	ErrShmNotAttached              = Error("shm is not attached")
+	ErrShmOutOfRange               = Error("access beyond shm boundaries")
+	ErrInitializeChecksumValue     = Error("initialization of checksum value failed")
+	ErrForeignShm                  = Error("shm was not created by filebasez")
+	ErrShmHeaderCorrupted          = Error("shm header checksum mismatch")
+	ErrShmTypeMismatch             = Error("shm holds another data structure type")
+	ErrUnsupportedFlag             = Error("shm flag is not supported by the backend")
+	ErrInitializeCreatedValue      = Error("initialization of creation time value failed")
+	ErrInitializeTtlValue          = Error("initialization of time to live value failed")
+	ErrNotEnoughSpace              = Error("not enough shm space for all the values")
+	ErrInitializeWidthValue        = Error("initialization of width value failed")
 )
 
-// VsegmentMap : map key to id
-var VsegmentMap []int64
+// VopenPolicy tells NewShm what to do when the segment already exists
+type VopenPolicy int
 
-// init : initialize VsegmentMap
-func init() {
-	VsegmentMap = make([]int64, defaultMaxKeyValue)
-}
+// open policies for NewShm
+const (
+	PolicyCreate       VopenPolicy = 0 // create the segment, and fail when it already exists
+	PolicyCreateOrOpen VopenPolicy = 1 // create the segment, or open it when another process has already created it
+)
+
+// VwritePolicy tells the writes of a segment handle what to do when the values do not fit in the segment
+type VwritePolicy int
 
-// Vsegment is a native representation of a SysV shared memory segment
+// write policies for the appends and the overwrites
+const (
+	WritePartial      VwritePolicy = 0 // write the values which fit and return ErrDataDevided or ErrEndOfFile
+	WriteAllOrNothing VwritePolicy = 1 // write all the values, or none of them and return ErrNotEnoughSpace
+)
+
+// VshmType tells which data structure a segment holds, it is recorded in the header
+type VshmType int32
+
+// data structure types recorded in the header
+const (
+	TypeRaw              VshmType = 0 // values written by the extension functions without any data structure
+	TypeSpeedyArrayInt32 VshmType = 1 // rows of int32 values kept by speedyArray.SpdArrayInt32
+	TypeChain            VshmType = 2 // the head of a chain of segments, see NewChain
+	TypeChainLink        VshmType = 3 // a segment following the head of a chain
+)
+
+/*
+Vsegment is a native representation of a shared memory segment, which is kept by its backend.
+The segment is attached once when it is created or opened, and mem keeps the attached memory until Close is called.
+A handle is safe for concurrent use: its operations keep it attached while they run, and Close waits for them,
+so an operation on a closed handle returns ErrShmNotAttached instead of touching the detached memory.
+The views returned by Bytes, Int32s, Int64s and Float64s are not covered, they must not be used after Close.
+*/
 type Vsegment struct {
-	key    int64
-	id     int64
-	size   int64
-	offset int64
+	use     sync.RWMutex // held for reading by the operations while they use mem, and for writing by Close, which detaches it
+	key     int64
+	id      int64
+	size    int64
+	offset  int64
+	mem     []byte
+	backend Backend
+	writes  VwritePolicy
+	held    uint32 // 1 while the segment lock is held through Lock or TryLock of this handle, see lockForOverwrite
 }
 
-// Vopts is the required parameter for generating a SysV shared memory segment
+// Vopts is the required parameter for generating a shared memory segment
 type Vopts struct {
 	// These values are user-defined
-	Key  int64
-	Size int64
+	Key       int64
+	Size      int64
+	Backend   Backend       // the default backend is used when it is nil
+	Type      VshmType      // the data structure recorded in the header, OpenShmWithOpts refuses segments of other types unless it is TypeRaw
+	Mode      os.FileMode   // the permission bits of the segment, 0600 is used when it is 0
+	HugePages bool          // allocate the segment with huge pages (StatusHugePages), the size must be a multiple of the huge page size
+	NoReserve bool          // do not reserve swap space for the segment (StatusNoReserve)
+	Policy    VopenPolicy   // what NewShm does when the segment already exists
+	TTL       time.Duration // how long the segment lives, GcShm removes it afterwards once no process is attached, 0 means forever
+	Writes    VwritePolicy  // what the writes through this handle do when the values do not fit, it is not recorded in the header
+	Width     uint32        // the number of int32 values in a row of a TypeSpeedyArrayInt32 segment, recorded in the header, 0 when it is unknown
 	// These values are automatically determined
 	flag      VsysFlags
 	parameter os.FileMode
+	reserved  int64 // bytes after the header which are written before the header, like the record of a chain, the offset starts after them
 }
 
-// Vinfo contains detailed information about a SysV shared memory segment
+// Vinfo contains detailed information about a shared memory segment
 type Vinfo struct {
+	Magic     [4]byte
 	Major     uint16
 	Minor     uint16
 	Patch     uint16
@@ -114,6 +205,12 @@ type Vinfo struct {
 	Parameter [4]int8
 	Offset    int64
 	Type      int32
+	Checksum  uint32
+	Mode      os.FileMode
+	Pinned    bool // the segment is kept in RAM, see PinShm, it is not part of the header
+	Created   time.Time
+	TTL       time.Duration
+	Width     uint32 // the number of int32 values in a row of a speedy array, 0 for other types and when it is unknown
 }
 
 // >>>>> >>>>> >>>>> [Basic Functions]
@@ -134,10 +231,8 @@ func newWithReturnId(opts Vopts) (segment *Vsegment, err error) {
 				If the "size" field in the "opts" argument is also greater than 0,
 				the function sets the "StatusIpcCreate" and "StatusIpcExclusive" flags in the "opts" argument
 			*/
-			// Set the flag options for creating the shared memory segment with IPC_CREATE and IPC_EXCL
-			opts.flag = StatusIpcCreate | StatusIpcExclusive
-			// Set the access permissions for the shared memory segment
-			opts.parameter = 0600
+			// Set the flag options and the access permissions for creating the shared memory segment with IPC_CREATE and IPC_EXCL
+			opts = opts.withCreationFlags()
 			// Attempt to create the shared memory segment using the specified options
 			segment, err = createShmWithKey(opts)
 		} else if opts.Size <= 0 {
@@ -166,9 +261,7 @@ func newWithReturnId(opts Vopts) (segment *Vsegment, err error) {
 			case opts.key == 0:
 			I've done a lot of research, and it's not advised to use a key value of 0.
 			[reference](https://hackmd.io/@sysprog/linux-shared-memory)
-			If the "key" field in the "opts" argument is equal to 0,
-			the function calls "createShm" to create a shared memory segment.
-			segment, err = createShm(opts)
+			A key value of 0 is IPC_PRIVATE, which creates a segment no other process can find by its key, so it is refused.
 		*/
 	default:
 		/*
@@ -181,71 +274,214 @@ func newWithReturnId(opts Vopts) (segment *Vsegment, err error) {
 	return
 }
 
-// createShm to create a new shared memory segment with given size
-func createShm(opts Vopts) (segment *Vsegment, err error) {
-	// Declare variables to store shared memory ID and size
-	var shmId C.int
-	var shmSize C.ulong
-
-	// Open shared memory segment with given size and default flags and permissions
-	shmId, err = C.sysv_shm_open(C.int(opts.Size), C.int(defautlShmFlag), C.int(defaultShmPermission))
-	if err == nil {
-		// Retrieve the size of the shared memory segment
-		shmSize, err = C.sysv_shm_get_size(shmId)
+// createShmWithKey to create a new shared memory segment with given size by using the key and the backend in the options
+func createShmWithKey(opts Vopts) (segment *Vsegment, err error) {
+	// Create the shared memory segment with given size, flags and permissions by using the key
+	backend := opts.backendOrDefault()
+	var shmId int64
+	shmId, err = backend.Create(opts.Key, opts.Size, opts.flag, opts.parameter)
+	if err != nil {
+		return
+	}
 
-		// Return error if failed to retrieve the size
+	// Remove the segment again when it can not be used
+	defer func() {
 		if err != nil {
-			err = ErrFailToRetrieveShmSize
-			return
+			_ = backend.Remove(opts.Key, shmId)
+			segment = nil
 		}
+	}()
 
-		// Create a new Vsegment struct to represent the shared memory segment
-		segment = &Vsegment{
-			id:   int64(shmId),
-			size: int64(shmSize),
-		}
+	// Retrieve the size of the shared memory segment
+	var shmSize int64
+	shmSize, err = backend.Stat(opts.Key, shmId)
+	if err != nil {
+		return
+	}
+
+	// Create a new Vsegment struct to represent the shared memory segment by using the key
+	segment = &Vsegment{
+		key:     opts.Key,
+		id:      shmId,
+		size:    shmSize,
+		backend: backend,
+		writes:  opts.Writes,
 	}
 
+	// Attach the shared memory segment once
+	err = segment.attachWithId()
+
 	// Return the segment and err values
 	return
 }
 
-// createShmWithKey to create a new shared memory segment with given size by using the key
-func createShmWithKey(opts Vopts) (segment *Vsegment, err error) {
-	// Declare variables to store shared memory ID and size
-	var shmId C.int
-	var shmSize C.ulong
+/*
+replaceShmWithKey creates the segment which replaces the segment of the handle under the same key, with the options,
+fill writes its header and its data, and the new segment is returned attached. The handle keeps the replaced segment attached.
+
+With a Replacer backend, the new segment is prepared beside the current one, which is only removed once fill succeeded,
+and on any error the current segment stays in place and next is nil.
+The other backends remove the current segment first. When the new segment can not be created or filled,
+a segment of the old size is created and filled by restore instead, and it is returned as next with the error,
+so the key keeps its data; next is nil when even that fails.
+*/
+func (receive *Vsegment) replaceShmWithKey(opts Vopts, fill, restore func(next *Vsegment) error) (next *Vsegment, err error) {
+	// Build the new segment beside the current one, when the backend can
+	if replacer, ok := receive.backend.(Replacer); ok {
+		next, err = receive.prepareWithKey(replacer, opts, fill)
+		return
+	}
+
+	// Remove the current segment, so the key is free for the new segment
+	err = receive.backend.Remove(receive.key, receive.id)
+	if err != nil {
+		return
+	}
 
-	// Open shared memory segment with given size and default flags and permissions by using the key
-	shmId, err = C.sysv_shm_open_with_key(C.int(opts.Key), C.int(opts.Size), C.int(opts.flag), C.int(opts.parameter))
+	// Create and fill the new segment
+	next, err = createFilledShm(opts, fill)
 	if err == nil {
-		// Retrieve the size of the shared memory segment by using the key
-		shmSize, err = C.sysv_shm_get_size(shmId)
+		return
+	}
 
-		// Return error if failed to retrieve the size
-		if err != nil {
-			err = ErrFailToRetrieveShmSize
-			return
-		}
+	// Keep the data in a segment of the old size, so the key is not left without a segment
+	opts.Size = receive.size
+	next, _ = createFilledShm(opts, restore)
 
-		// Create a new Vsegment struct to represent the shared memory segment by using the key
-		segment = &Vsegment{
-			key:  opts.Key,
-			id:   int64(shmId),
-			size: int64(shmSize),
-		}
+	// Return the restored segment and the error
+	return
+}
+
+// createFilledShm creates a segment with the options and fills it, the segment is removed again when fill fails.
+func createFilledShm(opts Vopts, fill func(next *Vsegment) error) (next *Vsegment, err error) {
+	// Create the segment
+	next, err = createShmWithKey(opts)
+	if err != nil {
+		return
+	}
+
+	// Fill it, or remove it
+	err = fill(next)
+	if err != nil {
+		_ = next.deleteWithId()
+		next = nil
+	}
+
+	// Return the filled segment
+	return
+}
+
+// prepareWithKey prepares the segment which replaces the segment of the handle beside it, fills it and puts it in place, see replaceShmWithKey.
+func (receive *Vsegment) prepareWithKey(replacer Replacer, opts Vopts, fill func(next *Vsegment) error) (next *Vsegment, err error) {
+	// Prepare the new segment
+	id, mem, err := replacer.Prepare(receive.key, opts.Size, opts.Mode)
+	if err != nil {
+		return
+	}
+	next = &Vsegment{
+		key:     receive.key,
+		id:      id,
+		size:    int64(len(mem)),
+		mem:     mem,
+		backend: receive.backend,
+		writes:  opts.Writes,
+	}
+
+	// Fill it, write it back when the backend keeps it on a disk, and put it in place
+	err = fill(next)
+	if syncer, ok := receive.backend.(Syncer); ok && err == nil {
+		err = syncer.Sync(next.mem)
+	}
+	if err == nil {
+		err = replacer.Replace(receive.key, id)
+	}
+
+	// Remove the prepared segment when it was not put in place
+	if err != nil {
+		_ = next.Close()
+		_ = replacer.Discard(receive.key, id)
+		next = nil
+	}
+
+	// Return the new segment
+	return
+}
+
+// openShmWithKey to open an existing shared memory segment by using the key and the backend in the options, without any creation flags
+func openShmWithKey(opts Vopts) (segment *Vsegment, err error) {
+	// Resolve the id of the existing shared memory segment
+	backend := opts.backendOrDefault()
+	var shmId int64
+	shmId, err = backend.Open(opts.Key)
+	if err != nil {
+		return
+	}
+
+	// Retrieve the size of the shared memory segment
+	var shmSize int64
+	shmSize, err = backend.Stat(opts.Key, shmId)
+	if err != nil {
+		return
 	}
 
+	// Create a new Vsegment struct to represent the existing shared memory segment
+	segment = &Vsegment{
+		key:     opts.Key,
+		id:      shmId,
+		size:    shmSize,
+		backend: backend,
+		writes:  opts.Writes,
+	}
+
+	// Attach the shared memory segment once
+	err = segment.attachWithId()
+
 	// Return the segment and err values
 	return
 }
 
+/*
+attachWithId maps the whole segment with its backend and keeps the attached memory in the segment,
+so that reads and writes are plain memory accesses instead of one system call per operation.
+*/
+func (receive *Vsegment) attachWithId() (err error) {
+	// Attach the shared memory segment
+	var mem []byte
+	mem, err = receive.backend.Attach(receive.key, receive.id, receive.size)
+	if err != nil {
+		return
+	}
+
+	// Keep the attached memory
+	receive.mem = mem
+
+	// Return the error value
+	return
+}
+
+// detachWithId detaches the shared memory segment, and the attached memory can no longer be used.
+func (receive *Vsegment) detachWithId() (err error) {
+	// Check if the segment is attached
+	if receive.mem == nil {
+		err = ErrShmNotAttached
+		return
+	}
+
+	// Detach from the shared memory segment
+	err = receive.backend.Detach(receive.mem)
+	receive.mem = nil
+
+	// Return the error value
+	return
+}
+
 // writeWithId writes data to a shared memory segment and checks if the data to be written exceeds the available space in the segment.
 // If the data to write is too large, it reduces the length to the remaining available space and sets a previous error variable.
 func (receive *Vsegment) writeWithId(data []byte) (wroteLength int64, err error) {
 	// Check if the Vsegment pointer is nil
 	if receive == nil {
 		err = ErrShmEmptyPoint
+		return
 	}
 
 	// Check if the shared memory ID has been set
@@ -254,6 +490,12 @@ func (receive *Vsegment) writeWithId(data []byte) (wroteLength int64, err error)
 		return
 	}
 
+	// Check if the shared memory segment is attached
+	if receive.mem == nil {
+		err = ErrShmNotAttached
+		return
+	}
+
 	// Check if the current offset exceeds the size of the shared memory segment
 	if receive.offset >= receive.size {
 		err = ErrEndOfFile
@@ -274,20 +516,13 @@ func (receive *Vsegment) writeWithId(data []byte) (wroteLength int64, err error)
 		previousErr = ErrDataDevided
 	}
 
-	// Write the data to the shared memory segment
-	_, err = C.sysv_shm_write(C.int(receive.id), unsafe.Pointer(&data[0]), C.int(wroteLength), C.int(receive.offset))
-	if err != nil {
-		// If an error occurs during the write operation, set the wroteLength to 0 and return
-		wroteLength = 0
-		return
-	}
+	// Write the data to the attached memory
+	copy(receive.mem[receive.offset:receive.offset+wroteLength], data)
 
-	// If the write operation is successful, update the offset and check if there was a previous error
-	if err == nil {
-		receive.offset += wroteLength
-		if previousErr != nil {
-			err = previousErr
-		}
+	// Update the offset and check if there was a previous error
+	receive.offset += wroteLength
+	if previousErr != nil {
+		err = previousErr
 	}
 
 	// Return the wroteLength and any error that occurred during the operation
@@ -295,11 +530,12 @@ func (receive *Vsegment) writeWithId(data []byte) (wroteLength int64, err error)
 }
 
 // readWithId is a function that reads data from a shared memory segment.
-// It includes error checking and buffer allocation before reading data from shared memory.
+// It includes error checking before copying data out of the attached memory.
 func (receive *Vsegment) readWithId(data []byte) (readLength int64, err error) {
 	// Check if the Vsegment pointer is nil
 	if receive == nil {
 		err = ErrShmEmptyPoint
+		return
 	}
 
 	// Check if the shared memory ID has been set
@@ -308,6 +544,12 @@ func (receive *Vsegment) readWithId(data []byte) (readLength int64, err error) {
 		return
 	}
 
+	// Check if the shared memory segment is attached
+	if receive.mem == nil {
+		err = ErrShmNotAttached
+		return
+	}
+
 	// Check if the current offset exceeds the size of the shared memory segment
 	if receive.offset >= receive.size {
 		readLength = 0
@@ -321,19 +563,8 @@ func (receive *Vsegment) readWithId(data []byte) (readLength int64, err error) {
 		length = receive.size - receive.offset
 	}
 
-	// Allocate a buffer for reading data from shared memory
-	buffer := C.malloc(C.size_t(length))
-	defer C.free(buffer)
-
-	// Read data from shared memory
-	_, err = C.sysv_shm_read(C.int(receive.id), buffer, C.int(length), C.int(receive.offset))
-	if err != nil {
-		readLength = 0
-		return
-	}
-
-	// Copy the read data to the output buffer
-	count := copy(data, C.GoBytes(buffer, C.int(length)))
+	// Copy the data from the attached memory to the output buffer
+	count := copy(data, receive.mem[receive.offset:receive.offset+length])
 	if count > 0 {
 		receive.offset += int64(count)
 		readLength = int64(count)
@@ -344,7 +575,7 @@ func (receive *Vsegment) readWithId(data []byte) (readLength int64, err error) {
 	return
 }
 
-// deleteWithId defines a Go function that calls an external C function to close a shared memory region.
+// deleteWithId detaches the shared memory segment and removes it with its backend.
 func (receive *Vsegment) deleteWithId() (err error) {
 
 	// Check if the Vsegment pointer is nil
@@ -359,44 +590,159 @@ func (receive *Vsegment) deleteWithId() (err error) {
 		return
 	}
 
-	// Call an external C function `sysv_shm_close` to close the specified shared memory region.
-	// The `receive.id` argument is passed as an integer and is cast to a C integer using `C.int`.
-	_, err = C.sysv_shm_close(C.int(receive.id))
-	// Return any error that occurred during the call to `sysv_shm_close`.
+	// Detach the attached memory before the segment is removed, after the running operations finished
+	receive.use.Lock()
+	defer receive.use.Unlock()
+	if receive.mem != nil {
+		err = receive.detachWithId()
+		if err != nil {
+			return
+		}
+	}
+
+	// Remove the shared memory segment with its backend
+	err = receive.backend.Remove(receive.key, receive.id)
+	// Return any error that occurred while removing the segment
+	return
+}
+
+// >>>>> >>>>> >>>>> [Segment Handle]
+
+/*
+acquire checks that the segment handle can be used, and keeps it attached until release is called.
+Close waits for the operations which acquired the handle, so they must not block while holding it, see lock.
+*/
+func (receive *Vsegment) acquire() (err error) {
+	// Check if the Vsegment pointer is nil
+	if receive == nil {
+		err = ErrShmEmptyPoint
+		return
+	}
+
+	// Hold the handle, and give it back when it is not attached
+	receive.use.RLock()
+	err = receive.checkAttached()
+	if err != nil {
+		receive.use.RUnlock()
+	}
+
+	// Return the error value
 	return
 }
 
-// >>>>> >>>>> >>>>> [Extension Function]
+// release gives back the handle taken by a successful acquire.
+func (receive *Vsegment) release() {
+	receive.use.RUnlock()
+}
+
+// checkAttached checks that the segment handle can be used, the callers of the operations use acquire instead.
+func (receive *Vsegment) checkAttached() (err error) {
+	// Check if the Vsegment pointer is nil
+	if receive == nil {
+		err = ErrShmEmptyPoint
+		return
+	}
+
+	// Check if the shared memory segment is attached
+	if receive.mem == nil {
+		err = ErrShmNotAttached
+		return
+	}
+
+	// Return the error value
+	return
+}
 
 /*
-NewShm defines a function called "NewShm" which creates a new segment map with specified options.
-It writes values to the map and returns an error if any of the writes fail.
-The values written include version information, a key, ID, size, and a parameter value.
+Bytes returns a zero-copy view of length bytes of the data region, starting shmShift bytes after the header.
+The view is backed by the attached memory, so it is only valid until the segment is closed.
 */
-func NewShm(opts Vopts) (err error) {
-	// Check if the value of opts.Key exceeds the default maximum allowed value
-	if opts.Key > defaultMaxKeyValue {
-		err = ErrExceedDefaultMaxKeyValue
+func (receive *Vsegment) Bytes(shmShift, length int64) (view []byte, err error) {
+	defer receive.wrapError(&err, "Bytes")
+
+	// Keep the segment attached while it is used
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+
+	// Check that the whole view stays between the header and the end of the segment, without adding values which could overflow
+	if shmShift < 0 || length < 0 || shmShift > receive.size-DefualtMinShmSize {
+		err = ErrShmOutOfRange
+		return
+	}
+	start := DefualtMinShmSize + shmShift
+	if length > receive.size-start {
+		err = ErrShmOutOfRange
 		return
 	}
 
-	// Check if the segment already exists in VsegmentMap
-	if shmId := VsegmentMap[opts.Key]; shmId != 0 {
-		err = ErrShmAlreadyExist
+	// Slice the attached memory, the capacity is limited so appending never writes past the view
+	view = receive.mem[start : start+length : start+length]
+
+	// Return the view
+	return
+}
+
+/*
+Close detaches the segment. The segment itself is kept and can be opened again with OpenShm.
+It waits for the operations running on the handle, and the operations called afterwards return ErrShmNotAttached.
+The views returned by Bytes must not be used after Close.
+*/
+func (receive *Vsegment) Close() (err error) {
+	defer receive.wrapError(&err, "Close")
+
+	// Check if the Vsegment pointer is nil
+	if receive == nil {
+		err = ErrShmEmptyPoint
 		return
 	}
 
-	// Create the shared memory segment
-	sg, err := newWithReturnId(opts)
+	// Wait for the running operations, and detach the attached memory
+	receive.use.Lock()
+	defer receive.use.Unlock()
+	err = receive.detachWithId()
+
+	// Return the error value
+	return
+}
+
+/*
+Sync writes the changes of the attached memory back to the disk when the backend keeps the segment on a disk,
+such as FileBackend. The other backends keep the segment in memory only, so there is nothing to write back.
+*/
+func (receive *Vsegment) Sync() (err error) {
+	defer receive.wrapError(&err, "Sync")
+
+	// Keep the segment attached while it is used
+	err = receive.acquire()
 	if err != nil {
 		return
 	}
+	defer receive.release()
+
+	// Only the backends which implement Syncer have something to write back
+	if syncer, ok := receive.backend.(Syncer); ok {
+		err = syncer.Sync(receive.mem)
+	}
+
+	// Return the error value
+	return
+}
 
-	// Store the segment ID in VsegmentMap
-	VsegmentMap[opts.Key] = sg.id
+/*
+initWithId writes the header of a newly created segment, see the header layout next to DefualtMinShmSize.
+It writes values to the segment and returns an error if any of the writes fail.
+The values written include the magic number, version information, the type, a key, ID, size, a parameter value and the checksum.
+*/
+func (receive *Vsegment) initWithId(opts Vopts) (err error) {
+	// The header is written after the magic number, which is written last
+	receive.offset = 4
+	opts = opts.withCreationFlags()
 
 	// Write major version information to the shared memory segment
-	_, err = sg.writeWithId([]byte{
+	_, err = receive.writeWithId([]byte{
 		byte(MajorVersion),
 		byte(MajorVersion >> 8),
 	})
@@ -406,7 +752,7 @@ func NewShm(opts Vopts) (err error) {
 	}
 
 	// Write minor version information to the shared memory segment
-	_, err = sg.writeWithId([]byte{
+	_, err = receive.writeWithId([]byte{
 		byte(MinorVersion),
 		byte(MinorVersion >> 8),
 	})
@@ -416,7 +762,7 @@ func NewShm(opts Vopts) (err error) {
 	}
 
 	// Write patch version information to the shared memory segment
-	_, err = sg.writeWithId([]byte{
+	_, err = receive.writeWithId([]byte{
 		byte(PatchVersion),
 		byte(PatchVersion >> 8),
 	})
@@ -425,16 +771,49 @@ func NewShm(opts Vopts) (err error) {
 		return
 	}
 
+	// Skip the padding at bytes 10:12, and write type information to the shared memory segment
+	receive.offset = 12
+	_, err = receive.writeWithId([]byte{
+		byte(opts.Type),
+		byte(opts.Type >> 8),
+		byte(opts.Type >> 16),
+		byte(opts.Type >> 24),
+	})
+	if err != nil {
+		err = ErrInitializeTypeValue
+		return
+	}
+
+	// Write flag information to the shared memory segment
+	_, err = receive.writeWithId([]byte{
+		byte(opts.flag),
+		byte(opts.flag >> 8),
+		byte(opts.flag >> 16),
+		byte(opts.flag >> 24),
+	})
+	if err != nil {
+		err = ErrInitializeFlagValue
+		return
+	}
+
+	// Write parameter information to the shared memory segment
+	parameter := modeParameter(opts.parameter)
+	_, err = receive.writeWithId(parameter[:])
+	if err != nil {
+		err = ErrInitializeParameterValue
+		return
+	}
+
 	// Write key information to the shared memory segment
-	_, err = sg.writeWithId([]byte{
-		byte(sg.key),
-		byte(sg.key >> 8),
-		byte(sg.key >> 16),
-		byte(sg.key >> 24),
-		byte(sg.key >> 32),
-		byte(sg.key >> 40),
-		byte(sg.key >> 48),
-		byte(sg.key >> 56),
+	_, err = receive.writeWithId([]byte{
+		byte(receive.key),
+		byte(receive.key >> 8),
+		byte(receive.key >> 16),
+		byte(receive.key >> 24),
+		byte(receive.key >> 32),
+		byte(receive.key >> 40),
+		byte(receive.key >> 48),
+		byte(receive.key >> 56),
 	})
 	if err != nil {
 		err = ErrInitializeKeyValue
@@ -442,15 +821,16 @@ func NewShm(opts Vopts) (err error) {
 	}
 
 	// Write id information to the shared memory segment
-	_, err = sg.writeWithId([]byte{
-		byte(sg.id),
-		byte(sg.id >> 8),
-		byte(sg.id >> 16),
-		byte(sg.id >> 24),
-		byte(sg.id >> 32),
-		byte(sg.id >> 40),
-		byte(sg.id >> 48),
-		byte(sg.id >> 56),
+	headerId := receive.headerId()
+	_, err = receive.writeWithId([]byte{
+		byte(headerId),
+		byte(headerId >> 8),
+		byte(headerId >> 16),
+		byte(headerId >> 24),
+		byte(headerId >> 32),
+		byte(headerId >> 40),
+		byte(headerId >> 48),
+		byte(headerId >> 56),
 	})
 	if err != nil {
 		err = ErrInitializeIdValue
@@ -458,311 +838,474 @@ func NewShm(opts Vopts) (err error) {
 	}
 
 	// Write size information to the shared memory segment
-	_, err = sg.writeWithId([]byte{
-		byte(sg.size),
-		byte(sg.size >> 8),
-		byte(sg.size >> 16),
-		byte(sg.size >> 24),
-		byte(sg.size >> 32),
-		byte(sg.size >> 40),
-		byte(sg.size >> 48),
-		byte(sg.size >> 56),
+	_, err = receive.writeWithId([]byte{
+		byte(receive.size),
+		byte(receive.size >> 8),
+		byte(receive.size >> 16),
+		byte(receive.size >> 24),
+		byte(receive.size >> 32),
+		byte(receive.size >> 40),
+		byte(receive.size >> 48),
+		byte(receive.size >> 56),
 	})
 	if err != nil {
 		err = ErrInitializeSizeValue
 		return
 	}
 
-	// Write flag information to the shared memory segment
-	opts.flag = StatusIpcCreate | StatusIpcExclusive
-	_, err = sg.writeWithId([]byte{
-		byte(opts.flag),
-		byte(opts.flag >> 8),
-		byte(opts.flag >> 16),
-		byte(opts.flag >> 24),
+	// Write the checksum of the fields above to the shared memory segment
+	checksum := headerChecksum(receive.mem)
+	_, err = receive.writeWithId([]byte{
+		byte(checksum),
+		byte(checksum >> 8),
+		byte(checksum >> 16),
+		byte(checksum >> 24),
 	})
 	if err != nil {
-		err = ErrInitializeFlagValue
+		err = ErrInitializeChecksumValue
 		return
 	}
 
-	// Write parameter information to the shared memory segment
-	_, err = sg.writeWithId([]byte{0, 6, 0, 0})
+	// Skip the lock at bytes 52:56, the backends fill new segments with zeros, so the lock starts unlocked
+	receive.offset = 56
+
+	// Write offset information to the shared memory segment, the data starts right after the header and the reserved bytes
+	start := DefualtMinShmSize + opts.reserved
+	_, err = receive.writeWithId([]byte{
+		byte(start),
+		byte(start >> 8),
+		byte(start >> 16),
+		byte(start >> 24),
+		byte(start >> 32),
+		byte(start >> 40),
+		byte(start >> 48),
+		byte(start >> 56),
+	})
 	if err != nil {
-		err = ErrInitializeParameterValue
+		err = ErrInitializeOffsetValue
 		return
 	}
 
-	// Write offset information to the shared memory segment
-	_, err = sg.writeWithId([]byte{
-		byte(sg.offset + 8 + 4),
-		byte((sg.offset + 8 + 4) >> 8),
-		byte((sg.offset + 8 + 4) >> 16),
-		byte((sg.offset + 8 + 4) >> 24),
-		byte((sg.offset + 8 + 4) >> 32),
-		byte((sg.offset + 8 + 4) >> 40),
-		byte((sg.offset + 8 + 4) >> 48),
-		byte((sg.offset + 8 + 4) >> 56),
-	})
+	// Write the creation time to the shared memory segment, in Unix seconds
+	var word [8]byte
+	binary.LittleEndian.PutUint64(word[:], uint64(time.Now().Unix()))
+	_, err = receive.writeWithId(word[:])
 	if err != nil {
-		err = ErrInitializeOffsetValue
+		err = ErrInitializeCreatedValue
 		return
 	}
 
-	// Write type information to the shared memory segment
-	/*_, err = sg.writeWithId([]byte{
-		byte(),
-		byte( >> 8),
-		byte( >> 16),
-		byte( >> 24),
-	})
+	// Write the time to live to the shared memory segment, in seconds
+	binary.LittleEndian.PutUint64(word[:], uint64(opts.TTL/time.Second))
+	_, err = receive.writeWithId(word[:])
 	if err != nil {
-		err = ErrInitializeTypeValue
+		err = ErrInitializeTtlValue
 		return
-	}*/
+	}
+
+	// The forwarding record at 80:92 stays zero until GrowShm replaces the segment
+	receive.offset = 92
+
+	// Write the width of the rows of a speedy array, the other types leave it zero, and a chain counts its links there
+	var width uint32
+	if opts.Type == TypeSpeedyArrayInt32 {
+		width = opts.Width
+	}
+	binary.LittleEndian.PutUint32(word[:4], width)
+	_, err = receive.writeWithId(word[:4])
+	if err != nil {
+		err = ErrInitializeWidthValue
+		return
+	}
+
+	// Write the magic number last and atomically, so the header is complete once it can be seen
+	atomic.StoreUint32(receive.magicWord(), binary.LittleEndian.Uint32([]byte(ShmMagic)))
 
 	// Return the error values
 	return
 }
 
 /*
-InfoShm retrieves information about a segment map identified by a key.
-It reads data from the map and returns a Vinfo struct containing the major, minor, and patch versions, key, ID, size, flag, and offset.
-An error is returned if the map does not exist or if the data could not be read.
+Info retrieves information about the segment from its header.
+It returns a Vinfo struct containing the major, minor, and patch versions, key, ID, size, flag, and offset.
 */
-func InfoShm(key int64) (vinfo Vinfo, err error) {
-	// Check if the value of opts.Key exceeds the default maximum allowed value
-	if key > defaultMaxKeyValue {
-		err = ErrExceedDefaultMaxKeyValue
-		return
-	}
+func (receive *Vsegment) Info() (vinfo Vinfo, err error) {
+	defer receive.wrapError(&err, "Info")
 
-	// Check if the given key exists in the VsegmentMap
-	shmId := VsegmentMap[key]
-	if shmId == 0 {
-		err = ErrShmNotExist
+	// Keep the segment attached while it is used
+	err = receive.acquire()
+	if err != nil {
 		return
 	}
+	defer receive.release()
 
-	// Create a byte slice to store the raw information and read the information from the shared memory segment into it
-	vg := new(Vsegment)
-	vg.key = key
-	vg.id = shmId
-	vg.offset = 0
-	vg.size = DefualtMinShmSize
-
-	// Create a byte slice to store the raw information and read the information from the shared memory segment into it
-	rawInfo := make([]byte, DefualtMinShmSize)
-	var count int64
-	count, err = vg.readWithId(rawInfo)
-	if count != DefualtMinShmSize {
-		err = ErrShmFetchInfo
-		return
-	}
+	// Decode the header straight from the attached memory into the Vinfo struct
+	vinfo = decodeInfo(receive.mem[:DefualtMinShmSize])
 
-	// Use binary.LittleEndian to extract information from the raw byte slice and assign it to the corresponding fields in the Vinfo struct
-	vinfo.Major = binary.LittleEndian.Uint16(rawInfo[0:2])           // Extract the Major version number
-	vinfo.Minor = binary.LittleEndian.Uint16(rawInfo[2:4])           // Extract the Minor version number
-	vinfo.Patch = binary.LittleEndian.Uint16(rawInfo[4:6])           // Extract the Patch version number
-	vinfo.Key = int64(binary.LittleEndian.Uint64(rawInfo[6:14]))     // Extract the Key value
-	vinfo.Id = int64(binary.LittleEndian.Uint64(rawInfo[14:22]))     // Extract the Id value
-	vinfo.Size = int64(binary.LittleEndian.Uint64(rawInfo[22:30]))   // Extract the Size value
-	vinfo.Flag = int32(binary.LittleEndian.Uint32(rawInfo[30:34]))   // Extract the flag value
-	vinfo.Parameter[0] = int8(rawInfo[34:35][0])                     // Extract the Parameter value
-	vinfo.Parameter[1] = int8(rawInfo[35:36][0])                     // Extract the Parameter value
-	vinfo.Parameter[2] = int8(rawInfo[36:37][0])                     // Extract the Parameter value
-	vinfo.Parameter[3] = int8(rawInfo[37:38][0])                     // Extract the Parameter value
-	vinfo.Offset = int64(binary.LittleEndian.Uint64(rawInfo[38:46])) // Extract the Offset value
-	vinfo.Type = int32(binary.LittleEndian.Uint32(rawInfo[46:50]))   // Extract the type value
+	// The pinned state is kept by the kernel, so ask the backend
+	vinfo.Pinned, err = receive.pinned()
 
 	// Return the extracted Vinfo struct
 	return
 }
 
-/*
-WriteOffset writes the offset information to the shared memory segment.
-Using this function loses 900 nanoseconds.
-When dealing with locks, it will be optimized.
-*/
-func WriteOffset(key, offset int64) (err error) {
-	// Check if the value of opts.Key exceeds the default maximum allowed value
-	if key > defaultMaxKeyValue {
-		err = ErrExceedDefaultMaxKeyValue
-		return
+// decodeInfo extracts the header fields written by NewShm from the raw byte slice.
+func decodeInfo(rawInfo []byte) (vinfo Vinfo) {
+	// Use binary.LittleEndian to extract information from the raw byte slice and assign it to the corresponding fields in the Vinfo struct
+	copy(vinfo.Magic[:], rawInfo[0:4])                               // Extract the magic number
+	vinfo.Major = binary.LittleEndian.Uint16(rawInfo[4:6])           // Extract the Major version number
+	vinfo.Minor = binary.LittleEndian.Uint16(rawInfo[6:8])           // Extract the Minor version number
+	vinfo.Patch = binary.LittleEndian.Uint16(rawInfo[8:10])          // Extract the Patch version number
+	vinfo.Type = int32(binary.LittleEndian.Uint32(rawInfo[12:16]))   // Extract the type value
+	vinfo.Flag = int32(binary.LittleEndian.Uint32(rawInfo[16:20]))   // Extract the flag value
+	vinfo.Parameter[0] = int8(rawInfo[20:21][0])                     // Extract the Parameter value
+	vinfo.Parameter[1] = int8(rawInfo[21:22][0])                     // Extract the Parameter value
+	vinfo.Parameter[2] = int8(rawInfo[22:23][0])                     // Extract the Parameter value
+	vinfo.Parameter[3] = int8(rawInfo[23:24][0])                     // Extract the Parameter value
+	vinfo.Key = int64(binary.LittleEndian.Uint64(rawInfo[24:32]))    // Extract the Key value
+	vinfo.Id = int64(binary.LittleEndian.Uint64(rawInfo[32:40]))     // Extract the Id value
+	vinfo.Size = int64(binary.LittleEndian.Uint64(rawInfo[40:48]))   // Extract the Size value
+	vinfo.Checksum = binary.LittleEndian.Uint32(rawInfo[48:52])      // Extract the Checksum value
+	vinfo.Offset = int64(binary.LittleEndian.Uint64(rawInfo[56:64])) // Extract the Offset value
+	vinfo.Mode = parameterMode(rawInfo[20:24])                       // Extract the permission bits from the Parameter value
+
+	// Extract the creation time and the time to live, headers of 2.0 have zeros in their place
+	if created := int64(binary.LittleEndian.Uint64(rawInfo[64:72])); created != 0 {
+		vinfo.Created = time.Unix(created, 0)
 	}
+	vinfo.TTL = time.Duration(binary.LittleEndian.Uint64(rawInfo[72:80])) * time.Second
 
-	// Check if the given key exists in the VsegmentMap
-	shmId := VsegmentMap[key]
-	if shmId == 0 {
-		err = ErrShmNotExist
-		return
+	// Extract the width of the rows of a speedy array, the same bytes count the links of a chain
+	if VshmType(vinfo.Type) == TypeSpeedyArrayInt32 {
+		vinfo.Width = binary.LittleEndian.Uint32(rawInfo[92:96])
 	}
 
-	// Create a byte slice to store the raw information and read the information from the shared memory segment into it
-	vg := new(Vsegment)
-	vg.key = key
-	vg.id = shmId
-	vg.offset = 2 + 2 + 2 + 8 + 8 + 8 + 4 + 4
+	// Return the extracted Vinfo struct
+	return
+}
+
+/*
+validateInfo checks the header of an existing attached segment.
+A different major version means the layout is unknown, and the key, id, size and offset must describe the segment they were read from.
+*/
+func validateInfo(segment *Vsegment) (err error) {
+	// Check the magic number first, because nothing else can be trusted in a segment created by another program
+	if segment.size < DefualtMinShmSize || string(segment.mem[0:4]) != ShmMagic {
+		err = ErrForeignShm
+		// The headers written before 2.0 have no magic number, they can be migrated with Migrate
+		if _, err1 := legacyOffset(segment); err1 == nil {
+			err = ErrIncompatibleVersion
+		}
+		return
+	}
+
+	// Decode the header from the attached memory
+	vinfo := decodeInfo(segment.mem[:DefualtMinShmSize])
 
 	/*
-		Set the size of the shared memory segment to the default minimum size.
-		It is because the offset information is stored in the first DefualtMinShmSize of the shared memory segment
-		不用考虑后面的资料数据，直接设 size 为预设最小值就行了
+		Check the major version, a new major version changes the header layout.
+		Minor versions only use the reserved bytes, so headers of other minor versions can still be read.
 	*/
-	vg.size = DefualtMinShmSize
-
-	// Write offset information to the shared memory segment
-	_, err = vg.writeWithId([]byte{
-		byte(offset),
-		byte(offset >> 8),
-		byte(offset >> 16),
-		byte(offset >> 24),
-		byte(offset >> 32),
-		byte(offset >> 40),
-		byte(offset >> 48),
-		byte(offset >> 56),
-	})
+	if vinfo.Major != MajorVersion {
+		err = ErrIncompatibleVersion
+		return
+	}
 
-	// If an error occurs during the operation, set the error to ErrCorrectOffsetValue
-	if err != nil {
-		err = ErrCorrectOffsetValue
+	// Check that the fields written by NewShm have not been changed since
+	if vinfo.Checksum != headerChecksum(segment.mem) {
+		err = ErrShmHeaderCorrupted
 		return
 	}
 
-	// If the operation is successful, return without any errors
+	// Check that the header describes this segment
+	if vinfo.Key != segment.key || vinfo.Id != segment.headerId() || vinfo.Size != segment.size {
+		err = ErrInvalidShmHeader
+		return
+	}
+
+	// Check that the offset stays between the header and the end of the segment
+	if vinfo.Offset < DefualtMinShmSize || vinfo.Offset > segment.size {
+		err = ErrInvalidShmHeader
+		return
+	}
+
+	// Return the error value
+	return
+}
+
+// headerChecksum computes the CRC-32 of the fields NewShm writes once, at bytes 4:48 of the header.
+func headerChecksum(rawInfo []byte) (checksum uint32) {
+	checksum = crc32.ChecksumIEEE(rawInfo[4:48])
+	return
+}
+
+// magicWord returns the magic number at bytes 0:4 of the header for atomic operations.
+func (receive *Vsegment) magicWord() (word *uint32) {
+	word = (*uint32)(unsafe.Pointer(&receive.mem[0]))
 	return
 }
 
 /*
-ReadOffset reads the offset information from the shared memory segment.
-Using this function loses 1000 nanoseconds.
-When dealing with locks, it will be optimized.
+withCreationFlags sets the flags and the permissions used to create the segment from the options.
+The segment is always created exclusively, NewShm opens the existing segment itself under PolicyCreateOrOpen,
+so that only the process which created the segment writes its header.
 */
-func ReadOffset(key int64) (offset int64, err error) {
-	// Check if the value of opts.Key exceeds the default maximum allowed value
-	if key > defaultMaxKeyValue {
-		err = ErrExceedDefaultMaxKeyValue
-		return
+func (opts Vopts) withCreationFlags() Vopts {
+	// Set the flag options with IPC_CREATE and IPC_EXCL, and the memory options
+	opts.flag = StatusIpcCreate | StatusIpcExclusive
+	if opts.HugePages {
+		opts.flag |= StatusHugePages
 	}
-
-	// Check if the given key exists in the VsegmentMap
-	shmId := VsegmentMap[key]
-	if shmId == 0 {
-		err = ErrShmNotExist
-		return
+	if opts.NoReserve {
+		opts.flag |= StatusNoReserve
 	}
 
-	// Create a byte slice to store the raw information and read the information from the shared memory segment into it
-	vg := new(Vsegment)
-	vg.key = key
-	vg.id = shmId
-	vg.offset = 0
-	vg.size = DefualtMinShmSize
-
-	// Create a byte slice to store the raw information and read the information from the shared memory segment into it
-	rawInfo := make([]byte, DefualtMinShmSize)
-	var count int64
-	count, err = vg.readWithId(rawInfo)
-	if count != DefualtMinShmSize {
-		err = ErrShmFetchInfo
-		return
+	// Set the access permissions, unless otherwise specified, segment is owner-read/write (no exec)
+	opts.parameter = opts.Mode.Perm()
+	if opts.parameter == 0 {
+		opts.parameter = defaultShmPermission
 	}
 
-	// Use binary.LittleEndian to extract offset from the raw byte slice
-	offset = int64(binary.LittleEndian.Uint64(rawInfo[38:46])) // Extract the Offset value
+	// Return the options
+	return opts
+}
 
-	// Return the offset value
+// modeParameter records the permission bits as the octal digits of the mode, 0640 is recorded as {0, 6, 4, 0}.
+func modeParameter(mode os.FileMode) (parameter [4]byte) {
+	perm := mode.Perm()
+	parameter = [4]byte{0, byte(perm >> 6 & 7), byte(perm >> 3 & 7), byte(perm & 7)}
+	return
+}
+
+// parameterMode reads the permission bits back from the octal digits recorded by modeParameter.
+func parameterMode(parameter []byte) (mode os.FileMode) {
+	mode = os.FileMode(parameter[1]&7)<<6 | os.FileMode(parameter[2]&7)<<3 | os.FileMode(parameter[3]&7)
 	return
 }
 
 /*
-ReadSize reads the offset information from the shared memory segment.
-Using this function loses 1000 nanoseconds.
-When dealing with locks, it will be optimized.
+WriteOffset writes the offset information to the header of the segment.
+The offset is stored at bytes 56:64 of the header, and it is written atomically into the attached memory.
+Appends reserve their space with compare-and-swap on the same field, so it should not be moved while others are appending.
+An offset inside the header or past the end of the segment is refused with ErrShmOutOfRange.
 */
-func ReadSize(key int64) (shmSize int64, err error) {
-	// Check if the value of opts.Key exceeds the default maximum allowed value
-	if key > defaultMaxKeyValue {
-		err = ErrExceedDefaultMaxKeyValue
+func (receive *Vsegment) WriteOffset(offset int64) (err error) {
+	defer receive.wrapError(&err, "WriteOffset")
+
+	// Keep the segment attached while it is used
+	err = receive.acquire()
+	if err != nil {
 		return
 	}
+	defer receive.release()
 
-	// Check if the given key exists in the VsegmentMap
-	shmId := VsegmentMap[key]
-	if shmId == 0 {
-		err = ErrShmNotExist
+	// The offset must lie between the header and the end of the segment
+	if offset < DefualtMinShmSize || offset > receive.size {
+		err = ErrShmOutOfRange
 		return
 	}
 
-	// Create a byte slice to store the raw information and read the information from the shared memory segment into it
-	vg := new(Vsegment)
-	vg.key = key
-	vg.id = shmId
-	vg.offset = 0
-	vg.size = DefualtMinShmSize
+	// Count the write like an append, so GrowShm does not copy the segment meanwhile, a replaced segment takes no more data
+	err = receive.beginAppend()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err1 := receive.endAppend(); err1 != nil {
+			err = err1
+		}
+	}()
+
+	// Write offset information to the header in the attached memory
+	atomic.StoreUint64(receive.offsetWord(), uint64(offset))
+
+	// If the operation is successful, return without any errors
+	return
+}
+
+// ReadOffset reads the offset information atomically from bytes 56:64 of the header.
+func (receive *Vsegment) ReadOffset() (offset int64, err error) {
+	defer receive.wrapError(&err, "ReadOffset")
 
-	// Create a byte slice to store the raw information and read the information from the shared memory segment into it
-	rawInfo := make([]byte, DefualtMinShmSize)
-	var count int64
-	count, err = vg.readWithId(rawInfo)
-	if count != DefualtMinShmSize {
-		err = ErrShmFetchInfo
+	// Keep the segment attached while it is used
+	err = receive.acquire()
+	if err != nil {
 		return
 	}
+	defer receive.release()
 
-	// Use binary.LittleEndian to extract size from the raw byte slice
-	shmSize = int64(binary.LittleEndian.Uint64(rawInfo[22:30])) // Extract the Size value
+	// Extract offset from the attached memory
+	offset = int64(atomic.LoadUint64(receive.offsetWord())) // Extract the Offset value
 
 	// Return the offset value
 	return
 }
 
+// ReadSize reads the size information from bytes 40:48 of the header.
+func (receive *Vsegment) ReadSize() (shmSize int64, err error) {
+	defer receive.wrapError(&err, "ReadSize")
+
+	// Keep the segment attached while it is used
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+
+	// Use binary.LittleEndian to extract size from the attached memory
+	shmSize = int64(binary.LittleEndian.Uint64(receive.mem[40:48])) // Extract the Size value
+
+	// Return the size value
+	return
+}
+
 /*
-DeleteShm checks key value and existence in VsegmentMap, closes shared memory segment using ID.
+AppendInt32s writes int32 values to the end of the data in little-endian format.
+The space is reserved by advancing the offset value first, see AppendInt32sReturnShift.
 */
-func DeleteShm(key int64) (err error) {
-	// Check if the value of opts.Key exceeds the default maximum allowed value
-	if key > defaultMaxKeyValue {
-		err = ErrExceedDefaultMaxKeyValue
+func (receive *Vsegment) AppendInt32s(values ...int32) (err error) {
+	// Append the values and drop the shift
+	_, err = receive.AppendInt32sReturnShift(values...)
+
+	// Return the error value
+	return
+}
+
+/*
+AppendInt32sReturnShift appends int32 values like AppendInt32s and returns the shift where they were written,
+which can be given to ReadRowInInt32s and OverwriteOrAppendInt32sByShift (after adding DefualtMinShmSize) later.
+It does not take the segment lock: the offset is advanced with compare-and-swap first,
+so goroutines and processes appending at the same time write into disjoint regions in parallel.
+Readers may see the offset covering values which are still being written.
+Under WriteAllOrNothing, the offset is advanced once for all the values, or nothing is written and ErrNotEnoughSpace is returned.
+While GrowShm copies the segment, the append waits for it, and it returns ErrShmMoved once the segment was replaced, see GrowShm.
+*/
+func (receive *Vsegment) AppendInt32sReturnShift(values ...int32) (shmShift int64, err error) {
+	defer receive.wrapError(&err, "AppendInt32sReturnShift")
+
+	shmShift, err = receive.appendData(encodeScalars(values))
+	return
+}
+
+// appendData appends the encoded values at the end of the data and returns the shift where they were written, see AppendInt32sReturnShift.
+func (receive *Vsegment) appendData(data []byte) (shmShift int64, err error) {
+	// Keep the segment attached while it is used
+	err = receive.acquire()
+	if err != nil {
 		return
 	}
+	defer receive.release()
 
-	// Check if the given key exists in the VsegmentMap
-	shmId := VsegmentMap[key]
-	if shmId == 0 {
-		err = ErrShmNotExist
+	// Count the append, so GrowShm does not copy the segment before the values are written, a replaced segment takes no more data
+	err = receive.beginAppend()
+	if err != nil {
 		return
 	}
+	defer func() {
+		if err1 := receive.endAppend(); err1 != nil {
+			err = err1
+		}
+	}()
 
-	// Close the shared memory segment using the corresponding shared memory ID
-	_, err = C.sysv_shm_close(C.int(shmId))
+	// Reserve the space for the values at the end of the data, only all of it under WriteAllOrNothing
+	var offset, reserved int64
+	offset, reserved, err = receive.reserveWithId(int64(len(data)), receive.writes == WriteAllOrNothing)
+	shmShift = offset - DefualtMinShmSize
+	if reserved == 0 {
+		return
+	}
 
-	// Return the error value
+	// Create a cursor limited to the reserved region of the attached memory
+	vg := &Vsegment{
+		key:    receive.key,
+		id:     receive.id,
+		offset: offset,
+		size:   offset + reserved,
+		mem:    receive.mem,
+	}
+
+	// Write the values into the reserved region, the part which does not fit is cut by writeWithId
+	_, _ = vg.writeWithId(data)
+
+	// Return the shift and the error of the reservation
+	return
+}
+
+// offsetWord returns the offset field at bytes 56:64 of the header for atomic operations.
+func (receive *Vsegment) offsetWord() (word *uint64) {
+	/*
+		The header is little-endian, which is the native byte order of the platforms the package runs on.
+		The attached memory is page aligned, so the field is 8-byte aligned.
+	*/
+	word = (*uint64)(unsafe.Pointer(&receive.mem[56]))
 	return
 }
 
 /*
-AppendInt32s writes int32 values to a shared memory segment based on a given key, with error handling for exceeding maximum key value and non-existent keys.
-It utilizes the VsegmentMap to retrieve the shared memory ID and writes the values in little-endian format.
-Finally, it updates the offset value for the given key.
+reserveWithId reserves length bytes at the end of the data by advancing the offset with compare-and-swap,
+and returns the offset where the reserved region starts.
+When the data does not fit, only the remaining space is reserved and ErrDataDevided is returned,
+and when there is no space left, nothing is reserved and ErrEndOfFile is returned.
+When whole is true, the data is reserved completely or not at all, and ErrNotEnoughSpace is returned when it does not fit.
+The offset is written by other processes too, so an offset outside the data region returns ErrInvalidShmHeader.
 */
-func AppendInt32s(key int64, values ...int32) (err error) {
-	// Read the offset value for the given key
-	var shmOffset int64
-	shmOffset, err = ReadOffset(key)
-	if err != nil {
-		return
+func (receive *Vsegment) reserveWithId(length int64, whole bool) (offset, reserved int64, err error) {
+	word := receive.offsetWord()
+	for {
+		// Load the current offset, and check that it lies inside the data region
+		offset = int64(atomic.LoadUint64(word))
+		if offset < DefualtMinShmSize || offset > receive.size {
+			err = ErrInvalidShmHeader
+			return
+		}
+
+		// Work out how much of the length still fits
+		reserved = length
+		if whole && offset+reserved > receive.size {
+			reserved = 0
+			err = ErrNotEnoughSpace
+			return
+		}
+		if offset+reserved > receive.size {
+			reserved = receive.size - offset
+		}
+		if reserved <= 0 && length > 0 {
+			reserved = 0
+			err = ErrEndOfFile
+			return
+		}
+
+		// Advance the offset, retry when another writer moved it first
+		if atomic.CompareAndSwapUint64(word, uint64(offset), uint64(offset+reserved)) {
+			break
+		}
 	}
 
-	// Overwrite the int32 values at the given offset by shifting them
-	err = OverwriteOrAppendInt32sByShift(key, shmOffset, true, values...)
+	// Report the part which did not fit
+	if reserved < length {
+		err = ErrDataDevided
+	}
 
-	// Return the error value
+	// Return the reserved region
 	return
 }
 
 /*
-OverwriteOrAppendInt32sByShift writes int32 values to a shared memory segment with a given key and shmShift.
+advanceWithId moves the offset forward to end, unless appends already moved it further.
+It is used by the overwrite path, which writes at a given shift and can still extend the data.
+*/
+func (receive *Vsegment) advanceWithId(end int64) {
+	word := receive.offsetWord()
+	for {
+		offset := atomic.LoadUint64(word)
+		if int64(offset) >= end || atomic.CompareAndSwapUint64(word, offset, uint64(end)) {
+			return
+		}
+	}
+}
+
+/*
+OverwriteOrAppendInt32sByShift writes int32 values to the segment at shmShift, which counts from the beginning of the segment.
 
 There are two ways to write int32 values to a shared memory segment.
 
@@ -773,21 +1316,55 @@ It is used to append shm data.
 2. OverwriteInt32sByOffset set updateOffset to false
 When updateOffset is false, the offset value will not be updated after writing.
 It is used to overwrite shm data.
+
+Under WriteAllOrNothing, nothing is written and ErrNotEnoughSpace is returned when the values do not all fit in the segment.
+Otherwise the values which fit are written, and the first error, ErrDataDevided or ErrEndOfFile, is returned.
+A shift inside the header, below DefualtMinShmSize, is refused with ErrShmOutOfRange.
+The write takes the segment lock, which is not reentrant, so it returns ErrShmLocked while the lock is held through Lock of this handle.
 */
-func OverwriteOrAppendInt32sByShift(key int64, shmShift int64, updateOffset bool, values ...int32) (err error) {
-	// Check if the value of opts.Key exceeds the default maximum allowed value
-	if key > defaultMaxKeyValue {
-		err = ErrExceedDefaultMaxKeyValue
+func (receive *Vsegment) OverwriteOrAppendInt32sByShift(shmShift int64, updateOffset bool, values ...int32) (err error) {
+	defer receive.wrapError(&err, "OverwriteOrAppendInt32sByShift")
+
+	err = receive.lockedOverwriteOrAppendData(shmShift, updateOffset, encodeScalars(values))
+	return
+}
+
+// lockedOverwriteOrAppendData takes the segment lock and writes the encoded values at shmShift, see OverwriteOrAppendInt32sByShift.
+func (receive *Vsegment) lockedOverwriteOrAppendData(shmShift int64, updateOffset bool, data []byte) (err error) {
+	// Keep the segment attached while it is used
+	err = receive.acquire()
+	if err != nil {
 		return
 	}
+	defer receive.release()
 
-	// Check if the given key exists in the VsegmentMap
-	shmId := VsegmentMap[key]
-	if shmId == 0 {
-		err = ErrShmNotExist
+	// Hold the segment lock while writing
+	err = receive.lockForOverwrite()
+	if err != nil {
 		return
 	}
+	defer func() {
+		err1 := receive.unlock()
+		if err == nil {
+			err = err1
+		}
+	}()
+
+	// GrowShm holds the lock while it copies the data, so a segment it replaced is seen here
+	if receive.moved() {
+		err = ErrShmMoved
+		return
+	}
+
+	// Write the values with the lock held
+	err = receive.overwriteOrAppendData(shmShift, updateOffset, data)
+
+	// Return the error value
+	return
+}
 
+// overwriteOrAppendData writes the encoded values at shmShift of the attached memory, the caller must hold the segment lock.
+func (receive *Vsegment) overwriteOrAppendData(shmShift int64, updateOffset bool, data []byte) (err error) {
 	// move this area to the AppendInt32s function
 	/*var shmShift int64
 	shmShift, err = ReadOffset(key)
@@ -795,36 +1372,35 @@ func OverwriteOrAppendInt32sByShift(key int64, shmShift int64, updateOffset bool
 		return
 	}*/
 
-	// Read the size value for the given key
-	var shmSize int64
-	shmSize, err = ReadSize(key)
-	if err != nil {
+	// The header holds the magic number, the checksum, the lock and the offset, so the values can only be written after it
+	if shmShift < DefualtMinShmSize {
+		err = ErrShmOutOfRange
 		return
 	}
 
-	// Create a new Vsegment instance with the given key, ID, offset and size values
-	vg := new(Vsegment)
-	vg.key = key
-	vg.id = VsegmentMap[key]
-	vg.offset = shmShift
-	vg.size = shmSize
+	// Create a cursor over the attached memory with the given key, ID, offset and size values
+	vg := &Vsegment{
+		key:    receive.key,
+		id:     receive.id,
+		offset: shmShift,
+		size:   receive.size,
+		mem:    receive.mem,
+	}
+
+	// Under WriteAllOrNothing, check that all the values fit before writing any of them
+	if receive.writes == WriteAllOrNothing && shmShift+int64(len(data)) > receive.size {
+		err = ErrNotEnoughSpace
+		return
+	}
 
-	// Write value information to the shared memory segment
-	for i := 0; i < len(values); i++ {
-		_, err = vg.writeWithId([]byte{
-			byte(values[i]),
-			byte(values[i] >> 8),
-			byte(values[i] >> 16),
-			byte(values[i] >> 24),
-		})
+	// Write the values to the shared memory segment, writeWithId stops at the end of the segment
+	if len(data) > 0 {
+		_, err = vg.writeWithId(data)
 	}
 
 	if updateOffset == true {
-		// Update the offset value for the given key
-		err = WriteOffset(key, vg.offset)
-		if err != nil {
-			return
-		}
+		// Update the offset value in the attached memory, it is only moved forward, so reservations of appends are kept
+		receive.advanceWithId(vg.offset)
 	}
 
 	// Return the error value
@@ -832,29 +1408,41 @@ func OverwriteOrAppendInt32sByShift(key int64, shmShift int64, updateOffset bool
 }
 
 /*
-ReadRowInInt32s reads a slice of 32-bit integers from a shared memory segment, specified by a given key and an shmShift.
-It reads each 32-bit integer from the shared memory segment using vg.readWithId and stores them in the input values slice.
+ReadRowInInt32s reads a slice of 32-bit integers from the segment, starting shmShift bytes after the header.
+It reads each 32-bit integer from the attached memory using vg.readWithId and stores them in the input values slice.
 */
-func ReadRowInInt32s(key, shmShift int64, values []int32) (err error) {
-	// Check if the value of opts.Key exceeds the default maximum allowed value
-	if key > defaultMaxKeyValue {
-		err = ErrExceedDefaultMaxKeyValue
-		return
+func (receive *Vsegment) ReadRowInInt32s(shmShift int64, values []int32) (err error) {
+	defer receive.wrapError(&err, "ReadRowInInt32s")
+
+	// Read the encoded values, and decode the ones which were read completely
+	data := make([]byte, len(values)*4)
+	count, err := receive.readRowData(shmShift, data)
+	decodeScalars(data[:count], values)
+	if err == nil && count < int64(len(data)) {
+		err = ErrShmFetchInt32
 	}
 
-	// Check if the given key exists in the VsegmentMap
-	shmId := VsegmentMap[key]
-	if shmId == 0 {
-		err = ErrShmNotExist
+	// Return the error value
+	return
+}
+
+// readRowData reads the encoded values at shmShift after the header into data, and returns how many bytes could be read before the end of the segment.
+func (receive *Vsegment) readRowData(shmShift int64, data []byte) (count int64, err error) {
+	// A negative shift points into the header or before the segment
+	if shmShift < 0 {
+		err = ErrShmOutOfRange
 		return
 	}
 
-	// Read the offset value for the given key
-	var shmOffset int64
-	shmOffset, err = ReadOffset(key)
+	// Keep the segment attached while it is read
+	err = receive.acquire()
 	if err != nil {
 		return
 	}
+	defer receive.release()
+
+	// Read the offset value of the segment
+	shmOffset := int64(atomic.LoadUint64(receive.offsetWord()))
 
 	// Check if the shmShift value exceeds the offset value
 	if shmShift+DefualtMinShmSize > shmOffset {
@@ -862,33 +1450,249 @@ func ReadRowInInt32s(key, shmShift int64, values []int32) (err error) {
 		return
 	}
 
-	// Read the size value for the given key
-	var shmSize int64
-	shmSize, err = ReadSize(key)
+	// Create a cursor over the attached memory with the given key, ID, offset and size values
+	vg := &Vsegment{
+		key:    receive.key,
+		id:     receive.id,
+		offset: DefualtMinShmSize + shmShift,
+		size:   receive.size,
+		mem:    receive.mem,
+	}
+
+	// Read the values, readWithId stops at the end of the segment
+	if len(data) > 0 {
+		count, _ = vg.readWithId(data)
+	}
+
+	// Return the number of bytes read
+	return
+}
+
+// >>>>> >>>>> >>>>> [Extension Function]
+
+/*
+The functions below work on the segments registered in the default registry of the process.
+Callers which need their own set of keys create a registry with NewRegistry and use the segment handles it returns.
+*/
+
+/*
+NewShm creates a new segment with the specified options, writes its header and registers it in the default registry.
+It returns an error if the key is already registered or any of the writes fail.
+*/
+func NewShm(opts Vopts) (err error) {
+	err = defaultRegistry.NewShm(opts)
+	return
+}
+
+/*
+OpenShm opens an existing shared memory segment by key, which may have been created by NewShm in another process.
+It resolves the id through shmget without any creation flags, validates the header written by NewShm
+and registers the segment in the default registry, so that every extension function works across processes.
+*/
+func OpenShm(key int64) (err error) {
+	err = defaultRegistry.OpenShm(key)
+	return
+}
+
+// OpenShmWithOpts opens an existing segment like OpenShm, using the key, the backend and the type in the options.
+func OpenShmWithOpts(opts Vopts) (err error) {
+	err = defaultRegistry.OpenShmWithOpts(opts)
+	return
+}
+
+/*
+CloseShm detaches the segment registered for the key and removes the key from the default registry.
+Unlike DeleteShm, the segment itself is kept, so this process or another one can open it again with OpenShm.
+*/
+func CloseShm(key int64) (err error) {
+	err = defaultRegistry.CloseShm(key)
+	return
+}
+
+// DeleteShm detaches and removes the segment registered for the key, and clears the key in the default registry.
+func DeleteShm(key int64) (err error) {
+	err = defaultRegistry.DeleteShm(key)
+	return
+}
+
+// Segment returns the attached segment handle registered for the key in the default registry.
+func Segment(key int64) (segment *Vsegment, err error) {
+	segment, err = defaultRegistry.Segment(key)
+	return
+}
+
+// SyncShm writes the changes of the segment identified by a key back to the disk, see Vsegment.Sync.
+func SyncShm(key int64) (err error) {
+	// Find the attached segment for the given key
+	var sg *Vsegment
+	sg, err = defaultRegistry.Segment(key)
 	if err != nil {
 		return
 	}
 
-	// Create a new Vsegment instance with the given key, ID, offset and size values
-	vg := new(Vsegment)
-	vg.key = key
-	vg.id = VsegmentMap[key]
-	vg.offset = DefualtMinShmSize + shmShift
-	vg.size = shmSize
+	// Write the changes back
+	err = sg.Sync()
 
-	// Read value information from the shared memory segment and store it in the values slice
-	for i := 0; i < len(values); i++ {
-		tmp := make([]byte, 4)
-		var count int64
-		count, err = vg.readWithId(tmp)
-		if count != 4 {
-			err = ErrShmFetchInt32
-			return
+	// Return the error value
+	return
+}
+
+/*
+InfoShm retrieves information about a segment identified by a key.
+It reads the header and returns a Vinfo struct containing the major, minor, and patch versions, key, ID, size, flag, and offset.
+An error is returned if the segment does not exist.
+*/
+func InfoShm(key int64) (vinfo Vinfo, err error) {
+	// Find the attached segment for the given key
+	var sg *Vsegment
+	sg, err = defaultRegistry.Segment(key)
+	if err != nil {
+		return
+	}
+
+	// Read the header
+	vinfo, err = sg.Info()
+
+	// Return the extracted Vinfo struct
+	return
+}
+
+/*
+PeekShm reads the header of the segment for the key in the options without validating it, and without registering the segment,
+so tools can show the headers which OpenShm refuses, and remove such segments by their id.
+It returns the id of the segment, the header when it has the current layout, and why OpenShm would refuse the segment in headerErr,
+like HeaderErr of ListShm. Only the versions are decoded from the headers of other major versions.
+err is only set when the segment can not be attached.
+*/
+func PeekShm(opts Vopts) (id int64, vinfo Vinfo, headerErr error, err error) {
+	defer wrapError(&err, "PeekShm", opts.Key, 0)
+
+	// Check if the key can be used
+	err = checkKey(opts.Key)
+	if err != nil {
+		return
+	}
+
+	// Attach the segment without validating its header
+	sg, err := openShmWithKey(opts)
+	if err != nil {
+		return
+	}
+	defer func() {
+		err1 := sg.Close()
+		if err == nil {
+			err = err1
 		}
+	}()
+	id = sg.id
+
+	// Check the header the same way OpenShm does, segments without the magic number have nothing to decode
+	headerErr = validateInfo(sg)
+	if sg.size < DefualtMinShmSize || string(sg.mem[0:4]) != ShmMagic {
+		return
+	}
+
+	// The version is always at the same place after the magic number, the rest of the layout depends on the major version
+	vinfo = decodeInfo(sg.mem[:DefualtMinShmSize])
+	if vinfo.Major != MajorVersion {
+		vinfo = Vinfo{Magic: vinfo.Magic, Major: vinfo.Major, Minor: vinfo.Minor, Patch: vinfo.Patch}
+		return
+	}
+
+	// The pinned state is kept by the kernel, so ask the backend
+	vinfo.Pinned, err = sg.pinned()
+
+	// Return the header
+	return
+}
 
-		values[i] = int32(binary.LittleEndian.Uint32(tmp)) // Extract the value
+// WriteOffset writes the offset information to the header of the segment identified by a key.
+func WriteOffset(key, offset int64) (err error) {
+	// Write the offset into the attached segment for the given key, following GrowShm
+	err = defaultRegistry.followMoves(key, func(sg *Vsegment) error {
+		return sg.WriteOffset(offset)
+	})
+
+	// Return the error value
+	return
+}
+
+// ReadOffset reads the offset information from the header of the segment identified by a key.
+func ReadOffset(key int64) (offset int64, err error) {
+	// Find the attached segment for the given key
+	var sg *Vsegment
+	sg, err = defaultRegistry.Segment(key)
+	if err != nil {
+		return
 	}
 
+	// Read the offset
+	offset, err = sg.ReadOffset()
+
+	// Return the offset value
+	return
+}
+
+// ReadSize reads the size information from the header of the segment identified by a key.
+func ReadSize(key int64) (shmSize int64, err error) {
+	// Find the attached segment for the given key
+	var sg *Vsegment
+	sg, err = defaultRegistry.Segment(key)
+	if err != nil {
+		return
+	}
+
+	// Read the size
+	shmSize, err = sg.ReadSize()
+
+	// Return the size value
+	return
+}
+
+// AppendInt32s writes int32 values to the end of the data of the segment identified by a key.
+func AppendInt32s(key int64, values ...int32) (err error) {
+	// Append the values and drop the shift
+	_, err = AppendInt32sReturnShift(key, values...)
+
+	// Return the error value
+	return
+}
+
+// AppendInt32sReturnShift appends int32 values to the segment identified by a key and returns the shift where they were written.
+func AppendInt32sReturnShift(key int64, values ...int32) (shmShift int64, err error) {
+	// Append the values to the attached segment for the given key, following GrowShm
+	err = defaultRegistry.followMoves(key, func(sg *Vsegment) (err error) {
+		shmShift, err = sg.AppendInt32sReturnShift(values...)
+		return
+	})
+
+	// Return the shift and the error value
+	return
+}
+
+// OverwriteOrAppendInt32sByShift writes int32 values to the segment identified by a key at shmShift, see Vsegment.OverwriteOrAppendInt32sByShift.
+func OverwriteOrAppendInt32sByShift(key int64, shmShift int64, updateOffset bool, values ...int32) (err error) {
+	// Write the values to the attached segment for the given key, following GrowShm
+	err = defaultRegistry.followMoves(key, func(sg *Vsegment) error {
+		return sg.OverwriteOrAppendInt32sByShift(shmShift, updateOffset, values...)
+	})
+
+	// Return the error value
+	return
+}
+
+// ReadRowInInt32s reads a slice of 32-bit integers from the segment identified by a key, starting shmShift bytes after the header.
+func ReadRowInInt32s(key, shmShift int64, values []int32) (err error) {
+	// Find the attached segment for the given key
+	var sg *Vsegment
+	sg, err = defaultRegistry.Segment(key)
+	if err != nil {
+		return
+	}
+
+	// Read the values
+	err = sg.ReadRowInInt32s(shmShift, values)
+
 	// Return the error value
 	return
 }
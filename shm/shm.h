@@ -8,14 +8,15 @@
 
 #define IPC_KEY_PROJID 0x42
 
-int sysv_shm_open(int size, int flags, int perm);
-int sysv_shm_open_with_key(int key ,int size, int flags, int perm);
+int sysv_shm_key(const char *path, int proj_id);
+int sysv_shm_open_with_key(int key, size_t size, int flags, int perm);
 void *sysv_shm_attach(int shm_id);
+void *sysv_shm_attach_readonly(int shm_id);
 int sysv_shm_detach(void *addr);
-int sysv_shm_write(int shm_id, void* input, int len, int offset);
-int sysv_shm_read(int shm_id, void* output, int len, int offset);
 size_t sysv_shm_get_size(int shm_id);
 int sysv_shm_lock(int shm_id);
 int sysv_shm_unlock(int shm_id);
+int sysv_shm_is_locked(int shm_id);
+int sysv_shm_stat(int shm_id, struct shmid_ds *shm);
 int sysv_shm_close(int shm_id);
 #endif
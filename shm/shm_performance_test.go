@@ -12,7 +12,7 @@ func Benchmark_shm_WriteOffset(b *testing.B) {
 	// Create a new shared memory segment with Key=testShmKey and Size=1024
 	opts := Vopts{
 		Key:  testShmKey,
-		Size: 50,
+		Size: 1024,
 	}
 
 	// Create a new shared memory segment
@@ -26,9 +26,9 @@ func Benchmark_shm_WriteOffset(b *testing.B) {
 	// Reset the timer
 	b.ResetTimer()
 
-	// Write the offset 9223372036854775807 to the shared memory segment with Key=1 for b.N times
+	// Write the offset 1024 to the shared memory segment with Key=1 for b.N times
 	for i := 0; i < b.N; i++ {
-		_ = WriteOffset(testShmKey, 9223372036854775807)
+		_ = WriteOffset(testShmKey, 1024)
 	}
 }
 
@@ -40,7 +40,7 @@ func Benchmark_shm_ReadOffset(b *testing.B) {
 	// Create a new shared memory segment with Key=testShmKey and Size=1024
 	opts := Vopts{
 		Key:  testShmKey,
-		Size: 50,
+		Size: 1024,
 	}
 
 	// Create a new shared memory segment
@@ -51,8 +51,8 @@ func Benchmark_shm_ReadOffset(b *testing.B) {
 		_ = DeleteShm(testShmKey)
 	}()
 
-	// Write the offset 9223372036854775807 to the shared memory segment with Key=1
-	_ = WriteOffset(testShmKey, 9223372036854775807)
+	// Write the offset 1024 to the shared memory segment with Key=1
+	_ = WriteOffset(testShmKey, 1024)
 
 	// Reset the timer
 	b.ResetTimer()
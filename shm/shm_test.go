@@ -1,7 +1,13 @@
 package shm
 
 import (
+	"encoding/binary"
 	"github.com/stretchr/testify/require"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 )
 
@@ -75,10 +81,10 @@ func Test_Check_Shm_Basic_Function(t *testing.T) {
 			}
 			// Create new shared memory segment with specified options
 			sg, err := newWithReturnId(opts)
-			require.Equal(t, ErrNegativeOrZeroShmKey, err)
+			require.ErrorIs(t, err, ErrNegativeOrZeroShmKey)
 			// Attempt to delete the shared memory segment and ensure that the expected error is returned
 			err = sg.deleteWithId()
-			require.Equal(t, ErrShmEmptyPoint, err)
+			require.ErrorIs(t, err, ErrShmEmptyPoint)
 		})
 
 		// Test zero shm key
@@ -89,10 +95,10 @@ func Test_Check_Shm_Basic_Function(t *testing.T) {
 			}
 			// Create new shared memory segment with specified options
 			sg, err := newWithReturnId(opts)
-			require.Equal(t, ErrNegativeOrZeroShmKey, err)
+			require.ErrorIs(t, err, ErrNegativeOrZeroShmKey)
 			// Attempt to delete the shared memory segment and ensure that the expected error is returned
 			err = sg.deleteWithId()
-			require.Equal(t, ErrShmEmptyPoint, err)
+			require.ErrorIs(t, err, ErrShmEmptyPoint)
 		})
 
 		// Test negative shm size
@@ -104,10 +110,10 @@ func Test_Check_Shm_Basic_Function(t *testing.T) {
 			}
 			// Create new shared memory segment with specified options
 			sg, err := newWithReturnId(opts)
-			require.Equal(t, ErrNegativeOrZeroSize, err)
+			require.ErrorIs(t, err, ErrNegativeOrZeroSize)
 			// Attempt to delete the shared memory segment and ensure that the expected error is returned
 			err = sg.deleteWithId()
-			require.Equal(t, ErrShmEmptyPoint, err)
+			require.ErrorIs(t, err, ErrShmEmptyPoint)
 		})
 
 		// Test zero shm size
@@ -119,10 +125,19 @@ func Test_Check_Shm_Basic_Function(t *testing.T) {
 			}
 			// Create new shared memory segment with specified options
 			sg, err := newWithReturnId(opts)
-			require.Equal(t, ErrNegativeOrZeroSize, err)
+			require.ErrorIs(t, err, ErrNegativeOrZeroSize)
 			// Attempt to delete the shared memory segment and ensure that the expected error is returned
 			err = sg.deleteWithId()
-			require.Equal(t, ErrShmEmptyPoint, err)
+			require.ErrorIs(t, err, ErrShmEmptyPoint)
+		})
+
+		// Test shm size smaller than the header
+		t.Run("shm size smaller than the header", func(t *testing.T) {
+			// The header does not fit, so the segment is neither created nor registered
+			err := NewShm(Vopts{Key: 56, Size: DefualtMinShmSize - 1, Backend: MemoryBackend{}})
+			require.ErrorIs(t, err, ErrShmSizeBelowHeader)
+			_, err = Segment(56)
+			require.ErrorIs(t, err, ErrShmNotExist)
 		})
 
 		// Test negative shm flag
@@ -193,9 +208,10 @@ func Test_Check_Shm_Extension_Function(t *testing.T) {
 		require.NoError(t, err)
 
 		// Verify the information returned by InfoShm()
-		require.Equal(t, uint16(1), info.Major)
-		require.Equal(t, uint16(2), info.Minor)
-		require.Equal(t, uint16(3), info.Patch)
+		require.Equal(t, [4]byte{'F', 'B', 'S', 'Z'}, info.Magic)
+		require.Equal(t, uint16(2), info.Major)
+		require.Equal(t, uint16(3), info.Minor)
+		require.Equal(t, uint16(0), info.Patch)
 		require.Equal(t, testShmKey, info.Key)
 		require.NotEqual(t, int64(0), info.Id)
 		require.Equal(t, int64(1024), info.Size)
@@ -207,8 +223,9 @@ func Test_Check_Shm_Extension_Function(t *testing.T) {
 		require.Equal(t, int8(6), info.Parameter[1])
 		require.Equal(t, int8(0), info.Parameter[2])
 		require.Equal(t, int8(0), info.Parameter[3])
-		require.Equal(t, int64(50), info.Offset)
+		require.Equal(t, int64(96), info.Offset)
 		require.Equal(t, int32(0), info.Type)
+		require.NotEqual(t, uint32(0), info.Checksum)
 	})
 
 	// Test WriteOffset function by creating shared memory segment, writing offset value and verifying information
@@ -232,8 +249,16 @@ func Test_Check_Shm_Extension_Function(t *testing.T) {
 		// Verify that the shared memory segment was created successfully
 		require.NoError(t, err)
 
-		// Call the WriteOffset function with a specific offset value (9223372036854775807)
-		err = WriteOffset(testShmKey, 9223372036854775807) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		// Offsets inside the header or past the end of the segment are refused
+		err = WriteOffset(testShmKey, 9223372036854775807)
+		require.ErrorIs(t, err, ErrShmOutOfRange)
+		err = WriteOffset(testShmKey, -1)
+		require.ErrorIs(t, err, ErrShmOutOfRange)
+		err = WriteOffset(testShmKey, 4)
+		require.ErrorIs(t, err, ErrShmOutOfRange)
+
+		// Call the WriteOffset function with the end of the segment (1024)
+		err = WriteOffset(testShmKey, 1024) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
 		require.NoError(t, err)
 
 		// Get information about the shared memory segment with Key=testShmKey
@@ -244,7 +269,19 @@ func Test_Check_Shm_Extension_Function(t *testing.T) {
 		// Verify the information returned by InfoShm()
 		require.Equal(t, int8(0), info.Parameter[3])
 		info, _ = InfoShm(testShmKey)
-		require.Equal(t, int64(9223372036854775807), info.Offset)
+		require.Equal(t, int64(1024), info.Offset)
+
+		// Appends refuse an offset broken by another process, instead of writing over the header
+		sg, err := Segment(testShmKey)
+		require.NoError(t, err)
+		for _, offset := range []int64{-1, 4, 2048} {
+			atomic.StoreUint64(sg.offsetWord(), uint64(offset))
+			err = AppendInt32s(testShmKey, 1, 2, 3)
+			require.ErrorIs(t, err, ErrInvalidShmHeader)
+			err = AppendInt32s(testShmKey)
+			require.ErrorIs(t, err, ErrInvalidShmHeader)
+		}
+		require.Equal(t, uint64(2048), atomic.LoadUint64(sg.offsetWord()))
 	})
 
 	// Test ReadOffset function by creating shared memory segment, writing offset value, reading and verifying offset value
@@ -268,14 +305,14 @@ func Test_Check_Shm_Extension_Function(t *testing.T) {
 		// Verify that the shared memory segment was created successfully
 		require.NoError(t, err)
 
-		// Call the WriteOffset function with a specific offset value (9223372036854775807)
-		err = WriteOffset(testShmKey, 9223372036854775807) // <<<<< <<<<< <<<<< assistant test sample
+		// Call the WriteOffset function with the end of the segment (1024)
+		err = WriteOffset(testShmKey, 1024) // <<<<< <<<<< <<<<< assistant test sample
 
 		// Read the offset value from the shared memory segment
 		var offset int64
 		offset, err = ReadOffset(testShmKey) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
 		require.NoError(t, err)
-		require.Equal(t, int64(9223372036854775807), offset)
+		require.Equal(t, int64(1024), offset)
 	})
 
 	// Test AppendInt32s function by creating shared memory segment, writing and reading int32 values
@@ -328,5 +365,527 @@ func Test_Check_Shm_Extension_Function(t *testing.T) {
 		err = ReadRowInInt32s(testShmKey, 20, values)
 		require.NoError(t, err)
 		require.Equal(t, []int32{6, 7, 8, 9, 10}, values)
+
+		// Negative shifts point before the data, so they are refused instead of reaching the memory
+		err = ReadRowInInt32s(testShmKey, -200, values)
+		require.ErrorIs(t, err, ErrShmOutOfRange)
+		err = OverwriteOrAppendInt32sByShift(testShmKey, -8, false, 1)
+		require.ErrorIs(t, err, ErrShmOutOfRange)
+
+		// The header can not be overwritten, neither the magic number nor the lock
+		err = OverwriteOrAppendInt32sByShift(testShmKey, 0, false, 1)
+		require.ErrorIs(t, err, ErrShmOutOfRange)
+		err = OverwriteOrAppendInt32sByShift(testShmKey, 52, false, 1)
+		require.ErrorIs(t, err, ErrShmOutOfRange)
+		info, err := InfoShm(testShmKey)
+		require.NoError(t, err)
+		require.Equal(t, ShmMagic, string(info.Magic[:]))
+	})
+}
+
+/*
+Test_Check_Shm_Open_Function checks that OpenShm can register a segment created elsewhere,
+and that it refuses missing segments and segments without a valid header.
+*/
+func Test_Check_Shm_Open_Function(t *testing.T) {
+	// Open a segment as if it was created by another process
+	t.Run("open an existing segment created by NewShm", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 9
+
+		// Create a new shared memory segment with Key=testShmKey and Size=1024
+		opts := Vopts{
+			Key:  testShmKey,
+			Size: 1024,
+		}
+		err := NewShm(opts)
+		require.NoError(t, err)
+
+		// Delete the shared memory segment with Key=testShmKey
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+
+		// Append some values, so that the second process has something to read
+		err = AppendInt32s(testShmKey, 1, 2, 3)
+		require.NoError(t, err)
+
+		// Opening a registered key is refused
+		err = OpenShm(testShmKey)
+		require.ErrorIs(t, err, ErrShmAlreadyExist)
+
+		// Forget the key, which is what a second process looks like
+		sg, err := Segment(testShmKey)
+		require.NoError(t, err)
+		shmId := sg.id
+		err = CloseShm(testShmKey)
+		require.NoError(t, err)
+
+		// Open the segment again by key and check that the same id is registered
+		err = OpenShm(testShmKey) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		require.NoError(t, err)
+		sg, err = Segment(testShmKey)
+		require.NoError(t, err)
+		require.Equal(t, shmId, sg.id)
+
+		// Every extension function works on the opened segment
+		var offset int64
+		offset, err = ReadOffset(testShmKey)
+		require.NoError(t, err)
+		require.Equal(t, int64(DefualtMinShmSize+12), offset)
+
+		values := make([]int32, 3)
+		err = ReadRowInInt32s(testShmKey, 0, values)
+		require.NoError(t, err)
+		require.Equal(t, []int32{1, 2, 3}, values)
+	})
+
+	// Open keys which can not be used
+	t.Run("open segments in invalid cases", func(t *testing.T) {
+		// Negative or zero keys are refused
+		err := OpenShm(0)
+		require.ErrorIs(t, err, ErrNegativeOrZeroShmKey)
+
+		// A key without a segment is refused
+		err = OpenShm(10)
+		require.ErrorIs(t, err, ErrShmNotExist)
+
+		// A segment without a header written by NewShm is refused
+		sg, err := newWithReturnId(Vopts{Key: 10, Size: 1024})
+		require.NoError(t, err)
+		defer func() {
+			err1 := sg.deleteWithId()
+			require.NoError(t, err1)
+		}()
+		err = OpenShm(10)
+		require.ErrorIs(t, err, ErrForeignShm)
+		_, err = Segment(10)
+		require.ErrorIs(t, err, ErrShmNotExist)
+	})
+}
+
+/*
+Test_Check_Shm_Header_Validation checks that opening a segment validates its header,
+including the magic number, the major version, the checksum and the type.
+*/
+func Test_Check_Shm_Header_Validation(t *testing.T) {
+	// The testShmKey is the shared memory key for testing
+	var testShmKey int64 = 24
+
+	// Create a new in-process segment with Key=testShmKey, so the header can be changed freely
+	opts := Vopts{
+		Key:     testShmKey,
+		Size:    DefualtMinShmSize + 16,
+		Backend: MemoryBackend{},
+	}
+	err := NewShm(opts)
+	require.NoError(t, err)
+
+	// Delete the shared memory segment with Key=testShmKey
+	defer func() {
+		err1 := DeleteShm(testShmKey)
+		require.NoError(t, err1)
+	}()
+
+	// Keep the header written by NewShm
+	sg, err := Segment(testShmKey)
+	require.NoError(t, err)
+	header := make([]byte, DefualtMinShmSize)
+	copy(header, sg.mem)
+
+	// open opens the segment in a new registry, the header is restored afterwards
+	open := func(change func(mem []byte), typ VshmType) (err error) {
+		change(sg.mem)
+		err = NewRegistry().OpenShmWithOpts(Vopts{Key: testShmKey, Backend: MemoryBackend{}, Type: typ}) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		copy(sg.mem, header)
+		return
+	}
+
+	// The header written by NewShm is valid
+	err = open(func(mem []byte) {}, TypeRaw)
+	require.NoError(t, err)
+
+	// Segments of other programs have no magic number
+	err = open(func(mem []byte) { mem[0] = 'X' }, TypeRaw)
+	require.ErrorIs(t, err, ErrForeignShm)
+
+	// Another major version has another header layout
+	err = open(func(mem []byte) { binary.LittleEndian.PutUint16(mem[4:6], MajorVersion+1) }, TypeRaw)
+	require.ErrorIs(t, err, ErrIncompatibleVersion)
+
+	// Another minor version can still be read
+	err = open(func(mem []byte) {
+		binary.LittleEndian.PutUint16(mem[6:8], MinorVersion+1)
+		binary.LittleEndian.PutUint32(mem[48:52], headerChecksum(mem))
+	}, TypeRaw)
+	require.NoError(t, err)
+
+	// A changed field no longer matches the checksum
+	err = open(func(mem []byte) { mem[40]++ }, TypeRaw)
+	require.ErrorIs(t, err, ErrShmHeaderCorrupted)
+
+	// The offset and the lock are not covered by the checksum
+	err = open(func(mem []byte) { mem[56] += 4 }, TypeRaw)
+	require.NoError(t, err)
+
+	// A segment holding another data structure is refused when a type is expected
+	err = open(func(mem []byte) {}, TypeSpeedyArrayInt32)
+	require.ErrorIs(t, err, ErrShmTypeMismatch)
+
+	// PeekShm still decodes the headers which are refused, and tells why
+	sg.mem[40]++
+	id, vinfo, headerErr, err := PeekShm(Vopts{Key: testShmKey, Backend: MemoryBackend{}})
+	copy(sg.mem, header)
+	require.NoError(t, err)
+	require.ErrorIs(t, headerErr, ErrShmHeaderCorrupted)
+	require.Equal(t, sg.id, id)
+	require.Equal(t, MajorVersion, vinfo.Major)
+	require.Equal(t, int64(DefualtMinShmSize), vinfo.Offset)
+}
+
+/*
+Test_Check_Shm_Segment_Handle checks the attached segment handle,
+including the zero-copy view over the data region and detaching the segment with Close.
+*/
+func Test_Check_Shm_Segment_Handle(t *testing.T) {
+	// The testShmKey is the shared memory key for testing
+	var testShmKey int64 = 11
+
+	// Create a new shared memory segment with Key=testShmKey and Size=DefualtMinShmSize+16
+	opts := Vopts{
+		Key:  testShmKey,
+		Size: DefualtMinShmSize + 16,
+	}
+	err := NewShm(opts)
+	require.NoError(t, err)
+
+	// Delete the shared memory segment with Key=testShmKey
+	defer func() {
+		err1 := DeleteShm(testShmKey)
+		require.NoError(t, err1)
+	}()
+
+	// Get the attached segment handle
+	sg, err := Segment(testShmKey) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+	require.NoError(t, err)
+
+	// Values appended by the package functions are visible through the view without copying
+	err = AppendInt32s(testShmKey, 1, 2)
+	require.NoError(t, err)
+	view, err := sg.Bytes(0, 8)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 0, 0, 0, 2, 0, 0, 0}, view)
+
+	// Writing into the view is visible to the package functions
+	view[4] = 9
+	values := make([]int32, 2)
+	err = ReadRowInInt32s(testShmKey, 0, values)
+	require.NoError(t, err)
+	require.Equal(t, []int32{1, 9}, values)
+
+	// Views beyond the end of the segment are refused
+	_, err = sg.Bytes(8, 9)
+	require.ErrorIs(t, err, ErrShmOutOfRange)
+	_, err = sg.Bytes(-1, 1)
+	require.ErrorIs(t, err, ErrShmOutOfRange)
+	_, err = sg.Bytes(0, math.MaxInt64)
+	require.ErrorIs(t, err, ErrShmOutOfRange)
+	_, err = sg.Bytes(math.MaxInt64-10, 20)
+	require.ErrorIs(t, err, ErrShmOutOfRange)
+
+	// A segment detached by Close can not be used until it is opened again
+	err = sg.Close()
+	require.NoError(t, err)
+	_, err = sg.Bytes(0, 8)
+	require.ErrorIs(t, err, ErrShmNotAttached)
+	_, err = ReadOffset(testShmKey)
+	require.ErrorIs(t, err, ErrShmNotAttached)
+
+	// Reopen the segment and check that the data is still there
+	err = CloseShm(testShmKey)
+	require.ErrorIs(t, err, ErrShmNotAttached)
+	err = OpenShm(testShmKey)
+	require.NoError(t, err)
+	err = ReadRowInInt32s(testShmKey, 0, values)
+	require.NoError(t, err)
+	require.Equal(t, []int32{1, 9}, values)
+}
+
+/*
+Test_Check_Shm_Append_Reservation checks that appends reserve disjoint regions by advancing the offset,
+including the returned shift, appends from many goroutines and appends beyond the end of the segment.
+*/
+func Test_Check_Shm_Append_Reservation(t *testing.T) {
+	// The testShmKey is the shared memory key for testing
+	var testShmKey int64 = 15
+
+	// Every goroutine appends 100 rows of two int32 values
+	goroutines := 8
+	opts := Vopts{
+		Key:  testShmKey,
+		Size: DefualtMinShmSize + int64(goroutines*100*8) + 6,
+	}
+	err := NewShm(opts)
+	require.NoError(t, err)
+
+	// Delete the shared memory segment with Key=testShmKey
+	defer func() {
+		err1 := DeleteShm(testShmKey)
+		require.NoError(t, err1)
+	}()
+
+	// The first append starts at shift 0 and the second one right after it
+	shmShift, err := AppendInt32sReturnShift(testShmKey, 0, 0) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+	require.NoError(t, err)
+	require.Equal(t, int64(0), shmShift)
+	shmShift, err = AppendInt32sReturnShift(testShmKey, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(8), shmShift)
+
+	// Append from many goroutines, and check that every row is found at the returned shift
+	var wg sync.WaitGroup
+	shifts := make([][]int64, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if g == 0 && i >= 98 {
+					// The two rows at the start leave room for 98 rows of the first goroutine
+					return
+				}
+				shift, err1 := AppendInt32sReturnShift(testShmKey, int32(g), int32(i))
+				require.NoError(t, err1)
+				shifts[g] = append(shifts[g], shift)
+			}
+		}(g)
+	}
+	wg.Wait()
+	values := make([]int32, 2)
+	for g := 0; g < goroutines; g++ {
+		for i, shift := range shifts[g] {
+			err = ReadRowInInt32s(testShmKey, shift, values)
+			require.NoError(t, err)
+			require.Equal(t, []int32{int32(g), int32(i)}, values)
+		}
+	}
+
+	// Only six bytes are left, so the row is cut and the offset reaches the end of the segment
+	shmShift, err = AppendInt32sReturnShift(testShmKey, 1, 2)
+	require.ErrorIs(t, err, ErrDataDevided)
+	require.Equal(t, int64(goroutines*100*8), shmShift)
+	offset, err := ReadOffset(testShmKey)
+	require.NoError(t, err)
+	require.Equal(t, opts.Size, offset)
+
+	// Nothing is left
+	_, err = AppendInt32sReturnShift(testShmKey, 3)
+	require.ErrorIs(t, err, ErrEndOfFile)
+	offset, err = ReadOffset(testShmKey)
+	require.NoError(t, err)
+	require.Equal(t, opts.Size, offset)
+}
+
+// Test_Check_Shm_All_Or_Nothing_Writes checks that the writes under WriteAllOrNothing store every value or none of them.
+func Test_Check_Shm_All_Or_Nothing_Writes(t *testing.T) {
+	// The testShmKey is the shared memory key for testing
+	var testShmKey int64 = 48
+
+	// Create a segment with room for two values and a half
+	opts := Vopts{
+		Key:     testShmKey,
+		Size:    DefualtMinShmSize + 10,
+		Backend: MemoryBackend{},
+		Writes:  WriteAllOrNothing,
+	}
+	err := NewShm(opts)
+	require.NoError(t, err)
+	defer func() {
+		err1 := DeleteShm(testShmKey)
+		require.NoError(t, err1)
+	}()
+
+	// Two values fit, a third one is refused without moving the offset
+	shmShift, err := AppendInt32sReturnShift(testShmKey, 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), shmShift)
+	_, err = AppendInt32sReturnShift(testShmKey, 3)
+	require.ErrorIs(t, err, ErrNotEnoughSpace) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+	offset, err := ReadOffset(testShmKey)
+	require.NoError(t, err)
+	require.Equal(t, int64(DefualtMinShmSize+8), offset)
+
+	// An overwrite running past the end writes nothing
+	err = OverwriteOrAppendInt32sByShift(testShmKey, DefualtMinShmSize+4, true, 7, 8)
+	require.ErrorIs(t, err, ErrNotEnoughSpace)
+	values := make([]int32, 2)
+	err = ReadRowInInt32s(testShmKey, 0, values)
+	require.NoError(t, err)
+	require.Equal(t, []int32{1, 2}, values)
+	sg, err := Segment(testShmKey)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 0}, sg.mem[DefualtMinShmSize+8:])
+
+	// A handle opened with the default policy writes what fits, and returns the first error
+	partial := NewRegistry()
+	err = partial.OpenShmWithOpts(Vopts{Key: testShmKey, Backend: MemoryBackend{}})
+	require.NoError(t, err)
+	defer func() {
+		err1 := partial.CloseShm(testShmKey)
+		require.NoError(t, err1)
+	}()
+	sg, err = partial.Segment(testShmKey)
+	require.NoError(t, err)
+	err = sg.OverwriteOrAppendInt32sByShift(DefualtMinShmSize+4, true, 7, 8, 9)
+	require.ErrorIs(t, err, ErrDataDevided)
+	offset, err = sg.ReadOffset()
+	require.NoError(t, err)
+	require.Equal(t, opts.Size, offset)
+	err = sg.ReadRowInInt32s(0, values)
+	require.NoError(t, err)
+	require.Equal(t, []int32{1, 7}, values)
+}
+
+/*
+Test_Check_Shm_Creation_Options checks the permissions, the memory flags and the open policy in the options,
+and that they are recorded in the header.
+*/
+func Test_Check_Shm_Creation_Options(t *testing.T) {
+	// The permissions are given to the segment and recorded in the header
+	t.Run("permissions", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 28
+
+		// Create a POSIX segment which the group may read and write
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize, Backend: PosixBackend{}, Mode: 0660}) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+
+		// The file has the permissions regardless of the umask, and so does the header
+		stat, err := os.Stat(posixShmPath(testShmKey))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0660), stat.Mode().Perm())
+		info, err := InfoShm(testShmKey)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0660), info.Mode)
+		require.Equal(t, [4]int8{0, 6, 6, 0}, info.Parameter)
+	})
+
+	// The memory flags are passed to shmget, other backends refuse them
+	t.Run("memory flags", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 29
+
+		// Only System V segments can be created without reserving swap space
+		opts := Vopts{Key: testShmKey, Size: DefualtMinShmSize, NoReserve: true}
+		if _, ok := defaultBackend.(SysvBackend); !ok {
+			err := NewShm(opts)
+			require.ErrorIs(t, err, ErrUnsupportedFlag)
+			return
+		}
+		err := NewShm(opts)
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+
+		// The flags are recorded in the header
+		info, err := InfoShm(testShmKey)
+		require.NoError(t, err)
+		require.Equal(t, int32(StatusIpcCreate|StatusIpcExclusive|StatusNoReserve), info.Flag)
+		require.Equal(t, os.FileMode(0600), info.Mode)
+
+		// POSIX segments refuse the flags
+		err = NewRegistry().NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize, Backend: PosixBackend{}, HugePages: true})
+		require.ErrorIs(t, err, ErrUnsupportedFlag)
+	})
+
+	// The segment is created once, and opened by everyone else under PolicyCreateOrOpen
+	t.Run("create or open", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 30
+		opts := Vopts{Key: testShmKey, Size: DefualtMinShmSize + 16, Backend: MemoryBackend{}, Policy: PolicyCreateOrOpen}
+
+		// The first registry creates the segment
+		err := NewShm(opts)
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		err = AppendInt32s(testShmKey, 1, 2)
+		require.NoError(t, err)
+
+		// Without the policy, the segment can not be created again
+		err = NewRegistry().NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 16, Backend: MemoryBackend{}})
+		require.ErrorIs(t, err, syscall.EEXIST)
+
+		// With the policy, many registries open the segment at the same time and see the same values
+		var wg sync.WaitGroup
+		errs := make([]error, 8)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				registry := NewRegistry()
+				errs[i] = registry.NewShm(opts)
+				if errs[i] != nil {
+					return
+				}
+				values := make([]int32, 2)
+				sg, _ := registry.Segment(testShmKey)
+				errs[i] = sg.ReadRowInInt32s(0, values)
+				if errs[i] == nil && (values[0] != 1 || values[1] != 2) {
+					errs[i] = ErrInvalidShmHeader
+				}
+				_ = registry.CloseShm(testShmKey)
+			}(i)
+		}
+		wg.Wait()
+		for _, err1 := range errs {
+			require.NoError(t, err1)
+		}
+
+		// The existing segment must still hold the expected type
+		opts.Type = TypeSpeedyArrayInt32
+		err = NewRegistry().NewShm(opts)
+		require.ErrorIs(t, err, ErrShmTypeMismatch)
+	})
+
+	// Many processes racing to create the same segment all end up with one valid segment
+	t.Run("concurrent create or open", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 31
+		opts := Vopts{Key: testShmKey, Size: DefualtMinShmSize, Backend: MemoryBackend{}, Policy: PolicyCreateOrOpen}
+
+		// Every registry either creates or opens the segment
+		registries := make([]*Vregistry, 8)
+		errs := make([]error, len(registries))
+		var wg sync.WaitGroup
+		for i := range registries {
+			registries[i] = NewRegistry()
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = registries[i].NewShm(opts)
+			}(i)
+		}
+		wg.Wait()
+		for _, err1 := range errs {
+			require.NoError(t, err1)
+		}
+
+		// Close all but the last handle, and delete the segment with it
+		for _, registry := range registries[1:] {
+			err := registry.CloseShm(testShmKey)
+			require.NoError(t, err)
+		}
+		err := registries[0].DeleteShm(testShmKey)
+		require.NoError(t, err)
 	})
 }
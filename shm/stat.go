@@ -0,0 +1,82 @@
+package shm
+
+import (
+	"os"
+	"time"
+)
+
+/*
+Vstat contains what the kernel knows about a segment, as returned by shmctl with IPC_STAT.
+Unlike Vinfo, it is not read from the header, so it also tells which processes use the segment.
+A segment with no attachments and no process about to attach is safe to delete.
+*/
+type Vstat struct {
+	Key        int64
+	Id         int64
+	Size       int64
+	Uid        int         // owner user id
+	Gid        int         // owner group id
+	CreatorUid int         // user id of the creator
+	CreatorGid int         // group id of the creator
+	Mode       os.FileMode // permission bits
+	Pinned     bool        // the segment is locked in RAM with SHM_LOCK
+	Removed    bool        // the segment is marked to be destroyed after the last detach
+	CreatorPid int         // the process which created the segment
+	LastPid    int         // the process which called shmat or shmdt last
+	Attaches   int64       // the number of current attachments
+	AttachTime time.Time   // the time of the last shmat, zero when never attached
+	DetachTime time.Time   // the time of the last shmdt, zero when never detached
+	ChangeTime time.Time   // the time of the creation or the last change with IPC_SET
+}
+
+// KernelStater is implemented by the backends which can report the kernel statistics of a segment, StatShm uses it.
+type KernelStater interface {
+	// KernelStat returns the kernel statistics of the segment with the id.
+	KernelStat(key, id int64) (stat Vstat, err error)
+}
+
+// error list for the statistics
+const (
+	ErrStatUnsupported = Error("shm backend can not report kernel statistics")
+)
+
+/*
+StatShm returns the kernel statistics of the segment for the key.
+The segment is not attached, so it does not count itself in Attaches, and it does not need to be opened first.
+*/
+func StatShm(key int64) (stat Vstat, err error) {
+	stat, err = StatShmWithOpts(Vopts{Key: key})
+	return
+}
+
+// StatShmWithOpts returns the kernel statistics like StatShm, using the key and the backend in the options.
+func StatShmWithOpts(opts Vopts) (stat Vstat, err error) {
+	defer wrapError(&err, "StatShm", opts.Key, 0)
+
+	// Check if the key can be used
+	err = checkKey(opts.Key)
+	if err != nil {
+		return
+	}
+
+	// Only the backends which implement KernelStater know the statistics
+	backend := opts.backendOrDefault()
+	stater, ok := backend.(KernelStater)
+	if !ok {
+		err = ErrStatUnsupported
+		return
+	}
+
+	// Resolve the id of the existing segment without attaching it
+	var id int64
+	id, err = backend.Open(opts.Key)
+	if err != nil {
+		return
+	}
+
+	// Ask the backend
+	stat, err = stater.KernelStat(opts.Key, id)
+
+	// Return the statistics
+	return
+}
@@ -0,0 +1,68 @@
+package shm
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+// Test_Check_Shm_Stat_Function checks the kernel statistics of a segment, including its owner and its attachments.
+func Test_Check_Shm_Stat_Function(t *testing.T) {
+	// The testShmKey is the shared memory key for testing
+	var testShmKey int64 = 33
+
+	// A segment which does not exist has no statistics
+	_, err := StatShm(testShmKey)
+	if _, ok := defaultBackend.(SysvBackend); !ok {
+		require.ErrorIs(t, err, ErrStatUnsupported)
+		return
+	}
+	require.ErrorIs(t, err, ErrShmNotExist)
+
+	// Create a new segment with Key=testShmKey and Size=DefualtMinShmSize+16
+	err = NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 16, Mode: 0640})
+	require.NoError(t, err)
+	defer func() {
+		err1 := DeleteShm(testShmKey)
+		require.NoError(t, err1)
+	}()
+
+	// The statistics describe the segment and this process
+	stat, err := StatShm(testShmKey) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+	require.NoError(t, err)
+	sg, err := Segment(testShmKey)
+	require.NoError(t, err)
+	require.Equal(t, testShmKey, stat.Key)
+	require.Equal(t, sg.id, stat.Id)
+	require.Equal(t, int64(DefualtMinShmSize+16), stat.Size)
+	require.Equal(t, os.Getuid(), stat.Uid)
+	require.Equal(t, os.Getgid(), stat.Gid)
+	require.Equal(t, os.Getuid(), stat.CreatorUid)
+	require.Equal(t, os.FileMode(0640), stat.Mode)
+	require.Equal(t, os.Getpid(), stat.CreatorPid)
+	require.Equal(t, os.Getpid(), stat.LastPid)
+	require.Equal(t, int64(1), stat.Attaches)
+	require.False(t, stat.AttachTime.IsZero())
+	require.True(t, stat.DetachTime.IsZero())
+	require.False(t, stat.ChangeTime.IsZero())
+	require.False(t, stat.Pinned)
+	require.False(t, stat.Removed)
+
+	// Every attachment is counted
+	reader := NewRegistry()
+	err = reader.OpenShm(testShmKey)
+	require.NoError(t, err)
+	stat, err = StatShm(testShmKey)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), stat.Attaches)
+	err = reader.CloseShm(testShmKey)
+	require.NoError(t, err)
+	stat, err = StatShm(testShmKey)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), stat.Attaches)
+	require.False(t, stat.DetachTime.IsZero())
+
+	// In-process segments have no kernel statistics
+	_, err = StatShmWithOpts(Vopts{Key: testShmKey, Backend: MemoryBackend{}})
+	require.ErrorIs(t, err, ErrStatUnsupported)
+}
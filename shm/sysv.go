@@ -0,0 +1,259 @@
+//go:build cgo
+
+package shm
+
+// #include "shm.h"
+import "C"
+import (
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+/*
+SysvBackend keeps the segments in System V shared memory with shmget, shmat, shmdt and shmctl.
+It is the default backend, unless the package is built without cgo or with the shm_memory build tag.
+*/
+type SysvBackend struct{}
+
+// Create creates a System V segment with shmget.
+func (SysvBackend) Create(key, size int64, flag VsysFlags, perm os.FileMode) (id int64, err error) {
+	// Open shared memory segment with given size, flags and permissions by using the key
+	var shmId C.int
+	shmId, err = C.sysv_shm_open_with_key(C.int(key), C.size_t(size), C.int(flag), C.int(perm))
+
+	// shmget returns -1 and sets errno when it fails, errno is ignored otherwise
+	if shmId < 0 {
+		err = opError("shmget", key, 0, err, nil)
+		return
+	}
+	err = nil
+
+	// Return the id
+	id = int64(shmId)
+	return
+}
+
+// Open resolves the id of an existing System V segment with shmget.
+func (SysvBackend) Open(key int64) (id int64, err error) {
+	// A size of zero makes sysv_shm_open_with_key call shmget without IPC_CREAT, so it only resolves an existing id
+	var shmId C.int
+	shmId, err = C.sysv_shm_open_with_key(C.int(key), 0, 0, 0)
+	if shmId < 0 {
+		// Only ENOENT means that there is no segment, EACCES tells that it belongs to someone else
+		var sentinel error
+		if err == syscall.ENOENT {
+			sentinel = ErrShmNotExist
+		}
+		err = opError("shmget", key, 0, err, sentinel)
+		return
+	}
+	err = nil
+
+	// Return the id
+	id = int64(shmId)
+	return
+}
+
+/*
+Attach attaches the segment with shmat and keeps the attached memory as a byte slice,
+so that reads and writes are plain memory accesses instead of one shmat and shmdt per operation.
+*/
+func (SysvBackend) Attach(key, id, size int64) (mem []byte, err error) {
+	// Attach to the shared memory segment to get its memory address
+	var addr unsafe.Pointer
+	addr, err = C.sysv_shm_attach(C.int(id))
+
+	// shmat returns (void *) -1 when attaching fails
+	if uintptr(addr) == ^uintptr(0) {
+		err = opError("shmat", key, id, err, ErrShmAttach)
+		return
+	}
+	err = nil
+
+	// Keep the attached memory as a byte slice of the segment size
+	mem = unsafe.Slice((*byte)(addr), size)
+
+	// Return the attached memory
+	return
+}
+
+// AttachReadOnly attaches the segment with shmat and SHM_RDONLY, so the memory can only be read.
+func (SysvBackend) AttachReadOnly(key, id, size int64) (mem []byte, err error) {
+	// shmat returns (void *) -1 when attaching fails
+	addr, err := C.sysv_shm_attach_readonly(C.int(id))
+	if uintptr(addr) == ^uintptr(0) {
+		err = opError("shmat", key, id, err, ErrShmAttach)
+		return
+	}
+	err = nil
+
+	// Keep the attached memory as a byte slice of the segment size
+	mem = unsafe.Slice((*byte)(addr), size)
+	return
+}
+
+// Detach detaches the memory with shmdt.
+func (SysvBackend) Detach(mem []byte) (err error) {
+	// shmdt returns -1 and sets errno when it fails
+	ret, err := C.sysv_shm_detach(unsafe.Pointer(&mem[0]))
+	if ret < 0 {
+		err = opError("shmdt", 0, 0, err, nil)
+		return
+	}
+	err = nil
+	return
+}
+
+// Stat retrieves the size of the segment with shmctl and IPC_STAT.
+func (SysvBackend) Stat(key, id int64) (size int64, err error) {
+	// Retrieve the size of the shared memory segment
+	var shmSize C.size_t
+	shmSize, err = C.sysv_shm_get_size(C.int(id))
+
+	// sysv_shm_get_size returns (size_t) -1 when shmctl fails
+	if shmSize == ^C.size_t(0) {
+		err = opError("shmctl", key, id, err, ErrFailToRetrieveShmSize)
+		return
+	}
+	err = nil
+
+	// Return the size
+	size = int64(shmSize)
+	return
+}
+
+// Remove marks the segment to be destroyed with shmctl and IPC_RMID, the kernel destroys it after the last detach.
+func (SysvBackend) Remove(key, id int64) (err error) {
+	// shmctl returns -1 and sets errno when it fails, EINVAL and EIDRM tell that the segment is already gone
+	ret, err := C.sysv_shm_close(C.int(id))
+	if ret < 0 {
+		var sentinel error
+		if err == syscall.EINVAL || err == syscall.EIDRM {
+			sentinel = ErrShmNotExist
+		}
+		err = opError("shmctl", key, id, err, sentinel)
+		return
+	}
+	err = nil
+	return
+}
+
+// Pin locks the segment in RAM with shmctl and SHM_LOCK.
+func (SysvBackend) Pin(key, id int64) (err error) {
+	// shmctl returns -1 and sets errno, such as EPERM or ENOMEM, when the segment can not be locked
+	ret, err := C.sysv_shm_lock(C.int(id))
+	if ret < 0 {
+		err = opError("shmctl", key, id, err, nil)
+		return
+	}
+	err = nil
+	return
+}
+
+// Unpin unlocks the segment with shmctl and SHM_UNLOCK.
+func (SysvBackend) Unpin(key, id int64) (err error) {
+	// shmctl returns -1 and sets errno when the segment can not be unlocked
+	ret, err := C.sysv_shm_unlock(C.int(id))
+	if ret < 0 {
+		err = opError("shmctl", key, id, err, nil)
+		return
+	}
+	err = nil
+	return
+}
+
+// Pinned tells if the segment is locked in RAM, from the mode returned by shmctl and IPC_STAT.
+func (SysvBackend) Pinned(key, id int64) (pinned bool, err error) {
+	// Ignore errno unless shmctl failed
+	ret, err := C.sysv_shm_is_locked(C.int(id))
+	if ret < 0 {
+		err = opError("shmctl", key, id, err, nil)
+		return
+	}
+	err = nil
+	pinned = ret == 1
+	return
+}
+
+// KernelStat returns the kernel statistics of the segment from shmctl and IPC_STAT.
+func (SysvBackend) KernelStat(key, id int64) (stat Vstat, err error) {
+	// Copy the shmid_ds struct of the segment
+	var ds C.struct_shmid_ds
+	ret, err := C.sysv_shm_stat(C.int(id), &ds)
+	if ret < 0 {
+		err = opError("shmctl", key, id, err, nil)
+		return
+	}
+	err = nil
+
+	// Convert the fields, the times are zero when they never happened
+	unixTime := func(sec C.time_t) (t time.Time) {
+		if sec != 0 {
+			t = time.Unix(int64(sec), 0)
+		}
+		return
+	}
+	stat = Vstat{
+		Key:        key,
+		Id:         id,
+		Size:       int64(ds.shm_segsz),
+		Uid:        int(ds.shm_perm.uid),
+		Gid:        int(ds.shm_perm.gid),
+		CreatorUid: int(ds.shm_perm.cuid),
+		CreatorGid: int(ds.shm_perm.cgid),
+		Mode:       os.FileMode(ds.shm_perm.mode).Perm(),
+		Pinned:     ds.shm_perm.mode&C.SHM_LOCKED != 0,
+		Removed:    ds.shm_perm.mode&C.SHM_DEST != 0,
+		CreatorPid: int(ds.shm_cpid),
+		LastPid:    int(ds.shm_lpid),
+		Attaches:   int64(ds.shm_nattch),
+		AttachTime: unixTime(ds.shm_atime),
+		DetachTime: unixTime(ds.shm_dtime),
+		ChangeTime: unixTime(ds.shm_ctime),
+	}
+
+	// Return the statistics
+	return
+}
+
+// readSysvHeader copies the header of the segment with the id through a read-only attachment, the header is shorter when the segment is.
+func readSysvHeader(id, size int64) (header []byte, err error) {
+	// Attach the segment for reading only, shmat returns (void *) -1 when attaching fails
+	addr, err := C.sysv_shm_attach_readonly(C.int(id))
+	if uintptr(addr) == ^uintptr(0) {
+		err = opError("shmat", 0, id, err, ErrShmAttach)
+		return
+	}
+	err = nil
+
+	// Copy the header and detach the segment again
+	if size > DefualtMinShmSize {
+		size = DefualtMinShmSize
+	}
+	header = append([]byte(nil), unsafe.Slice((*byte)(addr), size)...)
+	_, _ = C.sysv_shm_detach(addr)
+
+	// Return the header
+	return
+}
+
+// ftok derives a System V key from the path of an existing file with ftok in C.
+func ftok(path string, projID int) (key int64, err error) {
+	// Derive the key with ftok
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	cKey, err := C.sysv_shm_key(cPath, C.int(projID))
+	if cKey == -1 {
+		err = opError("ftok", 0, 0, err, ErrDeriveShmKey)
+		return
+	}
+
+	// Ignore errno when ftok succeeded
+	key = int64(cKey)
+	err = nil
+
+	// Return the key
+	return
+}
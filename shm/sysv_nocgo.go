@@ -0,0 +1,111 @@
+//go:build !cgo
+
+package shm
+
+import (
+	"os"
+	"syscall"
+)
+
+/*
+SysvBackend keeps the segments in System V shared memory, which needs cgo.
+The package is built without cgo, so every operation fails with ErrBackendUnavailable, and MemoryBackend is the default backend.
+*/
+type SysvBackend struct{}
+
+// ipcKeyProjId is the project id of filebasez, the same value as IPC_KEY_PROJID in shm.h
+const ipcKeyProjId = 0x42
+
+// Create is not available without cgo.
+func (SysvBackend) Create(key, size int64, flag VsysFlags, perm os.FileMode) (id int64, err error) {
+	err = &OpError{Op: "shmget", Key: key, Err: ErrBackendUnavailable}
+	return
+}
+
+// Open is not available without cgo.
+func (SysvBackend) Open(key int64) (id int64, err error) {
+	err = &OpError{Op: "shmget", Key: key, Err: ErrBackendUnavailable}
+	return
+}
+
+// Attach is not available without cgo.
+func (SysvBackend) Attach(key, id, size int64) (mem []byte, err error) {
+	err = &OpError{Op: "shmat", Key: key, Id: id, Err: ErrBackendUnavailable}
+	return
+}
+
+// AttachReadOnly is not available without cgo.
+func (SysvBackend) AttachReadOnly(key, id, size int64) (mem []byte, err error) {
+	err = &OpError{Op: "shmat", Key: key, Id: id, Err: ErrBackendUnavailable}
+	return
+}
+
+// Detach is not available without cgo.
+func (SysvBackend) Detach(mem []byte) (err error) {
+	err = &OpError{Op: "shmdt", Err: ErrBackendUnavailable}
+	return
+}
+
+// Stat is not available without cgo.
+func (SysvBackend) Stat(key, id int64) (size int64, err error) {
+	err = &OpError{Op: "shmctl", Key: key, Id: id, Err: ErrBackendUnavailable}
+	return
+}
+
+// Remove is not available without cgo.
+func (SysvBackend) Remove(key, id int64) (err error) {
+	err = &OpError{Op: "shmctl", Key: key, Id: id, Err: ErrBackendUnavailable}
+	return
+}
+
+// Pin is not available without cgo.
+func (SysvBackend) Pin(key, id int64) (err error) {
+	err = &OpError{Op: "shmctl", Key: key, Id: id, Err: ErrBackendUnavailable}
+	return
+}
+
+// Unpin is not available without cgo.
+func (SysvBackend) Unpin(key, id int64) (err error) {
+	err = &OpError{Op: "shmctl", Key: key, Id: id, Err: ErrBackendUnavailable}
+	return
+}
+
+// Pinned is not available without cgo.
+func (SysvBackend) Pinned(key, id int64) (pinned bool, err error) {
+	err = &OpError{Op: "shmctl", Key: key, Id: id, Err: ErrBackendUnavailable}
+	return
+}
+
+// KernelStat is not available without cgo.
+func (SysvBackend) KernelStat(key, id int64) (stat Vstat, err error) {
+	err = &OpError{Op: "shmctl", Key: key, Id: id, Err: ErrBackendUnavailable}
+	return
+}
+
+// readSysvHeader is not available without cgo.
+func readSysvHeader(id, size int64) (header []byte, err error) {
+	err = &OpError{Op: "shmat", Id: id, Err: ErrBackendUnavailable}
+	return
+}
+
+// ftok derives a System V key from the path of an existing file the same way as ftok in glibc.
+func ftok(path string, projID int) (key int64, err error) {
+	// Unless otherwise specified, the project id of filebasez is used
+	if projID == 0 {
+		projID = ipcKeyProjId
+	}
+
+	// Find the device and inode numbers of the file
+	var stat syscall.Stat_t
+	err = syscall.Stat(path, &stat)
+	if err != nil {
+		err = opError("ftok", 0, 0, err, ErrDeriveShmKey)
+		return
+	}
+
+	// Combine the lowest bits of the inode number, the device number and the project id
+	key = int64(uint32(stat.Ino&0xffff) | uint32(stat.Dev&0xff)<<16 | uint32(projID&0xff)<<24)
+
+	// Return the key
+	return
+}
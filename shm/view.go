@@ -0,0 +1,302 @@
+package shm
+
+import (
+	"sync"
+	"unsafe"
+)
+
+/*
+The typed views are slices backed directly by the attached memory of a segment, so scans read the cells in place,
+without copying them like ReadRowInInt32s does. Their lifetime is the one of the handle they were taken from:
+a view of a Vsegment is valid until the segment is detached by Close, CloseShm or DeleteShm,
+and a view of a Vview is valid until the Vview is closed. Using a view afterwards crashes the process.
+A view taken before GrowShm keeps showing the old segment, and its writes are not seen in the new one.
+
+Views are not synchronized, the writers and the readers coordinate themselves, for example with LockShm.
+The values are stored in the byte order of the machine, which is little-endian on the platforms the package runs on,
+the same as the values written by AppendInt32s.
+*/
+
+// ReadOnlyAttacher is implemented by the backends which can attach a segment for reading only, Vsegment.View uses it.
+type ReadOnlyAttacher interface {
+	// AttachReadOnly maps the whole segment into the memory of the process, writing to the memory faults.
+	AttachReadOnly(key, id, size int64) (mem []byte, err error)
+}
+
+// error list for the views
+const (
+	ErrReadOnlyUnsupported = Error("shm backend can not attach segments for reading only")
+	ErrMisalignedView      = Error("shm view is not aligned to the size of its values")
+)
+
+// region returns the memory of count values of the size at shmShift after the header, the shift must be a multiple of the size.
+func region(mem []byte, shmShift, count, size int64) (view []byte, err error) {
+	// Check that the memory is attached
+	if mem == nil {
+		err = ErrShmNotAttached
+		return
+	}
+
+	// The header size is a multiple of 8, so the values are aligned when the shift is
+	if shmShift%size != 0 {
+		err = ErrMisalignedView
+		return
+	}
+
+	// Check that the whole view stays between the header and the end of the segment, dividing the room so nothing can overflow
+	if shmShift < 0 || count < 0 || shmShift > int64(len(mem))-DefualtMinShmSize {
+		err = ErrShmOutOfRange
+		return
+	}
+	start := DefualtMinShmSize + shmShift
+	if count > (int64(len(mem))-start)/size {
+		err = ErrShmOutOfRange
+		return
+	}
+
+	// Slice the memory, the capacity is limited so appending never writes past the view
+	end := start + count*size
+	view = mem[start:end:end]
+	return
+}
+
+// int32View returns the view of count int32 values at shmShift.
+func int32View(mem []byte, shmShift, count int64) (view []int32, err error) {
+	bytes, err := region(mem, shmShift, count, 4)
+	if err != nil || count == 0 {
+		return
+	}
+	view = unsafe.Slice((*int32)(unsafe.Pointer(&bytes[0])), count)
+	return
+}
+
+// int64View returns the view of count int64 values at shmShift.
+func int64View(mem []byte, shmShift, count int64) (view []int64, err error) {
+	bytes, err := region(mem, shmShift, count, 8)
+	if err != nil || count == 0 {
+		return
+	}
+	view = unsafe.Slice((*int64)(unsafe.Pointer(&bytes[0])), count)
+	return
+}
+
+// float64View returns the view of count float64 values at shmShift.
+func float64View(mem []byte, shmShift, count int64) (view []float64, err error) {
+	bytes, err := region(mem, shmShift, count, 8)
+	if err != nil || count == 0 {
+		return
+	}
+	view = unsafe.Slice((*float64)(unsafe.Pointer(&bytes[0])), count)
+	return
+}
+
+// Int32s returns count int32 values at shmShift after the header, backed by the attached memory, the shift must be a multiple of 4.
+func (receive *Vsegment) Int32s(shmShift, count int64) (view []int32, err error) {
+	defer receive.wrapError(&err, "Int32s")
+
+	// Keep the segment attached while it is used
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+
+	// Return the view
+	view, err = int32View(receive.mem, shmShift, count)
+	return
+}
+
+// Int64s returns count int64 values at shmShift after the header, backed by the attached memory, the shift must be a multiple of 8.
+func (receive *Vsegment) Int64s(shmShift, count int64) (view []int64, err error) {
+	defer receive.wrapError(&err, "Int64s")
+
+	// Keep the segment attached while it is used
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+
+	// Return the view
+	view, err = int64View(receive.mem, shmShift, count)
+	return
+}
+
+// Float64s returns count float64 values at shmShift after the header, backed by the attached memory, the shift must be a multiple of 8.
+func (receive *Vsegment) Float64s(shmShift, count int64) (view []float64, err error) {
+	defer receive.wrapError(&err, "Float64s")
+
+	// Keep the segment attached while it is used
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+
+	// Return the view
+	view, err = float64View(receive.mem, shmShift, count)
+	return
+}
+
+/*
+Vview is a read-only attachment of a segment, which hands out the same views as Vsegment.
+The memory is attached a second time for reading only, so writing to one of its views faults instead of changing the segment.
+Its views are valid until Close, the segment handle it was taken from may be closed before.
+*/
+type Vview struct {
+	mu      sync.Mutex
+	key     int64
+	id      int64
+	mem     []byte
+	backend Backend
+}
+
+// View attaches the segment again for reading only, the backend must implement ReadOnlyAttacher.
+func (receive *Vsegment) View() (view *Vview, err error) {
+	defer receive.wrapError(&err, "View")
+
+	// Keep the segment attached while it is used
+	err = receive.acquire()
+	if err != nil {
+		return
+	}
+	defer receive.release()
+
+	// Only the backends which implement ReadOnlyAttacher can attach for reading only
+	attacher, ok := receive.backend.(ReadOnlyAttacher)
+	if !ok {
+		err = ErrReadOnlyUnsupported
+		return
+	}
+
+	// Attach the segment for reading only
+	mem, err := attacher.AttachReadOnly(receive.key, receive.id, receive.size)
+	if err != nil {
+		return
+	}
+
+	// Return the view
+	view = &Vview{
+		key:     receive.key,
+		id:      receive.id,
+		mem:     mem,
+		backend: receive.backend,
+	}
+	return
+}
+
+// memory returns the read-only memory, or ErrShmNotAttached after Close.
+func (receive *Vview) memory() (mem []byte, err error) {
+	if receive == nil {
+		err = ErrShmEmptyPoint
+		return
+	}
+	receive.mu.Lock()
+	mem = receive.mem
+	receive.mu.Unlock()
+	if mem == nil {
+		err = ErrShmNotAttached
+	}
+	return
+}
+
+// Bytes returns length bytes at shmShift after the header, backed by the read-only memory.
+func (receive *Vview) Bytes(shmShift, length int64) (view []byte, err error) {
+	defer receive.wrapError(&err, "Bytes")
+
+	// Find the read-only memory
+	mem, err := receive.memory()
+	if err != nil {
+		return
+	}
+
+	// Return the view
+	view, err = region(mem, shmShift, length, 1)
+	return
+}
+
+// Int32s returns count int32 values at shmShift after the header, backed by the read-only memory, the shift must be a multiple of 4.
+func (receive *Vview) Int32s(shmShift, count int64) (view []int32, err error) {
+	defer receive.wrapError(&err, "Int32s")
+
+	// Find the read-only memory
+	mem, err := receive.memory()
+	if err != nil {
+		return
+	}
+
+	// Return the view
+	view, err = int32View(mem, shmShift, count)
+	return
+}
+
+// Int64s returns count int64 values at shmShift after the header, backed by the read-only memory, the shift must be a multiple of 8.
+func (receive *Vview) Int64s(shmShift, count int64) (view []int64, err error) {
+	defer receive.wrapError(&err, "Int64s")
+
+	// Find the read-only memory
+	mem, err := receive.memory()
+	if err != nil {
+		return
+	}
+
+	// Return the view
+	view, err = int64View(mem, shmShift, count)
+	return
+}
+
+// Float64s returns count float64 values at shmShift after the header, backed by the read-only memory, the shift must be a multiple of 8.
+func (receive *Vview) Float64s(shmShift, count int64) (view []float64, err error) {
+	defer receive.wrapError(&err, "Float64s")
+
+	// Find the read-only memory
+	mem, err := receive.memory()
+	if err != nil {
+		return
+	}
+
+	// Return the view
+	view, err = float64View(mem, shmShift, count)
+	return
+}
+
+// Close detaches the read-only memory, the views taken from the Vview must not be used afterwards.
+func (receive *Vview) Close() (err error) {
+	defer receive.wrapError(&err, "Close")
+
+	// Check if the view can be used
+	if receive == nil {
+		err = ErrShmEmptyPoint
+		return
+	}
+
+	// Take the memory, so the view is closed only once
+	receive.mu.Lock()
+	mem := receive.mem
+	receive.mem = nil
+	receive.mu.Unlock()
+	if mem == nil {
+		err = ErrShmNotAttached
+		return
+	}
+
+	// Detach the memory
+	err = receive.backend.Detach(mem)
+	return
+}
+
+// ViewShm attaches the segment identified by a key again for reading only, see Vsegment.View.
+func ViewShm(key int64) (view *Vview, err error) {
+	// Find the attached segment for the given key
+	var sg *Vsegment
+	sg, err = defaultRegistry.Segment(key)
+	if err != nil {
+		return
+	}
+
+	// Attach the view
+	view, err = sg.View()
+
+	// Return the view
+	return
+}
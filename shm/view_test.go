@@ -0,0 +1,114 @@
+package shm
+
+import (
+	"github.com/stretchr/testify/require"
+	"math"
+	"runtime/debug"
+	"testing"
+)
+
+// Test_Check_Shm_Views checks the typed views backed by the attached memory, and the read-only views.
+func Test_Check_Shm_Views(t *testing.T) {
+	// The views of a segment read and write the memory in place
+	t.Run("typed views", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 52
+
+		// Create the segment and append values
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 32, Backend: MemoryBackend{}})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		err = AppendInt32s(testShmKey, 1, 2, 3)
+		require.NoError(t, err)
+		sg, err := Segment(testShmKey)
+		require.NoError(t, err)
+
+		// The int32 view holds the values, and writing it changes the segment
+		int32s, err := sg.Int32s(0, 3) // <<<<< <<<<< <<<<< <<<<< <<<<< main test sample
+		require.NoError(t, err)
+		require.Equal(t, []int32{1, 2, 3}, int32s)
+		int32s[1] = 20
+		values := make([]int32, 3)
+		err = ReadRowInInt32s(testShmKey, 0, values)
+		require.NoError(t, err)
+		require.Equal(t, []int32{1, 20, 3}, values)
+
+		// The float64 and the int64 views share the same memory
+		float64s, err := sg.Float64s(16, 2)
+		require.NoError(t, err)
+		float64s[0], float64s[1] = 1.5, -2.25
+		int64s, err := sg.Int64s(16, 2)
+		require.NoError(t, err)
+		require.Equal(t, []int64{int64(math.Float64bits(1.5)), int64(math.Float64bits(-2.25))}, int64s)
+
+		// The views must be aligned and stay inside the segment
+		_, err = sg.Int64s(4, 1)
+		require.ErrorIs(t, err, ErrMisalignedView)
+		_, err = sg.Int32s(0, 9)
+		require.ErrorIs(t, err, ErrShmOutOfRange)
+		_, err = sg.Int32s(-4, 1)
+		require.ErrorIs(t, err, ErrShmOutOfRange)
+		_, err = sg.Int64s(0, math.MaxInt64/4)
+		require.ErrorIs(t, err, ErrShmOutOfRange)
+		_, err = sg.Int32s(math.MaxInt64-3, 1)
+		require.ErrorIs(t, err, ErrShmOutOfRange)
+		empty, err := sg.Int32s(32, 0)
+		require.NoError(t, err)
+		require.Len(t, empty, 0)
+
+		// Memory kept by Go can not be attached for reading only
+		_, err = sg.View()
+		require.ErrorIs(t, err, ErrReadOnlyUnsupported)
+	})
+
+	// The read-only views see the changes, and can not change the segment
+	t.Run("read-only views", func(t *testing.T) {
+		// The testShmKey is the shared memory key for testing
+		var testShmKey int64 = 53
+
+		// Create a POSIX segment, which can be attached for reading only
+		err := NewShm(Vopts{Key: testShmKey, Size: DefualtMinShmSize + 16, Backend: PosixBackend{}})
+		require.NoError(t, err)
+		defer func() {
+			err1 := DeleteShm(testShmKey)
+			require.NoError(t, err1)
+		}()
+		err = AppendInt32s(testShmKey, 4, 5)
+		require.NoError(t, err)
+
+		// The read-only view holds the values, and sees the values appended later
+		view, err := ViewShm(testShmKey)
+		require.NoError(t, err)
+		int32s, err := view.Int32s(0, 3)
+		require.NoError(t, err)
+		require.Equal(t, []int32{4, 5, 0}, int32s)
+		err = AppendInt32s(testShmKey, 6)
+		require.NoError(t, err)
+		require.Equal(t, []int32{4, 5, 6}, int32s)
+		raw, err := view.Bytes(0, 4)
+		require.NoError(t, err)
+		require.Equal(t, []byte{4, 0, 0, 0}, raw)
+
+		// Writing to the read-only view faults
+		defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+		faulted := func() (faulted bool) {
+			defer func() {
+				faulted = recover() != nil
+			}()
+			int32s[0] = 40
+			return
+		}()
+		require.True(t, faulted)
+
+		// The closed view hands out no more views
+		err = view.Close()
+		require.NoError(t, err)
+		_, err = view.Int32s(0, 1)
+		require.ErrorIs(t, err, ErrShmNotAttached)
+		err = view.Close()
+		require.ErrorIs(t, err, ErrShmNotAttached)
+	})
+}